@@ -0,0 +1,75 @@
+package dockergen
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultReconnectInterval    = time.Second
+	defaultReconnectMaxInterval = time.Minute
+)
+
+// backoff computes the waits between reconnection attempts: doubling from
+// min up to max, each randomly shortened by up to half so that several
+// docker-gen instances don't reconnect in lockstep
+type backoff struct {
+	min, max time.Duration
+	attempts int
+	since    time.Time
+}
+
+func (b *backoff) next(now time.Time) time.Duration {
+	if b.attempts == 0 {
+		b.since = now
+	}
+	delay := b.min
+	for i := 0; i < b.attempts && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	b.attempts++
+	if delay < 2 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+func (g *generator) newBackoff() *backoff {
+	b := &backoff{min: g.ReconnectInterval, max: g.ReconnectMaxInterval}
+	if b.min <= 0 {
+		b.min = defaultReconnectInterval
+	}
+	if b.max <= 0 {
+		b.max = defaultReconnectMaxInterval
+	}
+	if b.max < b.min {
+		b.max = b.min
+	}
+	return b
+}
+
+// reconnectWait waits before the next attempt to reach the docker daemon
+// of host. It returns false when docker-gen is stopped meanwhile or when
+// ReconnectAttempts consecutive attempts failed.
+func (g *generator) reconnectWait(b *backoff, host dockerHost) bool {
+	if g.ReconnectAttempts > 0 && b.attempts >= g.ReconnectAttempts {
+		logErrorf("Giving up on docker daemon %s after %d attempts in %s", host.Endpoint, b.attempts, time.Since(b.since).Round(time.Second))
+		return false
+	}
+	delay := b.next(time.Now())
+	logInfof("Retrying docker daemon %s in %s (attempt %d)", host.Endpoint, delay.Round(time.Millisecond), b.attempts)
+	return g.sleep(delay)
+}
+
+// reconnected logs how long reaching the daemon of host again took, and
+// resets the backoff
+func (g *generator) reconnected(b *backoff, host dockerHost) {
+	if b.attempts == 0 {
+		return
+	}
+	logInfof("Reconnected to docker daemon %s after %d attempts in %s", host.Endpoint, b.attempts, time.Since(b.since).Round(time.Second))
+	b.attempts = 0
+}
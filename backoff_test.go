@@ -0,0 +1,44 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := &backoff{min: time.Second, max: 10 * time.Second}
+	now := time.Now()
+	for i, max := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		max *= time.Second
+		delay := b.next(now)
+		if delay < max/2 || delay > max {
+			t.Errorf("attempt %d: expected a delay between %s and %s, got %s", i+1, max/2, max, delay)
+		}
+	}
+	if b.attempts != 6 || !b.since.Equal(now) {
+		t.Errorf("Expected 6 attempts since the first, got %d since %s", b.attempts, b.since)
+	}
+}
+
+func TestReconnectWaitGivesUp(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	g := &generator{ReconnectInterval: time.Millisecond, ReconnectAttempts: 3}
+	b := g.newBackoff()
+	if b.max != defaultReconnectMaxInterval {
+		t.Errorf("Expected the default maximum interval, got %s", b.max)
+	}
+	for i := 0; i < 3; i++ {
+		if !g.reconnectWait(b, dockerHost{}) {
+			t.Fatalf("Expected attempt %d to be retried", i+1)
+		}
+	}
+	if g.reconnectWait(b, dockerHost{}) {
+		t.Error("Expected to give up after 3 attempts")
+	}
+	g.reconnected(b, dockerHost{})
+	if !g.reconnectWait(b, dockerHost{}) {
+		t.Error("Expected the attempts to be reset once reconnected")
+	}
+}
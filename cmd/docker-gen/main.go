@@ -4,9 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	docker "github.com/fsouza/go-dockerclient"
@@ -15,6 +18,8 @@ import (
 
 type stringslice []string
 
+const defaultControlSocket = "/var/run/docker-gen.sock"
+
 var (
 	buildVersion            string
 	version                 bool
@@ -24,19 +29,58 @@ var (
 	notifyOutput            bool
 	notifySigHUPContainerID string
 	notifySigHUPServiceID   string
+	notifyPIDFile           string
+	notifyProcess           string
 	onlyExposed             bool
 	onlyPublished           bool
 	includeStopped          bool
 	configFiles             stringslice
 	configs                 dockergen.ConfigFile
 	interval                int
+	intervalJitter          int
+	intervalAlign           bool
 	keepBlankLines          bool
+	lock                    bool
+	drain                   bool
 	endpoint                string
+	extraEndpoints          stringslice
 	tlsCert                 string
 	tlsKey                  string
 	tlsCaCert               string
 	tlsVerify               bool
 	tlsCertPath             string
+	pingInterval            time.Duration
+	pingTimeout             time.Duration
+	pollInterval            time.Duration
+	destRoot                string
+	maxJobs                 int
+	inspectJobs             int
+	inspectCacheTTL         time.Duration
+	reconnectInterval       time.Duration
+	reconnectMaxInterval    time.Duration
+	reconnectAttempts       int
+	apiTimeout              time.Duration
+	clientOptions           dockergen.DockerClientOptions
+	pprofAddr               string
+	templateTimeout         string
+	notifyTimeout           string
+	controlSocket           string
+	consulAddr              string
+	etcdEndpoint            string
+	etcdPrefix              string
+	vaultAddr               string
+	composeFiles            stringslice
+	publishURL              string
+	httpAddr                string
+	httpToken               string
+	stateFile               string
+	readOnly                bool
+	notifyInterval          time.Duration
+	resyncInterval          time.Duration
+	logLevel                string
+	logFormat               string
+	dryRun                  bool
+	dumpContext             bool
 	wg                      sync.WaitGroup
 )
 
@@ -52,6 +96,8 @@ func (strings *stringslice) Set(value string) error {
 
 func usage() {
 	println(`Usage: docker-gen [options] template [dest]
+       docker-gen [-control-socket path] trigger [-no-notify] config
+       docker-gen test [-keep-blank-lines] dir
 
 Generate files from docker container meta-data
 
@@ -61,13 +107,21 @@ Options:`)
 	println(`
 Arguments:
   template - path to a template to generate
-  dest - path to a write the template.  If not specfied, STDOUT is used`)
+  dest - path to a write the template.  If not specfied, STDOUT is used
+  config - name (or dest) of the config a running instance should regenerate
+  dir - directory of templates (name.tmpl) to render with containers (name.json) and compare with name.expected`)
 
 	println(`
 Environment Variables:
   DOCKER_HOST - default value for -endpoint
   DOCKER_CERT_PATH - directory path containing key.pem, cert.pem and ca.pem
   DOCKER_TLS_VERIFY - enable client TLS verification
+  DOCKER_GEN_HTTP_TOKEN - default value for -http-token
+  CONSUL_HTTP_TOKEN - ACL token used with -consul-addr
+  VAULT_TOKEN - token used with -vault-addr
+  VAULT_ROLE_ID, VAULT_SECRET_ID - AppRole credentials used with -vault-addr when VAULT_TOKEN is not set
+  CLOUDFLARE_API_TOKEN - API token used by configs with dns_provider = "cloudflare"
+  AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN - credentials used by configs with dns_provider = "route53"
 `)
 	println(`For more information, see https://github.com/jwilder/docker-gen`)
 }
@@ -80,6 +134,79 @@ func loadConfig(file string) error {
 	return nil
 }
 
+// reloadConfigs loads the config files again when the generator reloads its
+// configs
+func reloadConfigs() (dockergen.ConfigFile, error) {
+	var reloaded dockergen.ConfigFile
+	for _, configFile := range configFiles {
+		if _, err := toml.DecodeFile(configFile, &reloaded); err != nil {
+			return reloaded, fmt.Errorf("%s: %s", configFile, err)
+		}
+	}
+	if destRoot != "" {
+		if err := reloaded.CheckDestRoot(destRoot); err != nil {
+			return reloaded, err
+		}
+	}
+	return reloaded, nil
+}
+
+// trigger asks a running docker-gen instance to regenerate a config
+func trigger(args []string) {
+	triggerFlags := flag.NewFlagSet("trigger", flag.ExitOnError)
+	noNotify := triggerFlags.Bool("no-notify", false, "regenerate without running notifications")
+	triggerFlags.Parse(args)
+	if triggerFlags.NArg() != 1 {
+		usage()
+		os.Exit(1)
+	}
+
+	socket := controlSocket
+	if socket == "" {
+		socket = defaultControlSocket
+	}
+	if err := dockergen.Trigger(socket, triggerFlags.Arg(0), !*noNotify); err != nil {
+		log.Fatalf("Error triggering %s: %s\n", triggerFlags.Arg(0), err)
+	}
+}
+
+// testTemplates renders the templates of a directory and compares them with
+// their expected output, exiting non-zero on mismatch
+func testTemplates(args []string) {
+	testFlags := flag.NewFlagSet("test", flag.ExitOnError)
+	keepBlankLines := testFlags.Bool("keep-blank-lines", false, "keep blank lines in the rendered output")
+	testFlags.Parse(args)
+	if testFlags.NArg() != 1 {
+		usage()
+		os.Exit(1)
+	}
+
+	passed, err := dockergen.RunTemplateTests(testFlags.Arg(0), *keepBlankLines, os.Stdout)
+	if err != nil {
+		log.Fatalf("Error testing templates: %s\n", err)
+	}
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+// servePprof exposes the runtime profiles of this instance on addr
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		log.Printf("Serving profiles on http://%s/debug/pprof/", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Unable to serve profiles on %s: %s\n", addr, err)
+		}
+	}()
+}
+
 func initFlags() {
 
 	certPath := filepath.Join(os.Getenv("DOCKER_CERT_PATH"))
@@ -87,7 +214,7 @@ func initFlags() {
 		certPath = filepath.Join(os.Getenv("HOME"), ".docker")
 	}
 	flag.BoolVar(&version, "version", false, "show version")
-	flag.BoolVar(&watch, "watch", false, "watch for container changes")
+	flag.BoolVar(&watch, "watch", false, "watch for container and template file changes")
 	flag.StringVar(&wait, "wait", "", "minimum and maximum durations to wait (e.g. \"500ms:2s\") before triggering generate")
 	flag.BoolVar(&onlyExposed, "only-exposed", false, "only include containers with exposed ports")
 
@@ -96,16 +223,58 @@ func initFlags() {
 	flag.BoolVar(&includeStopped, "include-stopped", false, "include stopped containers")
 	flag.BoolVar(&notifyOutput, "notify-output", false, "log the output(stdout/stderr) of notify command")
 	flag.StringVar(&notifyCmd, "notify", "", "run command after template is regenerated (e.g `restart xyz`)")
+	flag.StringVar(&notifyTimeout, "notify-timeout", "", "kill the notify command and the processes it started after this duration (e.g. 30s)")
 	flag.StringVar(&notifySigHUPContainerID, "notify-sighup", "",
 		"send HUP signal to container.  Equivalent to docker kill -s HUP `container-ID`")
 	flag.StringVar(&notifySigHUPServiceID, "service-notify-sighup", "", "send HUP signal to all containers belong to a service.")
+	flag.StringVar(&notifyPIDFile, "notify-pid-file", "", "send HUP signal to the process of this pid file in docker-gen's container or pod, without the docker API")
+	flag.StringVar(&notifyProcess, "notify-process", "", "send HUP signal to the processes of this name (e.g. nginx) in docker-gen's container or pod, without the docker API")
 	flag.Var(&configFiles, "config", "config files with template directives. Config files will be merged if this option is specified multiple times.")
 	flag.IntVar(&interval, "interval", 0, "notify command interval (secs)")
+	flag.IntVar(&intervalJitter, "interval-jitter", 0, "maximum random delay (secs) added to each interval")
+	flag.BoolVar(&intervalAlign, "interval-align", false, "align intervals to wall clock multiples of -interval")
 	flag.BoolVar(&keepBlankLines, "keep-blank-lines", false, "keep blank lines in the output file")
+	flag.BoolVar(&drain, "drain", false, "generate and notify a last time with .Draining set when stopped by SIGTERM")
+	flag.BoolVar(&lock, "lock", false, "lock dest so no other docker-gen instance can write to it")
+	flag.BoolVar(&dumpContext, "dump-context", false, "print the containers templates are rendered with as JSON and exit")
+	flag.BoolVar(&dryRun, "dry-run", false, "render the templates once and print how their dest files would change, without writing them or running notifications. Exits 1 if any would change")
+	flag.StringVar(&destRoot, "dest-root", "", "reject configs whose dest, once symlinks are resolved, is outside this directory (e.g. /etc/generated); fan_out dests are checked once rendered")
 	flag.StringVar(&endpoint, "endpoint", "", "docker api endpoint (tcp|unix://..). Default unix:///var/run/docker.sock")
+	flag.Var(&extraEndpoints, "extra-endpoint", "additional docker api endpoint whose containers are merged into the template context. Can be specified multiple times.")
 	flag.StringVar(&tlsCert, "tlscert", filepath.Join(certPath, "cert.pem"), "path to TLS client certificate file")
 	flag.StringVar(&tlsKey, "tlskey", filepath.Join(certPath, "key.pem"), "path to TLS client key file")
 	flag.StringVar(&tlsCaCert, "tlscacert", filepath.Join(certPath, "ca.pem"), "path to TLS CA certificate file")
+	flag.DurationVar(&pingInterval, "ping-interval", 10*time.Second, "how often to check the docker daemon's liveness while no events arrive")
+	flag.DurationVar(&pingTimeout, "ping-timeout", 5*time.Second, "maximum duration of a docker daemon liveness check")
+	flag.DurationVar(&apiTimeout, "api-timeout", 30*time.Second, "maximum duration of each docker API call listing or inspecting containers (0 to disable)")
+	flag.DurationVar(&clientOptions.DialTimeout, "dial-timeout", 0, "maximum duration of connecting to the docker daemon (default 30s for tcp endpoints)")
+	flag.DurationVar(&clientOptions.ResponseHeaderTimeout, "response-header-timeout", 0, "maximum duration of waiting for the headers of a docker API response")
+	flag.DurationVar(&clientOptions.KeepAlive, "keep-alive", 0, "TCP keep-alive period of docker daemon connections")
+	flag.IntVar(&clientOptions.MaxIdleConns, "max-idle-conns", 0, "reuse up to this many idle docker daemon connections (default none)")
+	flag.IntVar(&maxJobs, "max-jobs", 4, "maximum number of configs generated concurrently on intervals, docker events and signals")
+	flag.IntVar(&inspectJobs, "inspect-jobs", 8, "maximum number of containers inspected concurrently")
+	flag.DurationVar(&inspectCacheTTL, "inspect-cache-ttl", 5*time.Minute, "reuse container inspections until an event of the container arrives, for at most this duration (0 to disable)")
+	flag.DurationVar(&reconnectInterval, "reconnect-interval", time.Second, "first wait before reconnecting to the docker daemon, doubled after each failed attempt")
+	flag.DurationVar(&reconnectMaxInterval, "reconnect-max-interval", time.Minute, "maximum wait between attempts to reconnect to the docker daemon")
+	flag.IntVar(&reconnectAttempts, "reconnect-attempts", 0, "stop watching docker events after this many consecutive failed reconnection attempts (0 to retry forever)")
+	flag.DurationVar(&pollInterval, "poll", 0, "list containers at this interval (e.g. 5s) instead of watching docker events, for API proxies blocking the events endpoint")
+	flag.StringVar(&controlSocket, "control-socket", "", "listen for trigger commands on this unix socket (trigger default "+defaultControlSocket+")")
+	flag.StringVar(&consulAddr, "consul-addr", "", "address of a Consul agent (e.g. http://127.0.0.1:8500) whose catalog is available to templates")
+	flag.StringVar(&etcdEndpoint, "etcd-endpoint", "", "address of an etcd v3 server (e.g. http://127.0.0.1:2379) whose keys are available to templates")
+	flag.StringVar(&etcdPrefix, "etcd-prefix", "/", "prefix of the etcd keys available to templates")
+	flag.StringVar(&vaultAddr, "vault-addr", "", "address of a Vault server (e.g. https://vault:8200) enabling the vaultSecret template function")
+	flag.Var(&composeFiles, "compose-file", "docker-compose file whose projects are available to templates. Can be specified multiple times.")
+	flag.StringVar(&httpAddr, "http-addr", "", "listen address (e.g. :8080) of the HTTP endpoints")
+	flag.StringVar(&httpToken, "http-token", os.Getenv("DOCKER_GEN_HTTP_TOKEN"), "bearer token required by the HTTP /regenerate endpoint")
+	flag.StringVar(&stateFile, "state-file", "", "write the state of docker-gen to this file on SIGUSR1 instead of logging it")
+	flag.DurationVar(&resyncInterval, "resync-interval", 0, "update the containers from their docker events instead of listing all of them on each event, and list them every this duration (e.g. 5m); for large hosts")
+	flag.DurationVar(&notifyInterval, "notify-interval", 0, "minimum interval between the notifications of all configs (e.g. 10s); notifications inside it are delayed and coalesced")
+	flag.BoolVar(&readOnly, "read-only", false, "only use read docker API calls, e.g. behind a docker socket proxy; fails if a config signals, execs in or restarts containers or services")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum level of the logged messages: debug, info, warn or error")
+	flag.StringVar(&logFormat, "log-format", "text", "format of the logged messages: text or json (one object per line)")
+	flag.StringVar(&templateTimeout, "template-timeout", "", "abort the template execution after this duration (e.g. 10s), leaving dest unchanged")
+	flag.StringVar(&pprofAddr, "pprof-addr", "", "listen address (e.g. localhost:6060) of the net/http/pprof profiling endpoints")
+	flag.StringVar(&publishURL, "publish-url", "", "publish an event after each generation to a NATS subject (nats://host:4222/subject) or MQTT topic (mqtt://host:1883/topic)")
 	flag.BoolVar(&tlsVerify, "tlsverify", os.Getenv("DOCKER_TLS_VERIFY") != "", "verify docker daemon's TLS certicate")
 
 	flag.Usage = usage
@@ -120,7 +289,21 @@ func main() {
 		return
 	}
 
-	if flag.NArg() < 1 && len(configFiles) == 0 {
+	if buildVersion != "" {
+		dockergen.Version = buildVersion
+	}
+
+	if flag.Arg(0) == "test" {
+		testTemplates(flag.Args()[1:])
+		return
+	}
+
+	if flag.Arg(0) == "trigger" {
+		trigger(flag.Args()[1:])
+		return
+	}
+
+	if flag.NArg() < 1 && len(configFiles) == 0 && !dumpContext {
 		usage()
 		os.Exit(1)
 	}
@@ -150,7 +333,15 @@ func main() {
 			OnlyPublished:    onlyPublished,
 			IncludeStopped:   includeStopped,
 			Interval:         interval,
+			IntervalJitter:   intervalJitter,
+			IntervalAlign:    intervalAlign,
 			KeepBlankLines:   keepBlankLines,
+			Lock:             lock,
+			Drain:            drain,
+			TemplateTimeout:  templateTimeout,
+			NotifyTimeout:    notifyTimeout,
+			NotifyPIDFile:    notifyPIDFile,
+			NotifyProcess:    notifyProcess,
 		}
 		if notifySigHUPContainerID != "" {
 			config.NotifyContainers[notifySigHUPContainerID] = docker.SIGHUP
@@ -162,6 +353,12 @@ func main() {
 			Config: []dockergen.Config{config}}
 	}
 
+	if destRoot != "" {
+		if err := configs.CheckDestRoot(destRoot); err != nil {
+			log.Fatalf("Error checking configs: %s", err)
+		}
+	}
+
 	all := true
 	for _, config := range configs.Config {
 		if config.IncludeStopped {
@@ -169,20 +366,77 @@ func main() {
 		}
 	}
 
+	var reloadConfig func() (dockergen.ConfigFile, error)
+	if len(configFiles) > 0 {
+		reloadConfig = reloadConfigs
+	}
+
+	if pprofAddr != "" {
+		servePprof(pprofAddr)
+	}
+
 	generator, err := dockergen.NewGenerator(dockergen.GeneratorConfig{
-		Endpoint:   endpoint,
-		TLSKey:     tlsKey,
-		TLSCert:    tlsCert,
-		TLSCACert:  tlsCaCert,
-		TLSVerify:  tlsVerify,
-		All:        all,
-		ConfigFile: configs,
+		Endpoint:             endpoint,
+		Endpoints:            extraEndpoints,
+		TLSKey:               tlsKey,
+		TLSCert:              tlsCert,
+		TLSCACert:            tlsCaCert,
+		TLSVerify:            tlsVerify,
+		All:                  all,
+		PingInterval:         pingInterval,
+		PingTimeout:          pingTimeout,
+		PollInterval:         pollInterval,
+		MaxJobs:              maxJobs,
+		InspectJobs:          inspectJobs,
+		InspectCacheTTL:      inspectCacheTTL,
+		ReconnectInterval:    reconnectInterval,
+		ReconnectMaxInterval: reconnectMaxInterval,
+		ReconnectAttempts:    reconnectAttempts,
+		ClientOptions:        clientOptions,
+		APITimeout:           apiTimeout,
+		ControlSocket:        controlSocket,
+		ConsulAddr:           consulAddr,
+		EtcdEndpoint:         etcdEndpoint,
+		EtcdPrefix:           etcdPrefix,
+		VaultAddr:            vaultAddr,
+		ComposeFiles:         composeFiles,
+		PublishURL:           publishURL,
+		HTTPAddr:             httpAddr,
+		HTTPToken:            httpToken,
+		StateFile:            stateFile,
+		ReadOnly:             readOnly,
+		DestRoot:             destRoot,
+		NotifyInterval:       notifyInterval,
+		ResyncInterval:       resyncInterval,
+		LogLevel:             logLevel,
+		LogFormat:            logFormat,
+		ConfigFile:           configs,
+		ConfigFiles:          configFiles,
+		ReloadConfig:         reloadConfig,
 	})
 
 	if err != nil {
 		log.Fatalf("Error creating generator: %v", err)
 	}
 
+	if dumpContext {
+		if err := generator.DumpContext(os.Stdout); err != nil {
+			log.Fatalf("Error dumping context: %v", err)
+		}
+		return
+	}
+
+	if dryRun {
+		changed, err := generator.DryRun(os.Stdout)
+		if err != nil {
+			log.Fatalf("Error running dry run: %v", err)
+		}
+		if changed {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := generator.Generate(); err != nil {
 		log.Fatalf("Error running generate: %v", err)
 	}
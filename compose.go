@@ -0,0 +1,236 @@
+package dockergen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ComposeProject is a project declared in a docker-compose file
+type ComposeProject struct {
+	Name     string
+	File     string
+	Services []ComposeService
+}
+
+// ComposeService is a service declared in a docker-compose file
+type ComposeService struct {
+	Name          string
+	Image         string
+	ContainerName string
+	Replicas      int
+	DependsOn     []string
+	Labels        map[string]string
+	Environment   map[string]string
+	Ports         []string
+}
+
+var (
+	composeMu       sync.RWMutex
+	composeProjects []ComposeProject
+)
+
+// ComposeProjects returns the projects declared in the docker-compose files
+// docker-gen is configured with, including services that are not running
+func (c *Context) ComposeProjects() []ComposeProject {
+	composeMu.RLock()
+	defer composeMu.RUnlock()
+	return composeProjects
+}
+
+// ComposeContainer is what the com.docker.compose.* labels of a container
+// started by docker-compose tell about it
+type ComposeContainer struct {
+	Project         string
+	Service         string
+	ContainerNumber int  // replica number within the service, from 1
+	OneOff          bool // started by docker-compose run
+	WorkingDir      string
+	ConfigFiles     []string
+}
+
+// newComposeContainer parses the compose labels of a container; all fields
+// are empty for containers not started by docker-compose
+func newComposeContainer(labels map[string]string) ComposeContainer {
+	compose := ComposeContainer{
+		Project:    labels["com.docker.compose.project"],
+		Service:    labels["com.docker.compose.service"],
+		OneOff:     labels["com.docker.compose.oneoff"] == "True",
+		WorkingDir: labels["com.docker.compose.project.working_dir"],
+	}
+	compose.ContainerNumber, _ = strconv.Atoi(labels["com.docker.compose.container-number"])
+	if files := labels["com.docker.compose.project.config_files"]; files != "" {
+		compose.ConfigFiles = strings.Split(files, ",")
+	}
+	return compose
+}
+
+func groupByCompose(funcName string, entries interface{}, field func(ComposeContainer) string) (map[string][]interface{}, error) {
+	getValue := func(v interface{}) (interface{}, error) {
+		container, ok := v.(RuntimeContainer)
+		if !ok {
+			return nil, fmt.Errorf("Must pass an array or slice of RuntimeContainer to '%s'; received %v", funcName, v)
+		}
+		if value := field(container.Compose); value != "" {
+			return value, nil
+		}
+		return nil, nil
+	}
+	return generalizedGroupBy(funcName, entries, getValue, func(groups map[string][]interface{}, value interface{}, v interface{}) {
+		groups[value.(string)] = append(groups[value.(string)], v)
+	})
+}
+
+// groupByComposeProject groups the containers started by docker-compose by
+// project
+func groupByComposeProject(entries interface{}) (map[string][]interface{}, error) {
+	return groupByCompose("groupByComposeProject", entries, func(c ComposeContainer) string { return c.Project })
+}
+
+// groupByComposeService groups the containers started by docker-compose by
+// service name. Services of different projects may share a name; group by
+// project first to keep them apart.
+func groupByComposeService(entries interface{}) (map[string][]interface{}, error) {
+	return groupByCompose("groupByComposeService", entries, func(c ComposeContainer) string { return c.Service })
+}
+
+// composeFile is the subset of the docker-compose file format docker-gen uses
+type composeFile struct {
+	Name     string `yaml:"name"`
+	Services map[string]struct {
+		Image         string        `yaml:"image"`
+		ContainerName string        `yaml:"container_name"`
+		Scale         int           `yaml:"scale"`
+		DependsOn     interface{}   `yaml:"depends_on"`
+		Labels        interface{}   `yaml:"labels"`
+		Environment   interface{}   `yaml:"environment"`
+		Ports         []interface{} `yaml:"ports"`
+		Deploy        struct {
+			Replicas *int `yaml:"replicas"`
+		} `yaml:"deploy"`
+	} `yaml:"services"`
+}
+
+var composeProjectNameRegexp = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// parseComposeFile reads the projects services from a docker-compose file.
+// Without a top-level name, the project is named after the file's directory
+// like docker-compose does.
+func parseComposeFile(path string) (ComposeProject, error) {
+	project := ComposeProject{File: path, Services: []ComposeService{}}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return project, err
+	}
+	var file composeFile
+	if err := yaml.Unmarshal(buf, &file); err != nil {
+		return project, fmt.Errorf("Unable to parse compose file %s: %s", path, err)
+	}
+
+	project.Name = file.Name
+	if project.Name == "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return project, err
+		}
+		project.Name = composeProjectNameRegexp.ReplaceAllString(strings.ToLower(filepath.Base(filepath.Dir(abs))), "")
+	}
+
+	for name, svc := range file.Services {
+		service := ComposeService{
+			Name:          name,
+			Image:         svc.Image,
+			ContainerName: svc.ContainerName,
+			Replicas:      1,
+			DependsOn:     composeList(svc.DependsOn),
+			Labels:        composeMap(svc.Labels),
+			Environment:   composeMap(svc.Environment),
+			Ports:         []string{},
+		}
+		if svc.Deploy.Replicas != nil {
+			service.Replicas = *svc.Deploy.Replicas
+		} else if svc.Scale > 0 {
+			service.Replicas = svc.Scale
+		}
+		for _, port := range svc.Ports {
+			if long, ok := port.(map[interface{}]interface{}); ok {
+				port = fmt.Sprintf("%v:%v", long["published"], long["target"])
+			}
+			service.Ports = append(service.Ports, fmt.Sprint(port))
+		}
+		project.Services = append(project.Services, service)
+	}
+	sort.Slice(project.Services, func(i, j int) bool {
+		return project.Services[i].Name < project.Services[j].Name
+	})
+	return project, nil
+}
+
+// composeList returns the entries of a list or the keys of a map, as used
+// by depends_on
+func composeList(value interface{}) []string {
+	ret := []string{}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			ret = append(ret, fmt.Sprint(item))
+		}
+	case map[interface{}]interface{}:
+		for key := range v {
+			ret = append(ret, fmt.Sprint(key))
+		}
+		sort.Strings(ret)
+	}
+	return ret
+}
+
+// composeMap returns the entries of a KEY=VALUE list or a map, as used by
+// labels and environment
+func composeMap(value interface{}) map[string]string {
+	ret := make(map[string]string)
+	switch v := value.(type) {
+	case []interface{}:
+		entries := make([]string, 0, len(v))
+		for _, item := range v {
+			entries = append(entries, fmt.Sprint(item))
+		}
+		ret = splitKeyValueSlice(entries)
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			if item == nil {
+				ret[fmt.Sprint(key)] = ""
+			} else {
+				ret[fmt.Sprint(key)] = fmt.Sprint(item)
+			}
+		}
+	}
+	return ret
+}
+
+// loadComposeProjects parses the docker-compose files and returns the errors
+// of those that couldn't be read
+func loadComposeProjects(paths []string) []error {
+	projects := []ComposeProject{}
+	errs := []error{}
+	for _, path := range paths {
+		project, err := parseComposeFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		projects = append(projects, project)
+	}
+
+	composeMu.Lock()
+	composeProjects = projects
+	composeMu.Unlock()
+	return errs
+}
@@ -0,0 +1,146 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testComposeFile = `
+version: "3"
+services:
+  web:
+    image: nginx
+    depends_on:
+      - app
+    labels:
+      - "VIRTUAL_HOST=example.com"
+    ports:
+      - "80:80"
+      - published: 443
+        target: 443
+  app:
+    image: example/app
+    depends_on:
+      db:
+        condition: service_healthy
+    environment:
+      MODE: production
+    deploy:
+      replicas: 3
+  db:
+    image: postgres
+    scale: 2
+`
+
+func TestParseComposeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "My-Project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "docker-compose.yml")
+	if err := ioutil.WriteFile(path, []byte(testComposeFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := parseComposeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "my-project" + strings.TrimPrefix(filepath.Base(dir), "My-Project"); project.Name != expected {
+		t.Errorf("expected: %s. got: %s", expected, project.Name)
+	}
+	if len(project.Services) != 3 {
+		t.Fatalf("expected 3 services. got: %d", len(project.Services))
+	}
+
+	app, db, web := project.Services[0], project.Services[1], project.Services[2]
+	if app.Name != "app" || app.Replicas != 3 || !reflect.DeepEqual(app.DependsOn, []string{"db"}) {
+		t.Errorf("unexpected app service: %+v", app)
+	}
+	if app.Environment["MODE"] != "production" {
+		t.Errorf("unexpected app environment: %v", app.Environment)
+	}
+	if db.Name != "db" || db.Replicas != 2 || len(db.DependsOn) != 0 {
+		t.Errorf("unexpected db service: %+v", db)
+	}
+	if web.Image != "nginx" || web.Replicas != 1 || web.Labels["VIRTUAL_HOST"] != "example.com" {
+		t.Errorf("unexpected web service: %+v", web)
+	}
+	if !reflect.DeepEqual(web.Ports, []string{"80:80", "443:443"}) {
+		t.Errorf("unexpected web ports: %v", web.Ports)
+	}
+}
+
+func TestLoadComposeProjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "docker-compose.yml")
+	if err := ioutil.WriteFile(path, []byte("name: shop\nservices:\n  web:\n    image: nginx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := loadComposeProjects([]string{path, filepath.Join(dir, "missing.yml")})
+	defer loadComposeProjects(nil)
+	if len(errs) != 1 {
+		t.Errorf("expected 1 error. got: %v", errs)
+	}
+
+	tests := templateTestList{
+		{`{{range .ComposeProjects}}{{.Name}}:{{range .Services}}{{.Name}}x{{.Replicas}}{{end}}{{end}}`, &Context{}, `shop:webx1`},
+	}
+	tests.run(t, "composeProjects")
+}
+
+func TestGroupByComposeService(t *testing.T) {
+	composeLabels := func(project, service, number string) map[string]string {
+		return map[string]string{
+			"com.docker.compose.project":          project,
+			"com.docker.compose.service":          service,
+			"com.docker.compose.container-number": number,
+		}
+	}
+	containers := []*RuntimeContainer{}
+	for _, labels := range []map[string]string{
+		composeLabels("shop", "web", "1"),
+		composeLabels("shop", "web", "2"),
+		composeLabels("blog", "web", "1"),
+		composeLabels("shop", "db", "1"),
+		{"other": "label"},
+	} {
+		containers = append(containers, &RuntimeContainer{Labels: labels, Compose: newComposeContainer(labels)})
+	}
+	if !reflect.DeepEqual(containers[1].Compose, ComposeContainer{Project: "shop", Service: "web", ContainerNumber: 2}) {
+		t.Errorf("Unexpected compose fields %+v", containers[1].Compose)
+	}
+
+	projects, err := groupByComposeProject(containers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 2 || len(projects["shop"]) != 3 || len(projects["blog"]) != 1 {
+		t.Fatalf("Unexpected projects %v", projects)
+	}
+	services, err := groupByComposeService(projects["shop"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 || len(services["web"]) != 2 || len(services["db"]) != 1 {
+		t.Fatalf("Unexpected services %v", services)
+	}
+	if services["web"][1].(RuntimeContainer).Compose.ContainerNumber != 2 {
+		t.Errorf("Expected the replicas in container order, got %v", services["web"])
+	}
+	if _, err := groupByComposeService([]string{"web"}); err == nil {
+		t.Error("Expected an error for entries that are not containers")
+	}
+}
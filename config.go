@@ -2,6 +2,11 @@ package dockergen
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -9,23 +14,381 @@ import (
 )
 
 type Config struct {
-	Template         string
-	Dest             string
-	Watch            bool
-	Wait             *Wait
-	NotifyCmd        string
-	NotifyOutput     bool
-	NotifyContainers map[string]docker.Signal
-	NotifyServices   map[string]docker.Signal
-	OnlyExposed      bool
-	OnlyPublished    bool
-	IncludeStopped   bool
-	Interval         int
-	KeepBlankLines   bool
+	Name                 string
+	Template             string
+	Dest                 string
+	Watch                bool
+	Wait                 *Wait
+	NotifyCmd            string
+	NotifyOutput         bool
+	OnErrorCmd           string `toml:"on_error_cmd"`
+	NotifyContainers     map[string]docker.Signal
+	NotifyContainersExec map[string][]string `toml:"notify_containers_exec"`
+	NotifyServices       map[string]docker.Signal
+	// NotifyContainersFiltered signals the containers matching selectors
+	// of docker ps filters, e.g. "label=com.example.role=proxy"
+	NotifyContainersFiltered map[string]docker.Signal `toml:"notify_containers_filtered"`
+	// NotifyPIDFile and NotifyProcess are processes of docker-gen's own
+	// container or pod signalled with NotifySignal without the docker API,
+	// for sidecars without write access to it
+	NotifyPIDFile string `toml:"notify_pid_file"`
+	NotifyProcess string `toml:"notify_process"`
+	NotifySignal  string `toml:"notify_signal"`
+	// NotifyContainersRestart and NotifyServicesRestart are restarted
+	// instead of signalled
+	NotifyContainersRestart []string    `toml:"notify_containers_restart"`
+	NotifyServicesRestart   []string    `toml:"notify_services_restart"`
+	NotifyHTTP              *NotifyHTTP `toml:"notify_http"`
+	OnlyExposed             bool
+	OnlyPublished           bool
+	IncludeStopped          bool
+	Interval                int
+	IntervalJitter          int  `toml:"interval_jitter"`
+	IntervalAlign           bool `toml:"interval_align"`
+	KeepBlankLines          bool
+	PartialFailure          string `toml:"partial_failure"`
+	Lock                    bool
+	Mkdirs                  bool
+	MkdirsMode              string   `toml:"mkdirs_mode"`
+	DNSProvider             string   `toml:"dns_provider"`
+	DNSZone                 string   `toml:"dns_zone"`
+	DNSTarget               string   `toml:"dns_target"`
+	DNSHostEnv              string   `toml:"dns_host_env"`
+	DNSTTL                  int      `toml:"dns_ttl"`
+	WatchPaths              []string `toml:"watch_paths"`
+	TemplateTimeout         string   `toml:"template_timeout"`
+	NotifyTimeout           string   `toml:"notify_timeout"`
+	NotifyInterval          string   `toml:"notify_interval"`
+	Stream                  bool
+	LabelFilters            []string                     `toml:"label_filters"`
+	NameFilters             []string                     `toml:"name_filters"`
+	AllowFuncs              []string                     `toml:"allow_funcs"`
+	DenyFuncs               []string                     `toml:"deny_funcs"`
+	Plugins                 map[string]map[string]string `toml:"plugins"`
+	Header                  bool
+	Sprig                   bool
+	Engine                  string
+	Drain                   bool
+	HeaderComment           string `toml:"header_comment"`
+	HealthEvents            bool   `toml:"health_events"`
+	NetworkEvents           bool   `toml:"network_events"`
+	VolumeEvents            bool   `toml:"volume_events"`
+	FanOut                  string `toml:"fan_out"`
+
+	// Mode, Uid and Gid are the permissions and owner of dest. Unset, dest
+	// keeps those of the file it replaces.
+	Mode string `toml:"mode"`
+	Uid  *int   `toml:"uid"`
+	Gid  *int   `toml:"gid"`
+
+	// KeepBackups is how many previous versions of dest are kept as
+	// dest.1, dest.2, ... before it is replaced
+	KeepBackups int `toml:"keep_backups"`
+
+	// ValidateCmd checks the rendered file before it replaces dest, e.g.
+	// "nginx -t -c {{ .TempFile }}"
+	ValidateCmd string `toml:"validate_cmd"`
+	// ValidateTimeout kills ValidateCmd after this duration, by default
+	// NotifyTimeout
+	ValidateTimeout string `toml:"validate_timeout"`
+
+	// Debounce is how Wait coalesces events: DebounceTrailing (default),
+	// DebounceLeading or DebounceQuiet. DebounceBatch generates the config
+	// once this many events are waiting.
+	Debounce      string `toml:"debounce"`
+	DebounceBatch int    `toml:"debounce_batch"`
+
+	// Stats samples the CPU and memory usage of the config's running
+	// containers, at most every StatsInterval and waiting up to StatsTimeout
+	// for each container
+	Stats         bool   `toml:"stats"`
+	StatsInterval string `toml:"stats_interval"`
+	StatsTimeout  string `toml:"stats_timeout"`
+
+	// Endpoint is the docker daemon the config is rendered from instead of
+	// the -endpoint daemons, connected with its own TLS settings
+	Endpoint  string `toml:"endpoint"`
+	TLSCert   string `toml:"tls_cert"`
+	TLSKey    string `toml:"tls_key"`
+	TLSCACert string `toml:"tls_ca_cert"`
+	TLSVerify bool   `toml:"tls_verify"`
+
+	// Filters are docker's ListContainers filters, e.g. status, network or
+	// name, applied by dockerd to the containers of this config
+	Filters map[string][]string `toml:"filters"`
+
+	// trigger is why the config is generated, as mentioned in its header
+	trigger string
+	// triggerEvents are the docker events that triggered the generation
+	triggerEvents []TriggerEvent
+	// contextErrors are the errors retrieving the container meta-data the
+	// config is generated from
+	contextErrors []string
+	// draining is set for the last generation on SIGTERM
+	draining bool
+}
+
+// Policies for generating a config while some container meta-data could not
+// be retrieved
+const (
+	// PartialFailureRender renders and notifies with the partial data (default)
+	PartialFailureRender = "render"
+	// PartialFailureSkip skips the generation until the data is complete
+	PartialFailureSkip = "skip"
+	// PartialFailureNoNotify renders with the partial data but skips notifications
+	PartialFailureNoNotify = "no-notify"
+)
+
+// PartialFailureMode returns the policy of the config for generating while
+// some container meta-data could not be retrieved
+func (c *Config) PartialFailureMode() (string, error) {
+	switch c.PartialFailure {
+	case "", PartialFailureRender:
+		return PartialFailureRender, nil
+	case PartialFailureSkip, PartialFailureNoNotify:
+		return c.PartialFailure, nil
+	}
+	return PartialFailureRender, fmt.Errorf("Invalid partial_failure %q: must be %q, %q or %q", c.PartialFailure, PartialFailureRender, PartialFailureSkip, PartialFailureNoNotify)
+}
+
+// Debounce strategies of watching configs with a wait
+const (
+	// DebounceTrailing generates min after the last event, and max after the
+	// first at the latest (default)
+	DebounceTrailing = "trailing"
+	// DebounceLeading generates on the first event right away, then at most
+	// once per min with the events received meanwhile
+	DebounceLeading = "leading"
+	// DebounceQuiet generates once no event arrived for min, however long
+	// the burst lasts
+	DebounceQuiet = "quiet"
+)
+
+// Template engines
+const (
+	// EngineGo renders templates with text/template (default)
+	EngineGo = "go"
+	// EnginePongo2 renders Jinja2-like templates with pongo2
+	EnginePongo2 = "pongo2"
+)
+
+// DestDirMode returns the permissions of created destination directories
+func (c *Config) DestDirMode() (os.FileMode, error) {
+	if c.MkdirsMode == "" {
+		return 0755, nil
+	}
+	mode, err := strconv.ParseUint(c.MkdirsMode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid mkdirs_mode %q: must be an octal file mode", c.MkdirsMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// DestMode returns the permissions of dest set by mode, 0 when unset
+func (c *Config) DestMode() (os.FileMode, error) {
+	if c.Mode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("Invalid mode %q: must be an octal file mode such as \"0644\"", c.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// DestOwner returns the uid and gid of dest, -1 for those not set
+func (c *Config) DestOwner() (uid, gid int) {
+	uid, gid = -1, -1
+	if c.Uid != nil {
+		uid = *c.Uid
+	}
+	if c.Gid != nil {
+		gid = *c.Gid
+	}
+	return uid, gid
+}
+
+// allowsFunc returns whether allow_funcs and deny_funcs permit the template
+// function name
+func (c *Config) allowsFunc(name string) bool {
+	for _, denied := range c.DenyFuncs {
+		if name == denied {
+			return false
+		}
+	}
+	if len(c.AllowFuncs) == 0 || builtinFuncs[name] {
+		return true
+	}
+	for _, allowed := range c.AllowFuncs {
+		if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// HeaderCommentLine returns line commented with the config's header_comment,
+// either a prefix such as "#" (default) or a format such as "<!-- %s -->"
+func (c *Config) HeaderCommentLine(line string) string {
+	comment := c.HeaderComment
+	if comment == "" {
+		comment = "#"
+	}
+	if strings.Contains(comment, "%s") {
+		return strings.Replace(comment, "%s", line, 1)
+	}
+	return comment + " " + line
+}
+
+// TemplateDeadline returns how long the template may take to execute, 0 if
+// unbounded
+func (c *Config) TemplateDeadline() (time.Duration, error) {
+	if c.TemplateTimeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(c.TemplateTimeout)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("Invalid template_timeout %q: must be a duration such as \"10s\"", c.TemplateTimeout)
+	}
+	return timeout, nil
+}
+
+// NotifyDeadline returns how long the notify command may run, 0 meaning
+// without limit
+func (c *Config) NotifyDeadline() (time.Duration, error) {
+	if c.NotifyTimeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(c.NotifyTimeout)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("Invalid notify_timeout %q: must be a duration such as \"30s\"", c.NotifyTimeout)
+	}
+	return timeout, nil
+}
+
+// ValidateDeadline returns how long the validate command may run, 0 for no
+// limit. Without validate_timeout, notify_timeout applies.
+func (c *Config) ValidateDeadline() (time.Duration, error) {
+	if c.ValidateTimeout == "" {
+		return c.NotifyDeadline()
+	}
+	timeout, err := time.ParseDuration(c.ValidateTimeout)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("Invalid validate_timeout %q: must be a duration such as \"30s\"", c.ValidateTimeout)
+	}
+	return timeout, nil
+}
+
+// NotifyMinInterval returns the minimum interval between notifications of
+// the config, 0 if they aren't limited
+func (c *Config) NotifyMinInterval() (time.Duration, error) {
+	if c.NotifyInterval == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(c.NotifyInterval)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("Invalid notify_interval %q: must be a duration such as \"10s\"", c.NotifyInterval)
+	}
+	return interval, nil
+}
+
+// DebounceStrategy returns how the config's wait coalesces events
+func (c *Config) DebounceStrategy() (string, error) {
+	switch c.Debounce {
+	case "", DebounceTrailing:
+		return DebounceTrailing, nil
+	case DebounceLeading, DebounceQuiet:
+		return c.Debounce, nil
+	}
+	return DebounceTrailing, fmt.Errorf("Invalid debounce %q: must be %q, %q or %q", c.Debounce, DebounceTrailing, DebounceLeading, DebounceQuiet)
+}
+
+// WantsEvent returns whether the config is regenerated by events of the
+// host, type and action of event: events only regenerate the configs
+// rendered from their docker daemon, and health_status, network and volume
+// events only the configs opting in to them
+func (c *Config) WantsEvent(event TriggerEvent) bool {
+	switch {
+	case !c.Watch || !c.rendersHost(event.Host, event.configOnly):
+		return false
+	case event.Type == "network":
+		return c.NetworkEvents
+	case event.Type == "volume":
+		return c.VolumeEvents
+	case isHealthEvent(event.Action):
+		return c.HealthEvents
+	}
+	return true
+}
+
+// Defaults of stats_interval and stats_timeout
+const (
+	defaultStatsInterval = 30 * time.Second
+	defaultStatsTimeout  = 5 * time.Second
+)
+
+// StatsDeadlines returns how long container stats samples are reused and how
+// long sampling a container may take
+func (c *Config) StatsDeadlines() (time.Duration, time.Duration, error) {
+	interval, timeout := defaultStatsInterval, defaultStatsTimeout
+	var err error
+	if c.StatsInterval != "" {
+		if interval, err = time.ParseDuration(c.StatsInterval); err != nil || interval < 0 {
+			return 0, 0, fmt.Errorf("Invalid stats_interval %q: must be a duration such as \"30s\"", c.StatsInterval)
+		}
+	}
+	if c.StatsTimeout != "" {
+		if timeout, err = time.ParseDuration(c.StatsTimeout); err != nil || timeout <= 0 {
+			return 0, 0, fmt.Errorf("Invalid stats_timeout %q: must be a duration such as \"5s\"", c.StatsTimeout)
+		}
+	}
+	return interval, timeout, nil
+}
+
+// MatchesLabels returns whether labels satisfy all of the config's label
+// filters, each either "key" or "key=value" as in docker's label filter
+func (c *Config) MatchesLabels(labels map[string]string) bool {
+	for _, filter := range c.LabelFilters {
+		parts := strings.SplitN(filter, "=", 2)
+		value, ok := labels[parts[0]]
+		if !ok || (len(parts) == 2 && value != parts[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesName returns whether the container name matches one of the config's
+// name filters, shell patterns such as "web-*". Without name filters, all
+// names match.
+func (c *Config) MatchesName(name string) bool {
+	if len(c.NameFilters) == 0 {
+		return true
+	}
+	name = strings.TrimPrefix(name, "/")
+	for _, filter := range c.NameFilters {
+		if matched, _ := path.Match(filter, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesEvent returns whether a docker event concerns a container matching
+// the config's label and name filters. Events without attributes, such as
+// those synthesized when polling, and network and volume events always match.
+func (c *Config) MatchesEvent(event TriggerEvent) bool {
+	if len(event.Attributes) == 0 || event.Type != "container" {
+		return true
+	}
+	// docker adds the labels of the container to the event's attributes
+	return c.MatchesLabels(event.Attributes) && c.MatchesName(event.Attributes["name"])
 }
 
 type ConfigFile struct {
 	Config []Config
+	Plugin []PluginConfig
+	Func   []FuncConfig
 }
 
 func (c *ConfigFile) FilterWatches() ConfigFile {
@@ -41,6 +404,94 @@ func (c *ConfigFile) FilterWatches() ConfigFile {
 	}
 }
 
+// LabelFilters returns the label filters shared by all configs, which can be
+// applied by dockerd when listing containers. Containers only matching the
+// filters of some configs are filtered by docker-gen.
+func (c *ConfigFile) LabelFilters() []string {
+	if len(c.Config) == 0 {
+		return nil
+	}
+	shared := []string{}
+	for _, filter := range c.Config[0].LabelFilters {
+		inAll := true
+		for _, config := range c.Config[1:] {
+			found := false
+			for _, f := range config.LabelFilters {
+				if f == filter {
+					found = true
+					break
+				}
+			}
+			if !found {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			shared = append(shared, filter)
+		}
+	}
+	return shared
+}
+
+// CheckDestRoot returns an error if the dest of a config is outside root
+// once symlinks are resolved. Configs writing to stdout are allowed. The
+// dests of fan_out configs are templates, checked once rendered.
+func (c *ConfigFile) CheckDestRoot(root string) error {
+	resolvedRoot, err := resolvePath(root)
+	if err != nil {
+		return fmt.Errorf("Invalid dest root %s: %s", root, err)
+	}
+	for _, config := range c.Config {
+		if config.Dest == "" || isRemoteDest(config.Dest) || config.FanOut != "" {
+			continue
+		}
+		if err := checkDestInRoot(config.Dest, root, resolvedRoot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDestInRoot returns an error if dest is outside root, resolved as
+// resolvedRoot, once symlinks are resolved
+func checkDestInRoot(dest, root, resolvedRoot string) error {
+	resolved, err := resolvePath(dest)
+	if err != nil {
+		return fmt.Errorf("Unable to resolve dest %s: %s", dest, err)
+	}
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Dest %s is outside of the dest root %s", dest, root)
+	}
+	return nil
+}
+
+// resolvePath returns the absolute path with symlinks resolved. Missing
+// trailing path elements, such as a dest not generated yet, are kept as is.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	missing := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, missing), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = filepath.Join(filepath.Base(path), missing)
+		path = parent
+	}
+}
+
 type Wait struct {
 	Min time.Duration
 	Max time.Duration
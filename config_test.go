@@ -0,0 +1,46 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDestRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "generated")
+	os.Mkdir(root, 0755)
+	os.Mkdir(filepath.Join(dir, "etc"), 0755)
+	if err := os.Symlink(filepath.Join(dir, "etc"), filepath.Join(root, "escape")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		dest string
+		ok   bool
+	}{
+		{"", true},
+		{filepath.Join(root, "nginx.conf"), true},
+		{filepath.Join(root, "conf.d", "missing", "default.conf"), true},
+		{filepath.Join(root, "..", "passwd"), false},
+		{filepath.Join(root, "escape", "passwd"), false},
+		{root, false},
+		{root + "-other/nginx.conf", false},
+	}
+	for _, test := range tests {
+		configs := ConfigFile{Config: []Config{Config{Dest: test.dest}}}
+		err := configs.CheckDestRoot(root)
+		if test.ok && err != nil {
+			t.Errorf("%s: expected dest to be accepted, got %v", test.dest, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected dest to be rejected", test.dest)
+		}
+	}
+}
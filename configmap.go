@@ -0,0 +1,151 @@
+package dockergen
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// kubernetesServiceAccountDir holds the credentials of the pod's service
+// account
+var kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesClient calls the API server of the cluster docker-gen runs in
+type kubernetesClient struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// newKubernetesClient returns a client authenticated with the pod's service
+// account
+func newKubernetesClient() (*kubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("Not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST is not set")
+	}
+	token, err := ioutil.ReadFile(filepath.Join(kubernetesServiceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the service account token: %s", err)
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(kubernetesServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the service account CA: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("Invalid service account CA")
+	}
+	return &kubernetesClient{
+		addr:  "https://" + net.JoinHostPort(host, port),
+		token: strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// do sends body as JSON and decodes the response into v. It returns the
+// status code of the response; 404 and 409 aren't errors.
+func (c *kubernetesClient) do(ctx context.Context, method, path, contentType string, body, v interface{}) (int, error) {
+	var buf []byte
+	if body != nil {
+		var err error
+		if buf, err = json.Marshal(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, c.addr+path, bytes.NewReader(buf))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict:
+		return resp.StatusCode, nil
+	case resp.StatusCode/100 != 2:
+		return resp.StatusCode, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if v != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode, nil
+}
+
+// configMapKey is a key of a Kubernetes ConfigMap. Updates carry the
+// resourceVersion that was read, so they fail on concurrent changes.
+type configMapKey struct {
+	client    *kubernetesClient
+	namespace string
+	name      string
+	key       string
+}
+
+type configMap struct {
+	Metadata struct {
+		Name            string `json:"name,omitempty"`
+		Namespace       string `json:"namespace,omitempty"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+func (k *configMapKey) path() string {
+	return "/api/v1/namespaces/" + k.namespace + "/configmaps"
+}
+
+func (k *configMapKey) read(ctx context.Context) ([]byte, string, error) {
+	var cm configMap
+	status, err := k.client.do(ctx, "GET", k.path()+"/"+k.name, "", nil, &cm)
+	if err != nil {
+		return nil, "", err
+	}
+	if status == http.StatusNotFound {
+		return nil, "", os.ErrNotExist
+	}
+	value, ok := cm.Data[k.key]
+	if !ok {
+		// the ConfigMap exists, so the key is added by an update
+		return nil, cm.Metadata.ResourceVersion, nil
+	}
+	return []byte(value), cm.Metadata.ResourceVersion, nil
+}
+
+func (k *configMapKey) write(ctx context.Context, contents []byte, version string) (bool, error) {
+	var cm configMap
+	cm.Metadata.Name = k.name
+	cm.Metadata.Namespace = k.namespace
+	cm.Metadata.ResourceVersion = version
+	cm.Data = map[string]string{k.key: string(contents)}
+
+	if version == "" {
+		status, err := k.client.do(ctx, "POST", k.path(), "application/json", cm, nil)
+		return status != http.StatusConflict, err
+	}
+	// a merge patch keeps the other keys of the ConfigMap
+	status, err := k.client.do(ctx, "PATCH", k.path()+"/"+k.name, "application/merge-patch+json", cm, nil)
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	return status != http.StatusConflict, err
+}
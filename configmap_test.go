@@ -0,0 +1,98 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigMapDest(t *testing.T) {
+	var (
+		cm       *configMap
+		requests []string
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Content-Type"))
+		switch r.Method {
+		case "GET":
+			if cm == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(cm)
+		case "POST":
+			json.NewDecoder(r.Body).Decode(&cm)
+			cm.Metadata.ResourceVersion = "1"
+			w.WriteHeader(http.StatusCreated)
+		case "PATCH":
+			var patch configMap
+			json.NewDecoder(r.Body).Decode(&patch)
+			if patch.Metadata.ResourceVersion != cm.Metadata.ResourceVersion {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			for key, value := range patch.Data {
+				cm.Data[key] = value
+			}
+			cm.Metadata.ResourceVersion += "1"
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	ioutil.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "token"), []byte("secret\n"), 0644)
+	defer func(dir string) { kubernetesServiceAccountDir = dir }(kubernetesServiceAccountDir)
+	kubernetesServiceAccountDir = dir
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "https://"))
+	os.Setenv("KUBERNETES_SERVICE_HOST", host)
+	os.Setenv("KUBERNETES_SERVICE_PORT", port)
+	defer os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+
+	remote, ok, err := newRemoteDest("configmap://proxy/haproxy/haproxy.cfg", nil)
+	if !ok || err != nil {
+		t.Fatalf("Expected a ConfigMap dest, got %v", err)
+	}
+	config := Config{Dest: "configmap://proxy/haproxy/haproxy.cfg"}
+	if changed, err := writeRemoteDest(config, remote, []byte("backend web")); !changed || err != nil {
+		t.Fatalf("Expected the ConfigMap to be created, got %t, %v", changed, err)
+	}
+	if cm.Metadata.Name != "haproxy" || cm.Metadata.Namespace != "proxy" || cm.Data["haproxy.cfg"] != "backend web" {
+		t.Fatalf("Incorrect ConfigMap: %+v", cm)
+	}
+
+	cm.Data["other"] = "kept"
+	if changed, err := writeRemoteDest(config, remote, []byte("backend api")); !changed || err != nil {
+		t.Fatalf("Expected the ConfigMap to be updated, got %t, %v", changed, err)
+	}
+	if cm.Data["haproxy.cfg"] != "backend api" || cm.Data["other"] != "kept" {
+		t.Fatalf("Incorrect ConfigMap data: %+v", cm.Data)
+	}
+	expected := []string{
+		"GET /api/v1/namespaces/proxy/configmaps/haproxy ",
+		"POST /api/v1/namespaces/proxy/configmaps application/json",
+		"GET /api/v1/namespaces/proxy/configmaps/haproxy ",
+		"PATCH /api/v1/namespaces/proxy/configmaps/haproxy application/merge-patch+json",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected: %q. got: %q", expected, requests)
+	}
+}
@@ -0,0 +1,252 @@
+package dockergen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ConsulService is a service instance registered in the Consul catalog
+type ConsulService struct {
+	ID          string
+	Name        string
+	Node        string
+	NodeAddress string
+	Address     string
+	Port        int
+	Tags        []string
+	Meta        map[string]string
+}
+
+// ConsulNode is a node registered in the Consul catalog
+type ConsulNode struct {
+	ID         string
+	Name       string
+	Address    string
+	Datacenter string
+	Meta       map[string]string
+}
+
+var (
+	consulMu       sync.RWMutex
+	consulServices []ConsulService
+	consulNodes    []ConsulNode
+)
+
+// ConsulServices returns the service instances of the Consul catalog, when
+// docker-gen is configured with a Consul address
+func (c *Context) ConsulServices() []ConsulService {
+	consulMu.RLock()
+	defer consulMu.RUnlock()
+	return consulServices
+}
+
+// ConsulNodes returns the nodes of the Consul catalog, when docker-gen is
+// configured with a Consul address
+func (c *Context) ConsulNodes() []ConsulNode {
+	consulMu.RLock()
+	defer consulMu.RUnlock()
+	return consulNodes
+}
+
+type consulClient struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+func newConsulClient(addr string) *consulClient {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &consulClient{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  os.Getenv("CONSUL_HTTP_TOKEN"),
+		client: &http.Client{},
+	}
+}
+
+// get decodes the response of a Consul API call into v and returns the
+// X-Consul-Index of the response. A non-zero index makes it a blocking query.
+func (c *consulClient) get(ctx context.Context, path string, index uint64, v interface{}) (uint64, error) {
+	u := c.addr + path
+	if index > 0 {
+		u += "?index=" + strconv.FormatUint(index, 10) + "&wait=5m"
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return 0, err
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return newIndex, nil
+}
+
+// refresh loads the catalog and returns the index of the service list
+func (c *consulClient) refresh(ctx context.Context) (uint64, error) {
+	var names map[string][]string
+	index, err := c.get(ctx, "/v1/catalog/services", 0, &names)
+	if err != nil {
+		return 0, err
+	}
+
+	var nodes []struct {
+		ID         string
+		Node       string
+		Address    string
+		Datacenter string
+		Meta       map[string]string
+	}
+	if _, err := c.get(ctx, "/v1/catalog/nodes", 0, &nodes); err != nil {
+		return 0, err
+	}
+
+	services := []ConsulService{}
+	for name := range names {
+		var instances []struct {
+			ID             string
+			Node           string
+			Address        string
+			ServiceID      string
+			ServiceName    string
+			ServiceAddress string
+			ServicePort    int
+			ServiceTags    []string
+			ServiceMeta    map[string]string
+		}
+		if _, err := c.get(ctx, "/v1/catalog/service/"+url.PathEscape(name), 0, &instances); err != nil {
+			return 0, err
+		}
+		for _, instance := range instances {
+			address := instance.ServiceAddress
+			if address == "" {
+				address = instance.Address
+			}
+			services = append(services, ConsulService{
+				ID:          instance.ServiceID,
+				Name:        instance.ServiceName,
+				Node:        instance.Node,
+				NodeAddress: instance.Address,
+				Address:     address,
+				Port:        instance.ServicePort,
+				Tags:        instance.ServiceTags,
+				Meta:        instance.ServiceMeta,
+			})
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Name == services[j].Name {
+			return services[i].ID < services[j].ID
+		}
+		return services[i].Name < services[j].Name
+	})
+
+	consulNodeList := []ConsulNode{}
+	for _, node := range nodes {
+		consulNodeList = append(consulNodeList, ConsulNode{
+			ID:         node.ID,
+			Name:       node.Node,
+			Address:    node.Address,
+			Datacenter: node.Datacenter,
+			Meta:       node.Meta,
+		})
+	}
+
+	consulMu.Lock()
+	consulServices = services
+	consulNodes = consulNodeList
+	consulMu.Unlock()
+	return index, nil
+}
+
+// wait blocks until the catalog changes after index and returns the new index
+func (c *consulClient) wait(ctx context.Context, index uint64) (uint64, error) {
+	var names map[string][]string
+	return c.get(ctx, "/v1/catalog/services", index, &names)
+}
+
+// loadConsul loads the Consul catalog before the first generation
+func (g *generator) loadConsul() uint64 {
+	if g.ConsulAddr == "" {
+		return 0
+	}
+	index, err := newConsulClient(g.ConsulAddr).refresh(context.Background())
+	if err != nil {
+		logErrorf("Error loading Consul catalog: %s\n", err)
+	}
+	return index
+}
+
+// generateFromConsul regenerates all configs when the Consul catalog changes
+func (g *generator) generateFromConsul(index uint64) {
+	if g.ConsulAddr == "" || len(g.configs().FilterWatches().Config) == 0 {
+		return
+	}
+
+	consul := newConsulClient(g.ConsulAddr)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		sigChan := g.newSignalChannel()
+		for sig := range sigChan {
+			switch sig {
+			case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+				cancel()
+				return
+			}
+		}
+	}()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		logInfof("Watching Consul catalog at %s", consul.addr)
+		for {
+			newIndex, err := consul.wait(ctx, index)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logErrorf("Error watching Consul catalog: %s\n", err)
+				index = 0
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			if newIndex == index {
+				continue
+			}
+
+			if index, err = consul.refresh(ctx); err != nil {
+				logErrorf("Error loading Consul catalog: %s\n", err)
+				index = 0
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			logInfof("Consul catalog changed")
+			g.generateFromContainers("consul catalog change")
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package dockergen
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsulRefresh(t *testing.T) {
+	responses := map[string]string{
+		"/v1/catalog/services":       `{"consul":[],"web":["v1"]}`,
+		"/v1/catalog/nodes":          `[{"ID":"n1","Node":"node1","Address":"10.0.0.1","Datacenter":"dc1"}]`,
+		"/v1/catalog/service/web":    `[{"Node":"node1","Address":"10.0.0.1","ServiceID":"web-1","ServiceName":"web","ServiceAddress":"","ServicePort":8080,"ServiceTags":["v1"]}]`,
+		"/v1/catalog/service/consul": `[{"Node":"node1","Address":"10.0.0.1","ServiceID":"consul","ServiceName":"consul","ServiceAddress":"10.0.0.2","ServicePort":8300}]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Consul-Index", "42")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	consul := newConsulClient(server.URL)
+	consul.token = "secret"
+	index, err := consul.refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Error loading Consul catalog: %v", err)
+	}
+	if index != 42 {
+		t.Errorf("expected: %d. got: %d", 42, index)
+	}
+
+	tests := templateTestList{
+		{`{{range .ConsulServices}}{{.Name}}={{.Address}}:{{.Port}};{{end}}`, &Context{}, `consul=10.0.0.2:8300;web=10.0.0.1:8080;`},
+		{`{{range .ConsulNodes}}{{.Name}}/{{.Datacenter}}{{end}}`, &Context{}, `node1/dc1`},
+	}
+	tests.run(t, "consul")
+}
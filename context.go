@@ -2,9 +2,11 @@ package dockergen
 
 import (
 	"bufio"
+	"encoding/json"
 	"os"
 	"regexp"
 	"sync"
+	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 )
@@ -15,6 +17,10 @@ var (
 	dockerEnv  *docker.Env
 )
 
+// contextErrors holds the errors of the contexts being rendered, keyed by the
+// context passed to the template
+var contextErrors = map[*Context][]string{}
+
 type Context []*RuntimeContainer
 
 func (c *Context) Env() map[string]string {
@@ -27,6 +33,26 @@ func (c *Context) Docker() Docker {
 	return dockerInfo
 }
 
+// Errors returns the errors encountered while retrieving the container
+// meta-data of the current generation. Containers that could not be
+// inspected are missing from the context. It is only available from the
+// root context.
+func (c *Context) Errors() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return contextErrors[c]
+}
+
+func setContextErrors(c *Context, errs []string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if errs == nil {
+		delete(contextErrors, c)
+		return
+	}
+	contextErrors[c] = errs
+}
+
 func SetServerInfo(d *docker.DockerInfo) {
 	mu.Lock()
 	defer mu.Unlock()
@@ -40,6 +66,7 @@ func SetServerInfo(d *docker.DockerInfo) {
 		OperatingSystem:    dockerEnv.Get("Os"),
 		Architecture:       dockerEnv.Get("Arch"),
 		CurrentContainerID: GetCurrentContainerID(),
+		Podman:             isPodman(dockerEnv),
 	}
 }
 
@@ -59,6 +86,21 @@ type Address struct {
 	HostIP       string
 }
 
+// Port is a port the container exposes or publishes. Published ports list
+// every host binding, e.g. one per host IP.
+type Port struct {
+	Port      string
+	Proto     string
+	Exposed   bool // declared by EXPOSE or --expose
+	Published bool // bound to host ports
+	Bindings  []PortBinding
+}
+
+type PortBinding struct {
+	HostIP   string
+	HostPort string
+}
+
 type Network struct {
 	IP                  string
 	Name                string
@@ -79,30 +121,107 @@ type Volume struct {
 
 type State struct {
 	Running bool
+	// Status is created, running, paused, restarting, removing, exited or
+	// dead
+	Status     string
+	Restarting bool
+	OOMKilled  bool
+	// ExitCode and FinishedAt are those of the last run, e.g. to tell
+	// crashed containers from cleanly stopped ones with IncludeStopped
+	ExitCode     int
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	RestartCount int
+}
+
+// Uptime returns how long the container has been running, 0 when it isn't
+func (s State) Uptime() time.Duration {
+	if !s.Running || s.StartedAt.IsZero() {
+		return 0
+	}
+	return time.Since(s.StartedAt)
+}
+
+// Resources are the limits and reservations of the container's HostConfig;
+// zero values are unlimited
+type Resources struct {
+	Memory            int64 // bytes
+	MemoryReservation int64 // bytes
+	MemorySwap        int64 // bytes of memory and swap, -1 for unlimited swap
+	CPUShares         int64 // relative weight, 0 for the default of 1024
+	CPUQuota          int64 // microseconds per CPUPeriod
+	CPUPeriod         int64 // microseconds
+	NanoCPUs          int64 // CPUs in units of 1e-9, as set by --cpus
+	CpusetCpus        string
+	PidsLimit         int64
+}
+
+// ContainerStats is a sample of the resource usage of a running container,
+// set for configs with stats = true
+type ContainerStats struct {
+	CPUPercent float64 // of one CPU, e.g. 250 for 2.5 busy CPUs
+	MemUsage   uint64  // bytes, without the page cache
+	MemLimit   uint64  // bytes
+	Sampled    time.Time
+}
+
+// RestartPolicy is the restart policy of the container's HostConfig
+type RestartPolicy struct {
+	Name              string // no, always, unless-stopped or on-failure
+	MaximumRetryCount int
+}
+
+// Health is the state of the container's HEALTHCHECK. Status is empty when
+// the container has no healthcheck.
+type Health struct {
+	Status        string // starting, healthy or unhealthy
+	FailingStreak int
+	Log           []HealthProbe // last probes, oldest first
+}
+
+type HealthProbe struct {
+	Start    time.Time
+	End      time.Time
+	ExitCode int
+	Output   string
 }
 
 type RuntimeContainer struct {
 	ID           string
 	Addresses    []Address
+	Ports        []Port
 	Networks     []Network
 	Gateway      string
 	Name         string
 	Hostname     string
+	Host         string // endpoint of the docker daemon running the container
 	Image        DockerImage
 	Env          map[string]string
 	Volumes      map[string]Volume
 	Node         SwarmNode
 	Service      SwarmService
+	Task         SwarmTask
 	Labels       map[string]string
 	IP           string
 	IP6LinkLocal string
 	IP6Global    string
 	Mounts       []Mount
 	State        State
+	Health       Health
+	Resources    Resources
+	Restart      RestartPolicy
+	Compose      ComposeContainer
+	Stats        ContainerStats
+
+	// listedBy are the keys of the config Filters the container was listed
+	// with
+	listedBy map[string]bool
+	// configOnly is set for the containers of the endpoints of configs
+	configOnly bool
 }
 
 func (r *RuntimeContainer) Equals(o RuntimeContainer) bool {
-	return r.ID == o.ID && r.Image == o.Image
+	return r.ID == o.ID && r.Image.Equals(o.Image)
 }
 
 func (r *RuntimeContainer) PublishedAddresses() []Address {
@@ -115,10 +234,102 @@ func (r *RuntimeContainer) PublishedAddresses() []Address {
 	return mapped
 }
 
+// ContainerRef identifies a container in a ContainerDelta
+type ContainerRef struct {
+	ID   string
+	Name string
+}
+
+// ContainerDelta describes how the set of containers used by a config
+// changed since its previous generation
+type ContainerDelta struct {
+	Added   []ContainerRef
+	Removed []ContainerRef
+	Changed []ContainerRef
+}
+
+func (d ContainerDelta) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diffContainers compares two container sets by ID. A container present in
+// both sets is considered changed when any of its meta-data differs.
+func diffContainers(previous, current Context) ContainerDelta {
+	delta := ContainerDelta{
+		Added:   []ContainerRef{},
+		Removed: []ContainerRef{},
+		Changed: []ContainerRef{},
+	}
+
+	old := make(map[string]*RuntimeContainer, len(previous))
+	for _, container := range previous {
+		old[container.ID] = container
+	}
+
+	for _, container := range current {
+		ref := ContainerRef{ID: container.ID, Name: container.Name}
+		prev, ok := old[container.ID]
+		if !ok {
+			delta.Added = append(delta.Added, ref)
+			continue
+		}
+		delete(old, container.ID)
+		if !sameContainer(prev, container) {
+			delta.Changed = append(delta.Changed, ref)
+		}
+	}
+
+	for _, container := range previous {
+		if _, ok := old[container.ID]; ok {
+			delta.Removed = append(delta.Removed, ContainerRef{ID: container.ID, Name: container.Name})
+		}
+	}
+	return delta
+}
+
+// sameContainer returns whether a and b are equal but for their volatile
+// fields, the stats sample and the health probes, which change on each
+// generation
+func sameContainer(a, b *RuntimeContainer) bool {
+	aj, err := json.Marshal(withoutVolatile(a))
+	if err != nil {
+		return false
+	}
+	bj, err := json.Marshal(withoutVolatile(b))
+	if err != nil {
+		return false
+	}
+	return string(aj) == string(bj)
+}
+
+// withoutVolatile returns a copy of container without the fields ignored by
+// sameContainer
+func withoutVolatile(container *RuntimeContainer) *RuntimeContainer {
+	c := *container
+	c.Stats = ContainerStats{}
+	c.Health.Log = nil
+	return &c
+}
+
 type DockerImage struct {
 	Registry   string
 	Repository string
 	Tag        string
+
+	// ID, Digest, Labels, ExposedPorts and Created are inspected from the
+	// image of the container. Digest is the repository digest, e.g.
+	// "sha256:...", empty for images that were built locally.
+	ID           string
+	Digest       string
+	Labels       map[string]string
+	ExposedPorts []string
+	Created      time.Time
+}
+
+// Equals returns whether i and o are the same image; the inspected
+// meta-data follows from the ID
+func (i *DockerImage) Equals(o DockerImage) bool {
+	return i.Registry == o.Registry && i.Repository == o.Repository && i.Tag == o.Tag && i.ID == o.ID
 }
 
 func (i *DockerImage) String() string {
@@ -136,6 +347,39 @@ type SwarmNode struct {
 	ID      string
 	Name    string
 	Address Address
+
+	// Role is "manager" or "worker", Availability "active", "pause" or
+	// "drain" and State "ready", "down", "disconnected" or "unknown"
+	Role          string
+	Availability  string
+	State         string
+	EngineVersion string
+	// Labels are the node labels set with docker node update --label-add,
+	// as used by node.labels placement constraints
+	Labels map[string]string
+}
+
+// SwarmTask identifies the swarm task a container runs. The container may
+// still be running while the task's DesiredState is already "shutdown".
+type SwarmTask struct {
+	ID           string
+	Slot         int
+	NodeID       string
+	ContainerID  string
+	DesiredState string
+	State        string
+	Networks     []SwarmTaskNetwork
+}
+
+// SwarmTaskNetwork holds the IPs of a task's container on a network
+type SwarmTaskNetwork struct {
+	Name string
+	IPs  []string
+}
+
+// ShuttingDown returns whether swarm is stopping the task
+func (t SwarmTask) ShuttingDown() bool {
+	return t.DesiredState == "shutdown" || t.DesiredState == "remove"
 }
 
 type SwarmServiceNetwork struct {
@@ -143,12 +387,115 @@ type SwarmServiceNetwork struct {
 	Name   string
 	Scope  string
 	Driver string
+	// TaskIPs are the IPs of the service's running tasks on the network
+	TaskIPs []string
+}
+
+// SwarmServicePort is a port the service publishes, on the routing mesh of
+// all nodes for the "ingress" PublishMode or on the nodes running its tasks
+// for "host"
+type SwarmServicePort struct {
+	Name          string
+	PublishedPort uint32
+	TargetPort    uint32
+	Protocol      string
+	PublishMode   string
 }
 
 type SwarmService struct {
-	ID       string
-	Name     string
-	Networks []SwarmServiceNetwork
+	ID           string
+	Name         string
+	Mode         string
+	Job          SwarmJobStatus
+	Networks     []SwarmServiceNetwork
+	Ports        []SwarmServicePort
+	UpdateStatus SwarmUpdateStatus
+	// DesiredReplicas is the scale of replicated services, and the number of
+	// tasks meant to run for other modes. RunningReplicas are the tasks
+	// running as desired.
+	DesiredReplicas uint64
+	RunningReplicas uint64
+	Placement       SwarmPlacement
+	Reservations    SwarmResources
+	Secrets         []SwarmFile
+	Configs         []SwarmFile
+	// Tasks are all tasks of the service ordered by slot, including those
+	// not running
+	Tasks []SwarmTask
+}
+
+// Modes of swarm services
+const (
+	SwarmModeReplicated    = "replicated"
+	SwarmModeGlobal        = "global"
+	SwarmModeReplicatedJob = "replicated-job"
+	SwarmModeGlobalJob     = "global-job"
+)
+
+// IsJob returns whether the service runs one-shot tasks to completion rather
+// than long-running tasks
+func (s SwarmService) IsJob() bool {
+	return s.Mode == SwarmModeReplicatedJob || s.Mode == SwarmModeGlobalJob
+}
+
+// SwarmFile is a secret or config mounted in the tasks of a service. Target
+// is its path in the containers, empty for configs not mounted as files such
+// as credential specs.
+type SwarmFile struct {
+	ID     string
+	Name   string
+	Target string
+	UID    string
+	GID    string
+	Mode   os.FileMode
+}
+
+// SwarmJobStatus is the progress of a job service. TotalCompletions is 0 for
+// global jobs, which complete once per node.
+type SwarmJobStatus struct {
+	TotalCompletions uint64
+	MaxConcurrent    uint64
+	RunningTasks     int
+	CompletedTasks   int
+}
+
+// SwarmPlacement holds the scheduling rules of a service. Preferences are the
+// label descriptors its tasks are spread over, e.g. "node.labels.zone".
+type SwarmPlacement struct {
+	Constraints []string
+	Preferences []string
+	MaxReplicas uint64
+}
+
+// SwarmResources are the resources reserved for each task of a service
+type SwarmResources struct {
+	NanoCPUs    int64
+	MemoryBytes int64
+}
+
+// CPUs returns the reserved CPUs, e.g. 0.5 for half a CPU
+func (r SwarmResources) CPUs() float64 {
+	return float64(r.NanoCPUs) / 1e9
+}
+
+// SwarmUpdateStatus is the status of a service's latest update or rollback.
+// State is empty if the service was never updated, otherwise one of
+// "updating", "paused", "completed", "rollback_started", "rollback_paused"
+// or "rollback_completed".
+type SwarmUpdateStatus struct {
+	State       string
+	Message     string
+	StartedAt   time.Time
+	CompletedAt time.Time
+}
+
+// Updating returns whether an update or rollback of the service is in progress
+func (s SwarmUpdateStatus) Updating() bool {
+	switch s.State {
+	case "updating", "paused", "rollback_started", "rollback_paused":
+		return true
+	}
+	return false
 }
 
 type Mount struct {
@@ -170,6 +517,7 @@ type Docker struct {
 	OperatingSystem    string
 	Architecture       string
 	CurrentContainerID string
+	Podman             bool
 }
 
 func GetCurrentContainerID() string {
@@ -2,6 +2,7 @@ package dockergen
 
 import (
 	"testing"
+	"time"
 )
 
 func TestGetCurrentContainerID(t *testing.T) {
@@ -50,3 +51,53 @@ func TestGetCurrentContainerID_DockerCE(t *testing.T) {
 	}
 
 }
+
+func TestDiffContainers(t *testing.T) {
+	previous := Context{
+		&RuntimeContainer{ID: "1", Name: "kept"},
+		&RuntimeContainer{ID: "2", Name: "removed"},
+		&RuntimeContainer{ID: "3", Name: "changed", IP: "10.0.0.3"},
+	}
+	current := Context{
+		&RuntimeContainer{ID: "1", Name: "kept"},
+		&RuntimeContainer{ID: "3", Name: "changed", IP: "10.0.0.4"},
+		&RuntimeContainer{ID: "4", Name: "added"},
+	}
+
+	delta := diffContainers(previous, current)
+	if len(delta.Added) != 1 || delta.Added[0].ID != "4" || delta.Added[0].Name != "added" {
+		t.Errorf("unexpected added containers: %v", delta.Added)
+	}
+	if len(delta.Removed) != 1 || delta.Removed[0].ID != "2" {
+		t.Errorf("unexpected removed containers: %v", delta.Removed)
+	}
+	if len(delta.Changed) != 1 || delta.Changed[0].ID != "3" {
+		t.Errorf("unexpected changed containers: %v", delta.Changed)
+	}
+
+	if !diffContainers(current, current).Empty() {
+		t.Error("expected an empty delta for identical container sets")
+	}
+}
+
+func TestDiffContainersIgnoresVolatileFields(t *testing.T) {
+	previous := Context{
+		&RuntimeContainer{ID: "1", Stats: ContainerStats{CPUPercent: 12.5, MemUsage: 1 << 20, Sampled: time.Unix(100, 0)}},
+		&RuntimeContainer{ID: "2", Health: Health{Status: "healthy", Log: []HealthProbe{{ExitCode: 0}}}},
+	}
+	current := Context{
+		&RuntimeContainer{ID: "1", Stats: ContainerStats{CPUPercent: 80, MemUsage: 2 << 20, Sampled: time.Unix(130, 0)}},
+		&RuntimeContainer{ID: "2", Health: Health{Status: "healthy", Log: []HealthProbe{{ExitCode: 0}, {ExitCode: 0}}}},
+	}
+	if delta := diffContainers(previous, current); !delta.Empty() {
+		t.Errorf("expected containers differing only by stats and health probes to be unchanged, got %+v", delta)
+	}
+
+	current[1].Health.Status = "unhealthy"
+	if delta := diffContainers(previous, current); len(delta.Changed) != 1 || delta.Changed[0].ID != "2" {
+		t.Errorf("expected a health status change to be reported, got %+v", delta)
+	}
+	if previous[0].Stats.CPUPercent != 12.5 || len(previous[1].Health.Log) != 1 {
+		t.Error("expected the compared containers to be left unchanged")
+	}
+}
@@ -0,0 +1,148 @@
+package dockergen
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// The control socket accepts one command per connection of the form
+// "trigger <config> [notify|no-notify]" and answers with "ok" or
+// "error: <reason>".
+
+func (g *generator) generateFromControlSocket() {
+	if g.ControlSocket == "" {
+		return
+	}
+
+	// remove a stale socket left behind by a previous instance
+	os.Remove(g.ControlSocket)
+	listener, err := net.Listen("unix", g.ControlSocket)
+	if err != nil {
+		logErrorf("Unable to listen on control socket %s: %s\n", g.ControlSocket, err)
+		return
+	}
+	logInfof("Listening on control socket %s", g.ControlSocket)
+
+	go func() {
+		sigChan := g.newSignalChannel()
+		for sig := range sigChan {
+			switch sig {
+			case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+				listener.Close()
+				return
+			}
+		}
+	}()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go g.handleControlConn(conn)
+		}
+	}()
+}
+
+func (g *generator) handleControlConn(conn net.Conn) {
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	if err := g.handleControlCommand(strings.Fields(line)); err != nil {
+		fmt.Fprintf(conn, "error: %s\n", err)
+		return
+	}
+	fmt.Fprintln(conn, "ok")
+}
+
+func (g *generator) handleControlCommand(args []string) error {
+	if len(args) < 2 || len(args) > 3 || args[0] != "trigger" {
+		return errors.New("usage: trigger <config> [notify|no-notify]")
+	}
+
+	notify := true
+	if len(args) == 3 {
+		switch args[2] {
+		case "notify":
+		case "no-notify":
+			notify = false
+		default:
+			return fmt.Errorf("unknown trigger option %q", args[2])
+		}
+	}
+	return g.trigger(args[1], notify)
+}
+
+var errUnknownConfig = errors.New("no config named")
+
+// trigger regenerates the configs named name, or whose dest is name, or all
+// configs if name is empty, regardless of whether anything changed
+func (g *generator) trigger(name string, notify bool) error {
+	var matched []Config
+	for _, config := range g.configs().Config {
+		if name == "" || config.Name == name || (config.Name == "" && config.Dest == name) {
+			matched = append(matched, config)
+		}
+	}
+	if len(matched) == 0 {
+		return fmt.Errorf("%w %q", errUnknownConfig, name)
+	}
+
+	containers, errs, err := g.getContainers()
+	if err != nil {
+		return fmt.Errorf("listing containers: %s", err)
+	}
+
+	for _, config := range matched {
+		logInfof("Regeneration of %s triggered", config.Dest)
+		config.trigger = "manual trigger"
+		if notify {
+			g.generateConfig(config, containers, errs, true)
+		} else {
+			config.contextErrors = errs
+			changed, _ := g.generateFile(config, containers)
+			g.publishGeneration(config, changed)
+		}
+	}
+	return nil
+}
+
+// Trigger asks the docker-gen instance listening on socketPath to regenerate
+// the config named name
+func Trigger(socketPath, name string, notify bool) error {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	option := "notify"
+	if !notify {
+		option = "no-notify"
+	}
+	if _, err := fmt.Fprintf(conn, "trigger %s %s\n", name, option); err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	reply = strings.TrimSpace(reply)
+	if reply != "ok" {
+		return errors.New(strings.TrimPrefix(reply, "error: "))
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package dockergen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandleControlCommandErrors(t *testing.T) {
+	g := &generator{
+		Configs: ConfigFile{
+			Config: []Config{
+				Config{Name: "nginx", Dest: "/etc/nginx/conf.d/default.conf"},
+			},
+		},
+	}
+
+	tests := []struct {
+		command string
+		err     string
+	}{
+		{"", "usage"},
+		{"reload nginx", "usage"},
+		{"trigger nginx now", "unknown trigger option"},
+		{"trigger missing", "no config named"},
+		{"trigger /etc/nginx/conf.d/default.conf", "no config named"},
+	}
+
+	for _, test := range tests {
+		err := g.handleControlCommand(strings.Fields(test.command))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error containing %q, got %v", test.command, test.err, err)
+		}
+	}
+}
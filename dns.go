@@ -0,0 +1,335 @@
+package dockergen
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DNS providers supported by the dns_provider config option
+const (
+	DNSProviderCloudflare = "cloudflare"
+	DNSProviderRoute53    = "route53"
+)
+
+const (
+	defaultDNSHostEnv = "VIRTUAL_HOST"
+	defaultDNSTTL     = 300
+)
+
+var (
+	dnsClient = &http.Client{Timeout: 30 * time.Second}
+	// the API endpoints are only changed by tests
+	cloudflareAPI = "https://api.cloudflare.com/client/v4"
+	route53API    = "https://route53.amazonaws.com"
+)
+
+type dnsProvider interface {
+	upsert(zone, name, recordType, value string, ttl int) error
+}
+
+func newDNSProvider(name string) (dnsProvider, error) {
+	switch name {
+	case DNSProviderCloudflare:
+		token := os.Getenv("CLOUDFLARE_API_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("CLOUDFLARE_API_TOKEN is not set")
+		}
+		return &cloudflareDNS{token: token}, nil
+	case DNSProviderRoute53:
+		if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+			return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+		}
+		return &route53DNS{
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown dns_provider %q: must be %s or %s", name, DNSProviderCloudflare, DNSProviderRoute53)
+}
+
+// dnsRecordType returns the type of the record pointing at target
+func dnsRecordType(target string) string {
+	ip := net.ParseIP(target)
+	switch {
+	case ip == nil:
+		return "CNAME"
+	case ip.To4() != nil:
+		return "A"
+	default:
+		return "AAAA"
+	}
+}
+
+// deltaHostnames returns the hostnames in the hostEnv environment variable of
+// the containers added or changed by delta. Wildcard and regular expression
+// hosts are skipped.
+func deltaHostnames(delta ContainerDelta, containers Context, hostEnv string) []string {
+	ids := map[string]bool{}
+	for _, ref := range append(append([]ContainerRef{}, delta.Added...), delta.Changed...) {
+		ids[ref.ID] = true
+	}
+
+	seen := map[string]bool{}
+	hosts := []string{}
+	for _, container := range containers {
+		if !ids[container.ID] {
+			continue
+		}
+		for _, host := range strings.Split(container.Env[hostEnv], ",") {
+			host = strings.TrimSpace(host)
+			if host == "" || seen[host] || strings.ContainsAny(host, "*~") {
+				continue
+			}
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// dnsProvider returns the DNS provider of config, created on its first use
+func (g *generator) dnsProvider(config Config) (dnsProvider, error) {
+	// a reloaded config may use another provider
+	key := config.Template + ":" + config.Dest + ":" + config.DNSProvider
+
+	g.dnsMu.Lock()
+	defer g.dnsMu.Unlock()
+	if provider, ok := g.dnsProviders[key]; ok {
+		return provider, nil
+	}
+	provider, err := newDNSProvider(config.DNSProvider)
+	if err != nil {
+		return nil, err
+	}
+	if g.dnsProviders == nil {
+		g.dnsProviders = make(map[string]dnsProvider)
+	}
+	g.dnsProviders[key] = provider
+	return provider, nil
+}
+
+// updateDNS points the hostnames of the containers added or changed by delta
+// at the config's dns_target
+func (g *generator) updateDNS(config Config, delta ContainerDelta, containers Context) {
+	if config.DNSProvider == "" {
+		return
+	}
+	hostEnv := config.DNSHostEnv
+	if hostEnv == "" {
+		hostEnv = defaultDNSHostEnv
+	}
+	hosts := deltaHostnames(delta, containers, hostEnv)
+	if len(hosts) == 0 {
+		return
+	}
+
+	provider, err := g.dnsProvider(config)
+	if err != nil {
+		logErrorf("Error updating DNS records: %s\n", err)
+		return
+	}
+	ttl := config.DNSTTL
+	if ttl <= 0 {
+		ttl = defaultDNSTTL
+	}
+	recordType := dnsRecordType(config.DNSTarget)
+	for _, host := range hosts {
+		logInfof("Pointing %s record %s at %s", recordType, host, config.DNSTarget)
+		if err := provider.upsert(config.DNSZone, host, recordType, config.DNSTarget, ttl); err != nil {
+			logErrorf("Error updating DNS record %s: %s\n", host, err)
+		}
+	}
+}
+
+type cloudflareDNS struct {
+	token string
+}
+
+func (c *cloudflareDNS) do(method, path string, body interface{}, out interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, cloudflareAPI+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *cloudflareDNS) upsert(zone, name, recordType, value string, ttl int) error {
+	var existing struct {
+		Result []struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}
+	query := url.Values{"type": {recordType}, "name": {name}}
+	path := "/zones/" + url.PathEscape(zone) + "/dns_records"
+	if err := c.do("GET", path+"?"+query.Encode(), nil, &existing); err != nil {
+		return err
+	}
+
+	record := map[string]interface{}{
+		"type":    recordType,
+		"name":    name,
+		"content": value,
+		"ttl":     ttl,
+	}
+	if len(existing.Result) > 0 {
+		return c.do("PUT", path+"/"+url.PathEscape(existing.Result[0].ID), record, nil)
+	}
+	return c.do("POST", path, record, nil)
+}
+
+type route53DNS struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+type route53RecordSet struct {
+	Name    string   `xml:"Name"`
+	Type    string   `xml:"Type"`
+	TTL     int      `xml:"TTL"`
+	Records []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+type route53Change struct {
+	Action string           `xml:"Action"`
+	Set    route53RecordSet `xml:"ResourceRecordSet"`
+}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+func (r *route53DNS) upsert(zone, name, recordType, value string, ttl int) error {
+	request := route53ChangeRequest{Changes: []route53Change{{
+		Action: "UPSERT",
+		Set: route53RecordSet{
+			Name:    name,
+			Type:    recordType,
+			TTL:     ttl,
+			Records: []string{value},
+		},
+	}}}
+
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	zone = strings.TrimPrefix(zone, "/hostedzone/")
+	req, err := http.NewRequest("POST", route53API+"/2013-04-01/hostedzone/"+zone+"/rrset", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	r.sign(req, body, time.Now().UTC())
+
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Route53 change of %s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 to req. Route53 is a global service
+// signed for us-east-1.
+func (r *route53DNS) sign(req *http.Request, body []byte, now time.Time) {
+	r.signV4(req, body, now, "us-east-1", "route53")
+}
+
+// signV4 adds an AWS Signature Version 4 for service in region to req
+func (r *route53DNS) signV4(req *http.Request, body []byte, now time.Time, region, service string) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if r.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", r.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + r.secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		r.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,174 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSRecordType(t *testing.T) {
+	for target, expected := range map[string]string{
+		"203.0.113.10":   "A",
+		"2001:db8::1":    "AAAA",
+		"lb.example.com": "CNAME",
+	} {
+		if recordType := dnsRecordType(target); recordType != expected {
+			t.Errorf("%s: expected: %s. got: %s", target, expected, recordType)
+		}
+	}
+}
+
+func TestDeltaHostnames(t *testing.T) {
+	containers := Context{
+		&RuntimeContainer{ID: "1", Env: map[string]string{"VIRTUAL_HOST": "a.example.com, b.example.com"}},
+		&RuntimeContainer{ID: "2", Env: map[string]string{"VIRTUAL_HOST": "*.example.com,~^c\\..*"}},
+		&RuntimeContainer{ID: "3", Env: map[string]string{"VIRTUAL_HOST": "old.example.com"}},
+		&RuntimeContainer{ID: "4", Env: map[string]string{"VIRTUAL_HOST": "a.example.com"}},
+	}
+	delta := ContainerDelta{
+		Added:   []ContainerRef{{ID: "1"}, {ID: "2"}},
+		Changed: []ContainerRef{{ID: "4"}},
+	}
+
+	hosts := deltaHostnames(delta, containers, "VIRTUAL_HOST")
+	if expected := []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("expected: %v. got: %v", expected, hosts)
+	}
+}
+
+func TestCloudflareUpsert(t *testing.T) {
+	var methods []string
+	var record map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		methods = append(methods, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case "GET":
+			if r.URL.Query().Get("name") == "existing.example.com" {
+				w.Write([]byte(`{"result":[{"id":"rec1"}]}`))
+			} else {
+				w.Write([]byte(`{"result":[]}`))
+			}
+		default:
+			json.NewDecoder(r.Body).Decode(&record)
+			w.Write([]byte(`{"success":true}`))
+		}
+	}))
+	defer server.Close()
+	defer func(api string) { cloudflareAPI = api }(cloudflareAPI)
+	cloudflareAPI = server.URL
+
+	provider := &cloudflareDNS{token: "secret"}
+	if err := provider.upsert("zone1", "new.example.com", "A", "203.0.113.10", 300); err != nil {
+		t.Fatal(err)
+	}
+	if record["content"] != "203.0.113.10" || record["type"] != "A" {
+		t.Errorf("unexpected record: %v", record)
+	}
+	if err := provider.upsert("zone1", "existing.example.com", "A", "203.0.113.10", 300); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"GET /zones/zone1/dns_records",
+		"POST /zones/zone1/dns_records",
+		"GET /zones/zone1/dns_records",
+		"PUT /zones/zone1/dns_records/rec1",
+	}
+	if !reflect.DeepEqual(methods, expected) {
+		t.Errorf("expected: %v. got: %v", expected, methods)
+	}
+}
+
+func TestRoute53Upsert(t *testing.T) {
+	var request route53ChangeRequest
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2013-04-01/hostedzone/Z123/rrset" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		xml.NewDecoder(r.Body).Decode(&request)
+	}))
+	defer server.Close()
+	defer func(api string) { route53API = api }(route53API)
+	route53API = server.URL
+
+	provider := &route53DNS{accessKey: "AKID", secretKey: "secret"}
+	if err := provider.upsert("/hostedzone/Z123", "web.example.com", "CNAME", "lb.example.com", 60); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		!strings.Contains(authorization, "/us-east-1/route53/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=") {
+		t.Errorf("unexpected authorization: %s", authorization)
+	}
+	if len(request.Changes) != 1 {
+		t.Fatalf("expected 1 change. got: %d", len(request.Changes))
+	}
+	expected := route53Change{
+		Action: "UPSERT",
+		Set:    route53RecordSet{Name: "web.example.com", Type: "CNAME", TTL: 60, Records: []string{"lb.example.com"}},
+	}
+	if !reflect.DeepEqual(request.Changes[0], expected) {
+		t.Errorf("expected: %+v. got: %+v", expected, request.Changes[0])
+	}
+}
+
+// TestSignV4 checks requests of the AWS Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	credentials := &route53DNS{accessKey: "AKIDEXAMPLE", secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name, method, path, contentType, body string
+		signedHeaders, signature              string
+	}{
+		{"get-vanilla", "GET", "/", "", "", "host;x-amz-date", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "GET", "/?Param2=value2&Param1=value1", "", "", "host;x-amz-date", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"post-vanilla", "POST", "/", "", "", "host;x-amz-date", "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{"post-x-www-form-urlencoded", "POST", "/", "application/x-www-form-urlencoded", "Param1=value1", "content-type;host;x-amz-date", "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"},
+	} {
+		req, err := http.NewRequest(test.method, "https://example.amazonaws.com"+test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		credentials.signV4(req, []byte(test.body), now, "us-east-1", "service")
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=" +
+			test.signedHeaders + ", Signature=" + test.signature
+		if authorization := req.Header.Get("Authorization"); authorization != expected {
+			t.Errorf("%s: expected: %s. got: %s", test.name, expected, authorization)
+		}
+	}
+}
+
+func TestDNSProviderPerConfig(t *testing.T) {
+	defer os.Setenv("CLOUDFLARE_API_TOKEN", os.Getenv("CLOUDFLARE_API_TOKEN"))
+	os.Setenv("CLOUDFLARE_API_TOKEN", "token")
+
+	g := &generator{}
+	config := Config{Template: "test.tmpl", Dest: "test.conf", DNSProvider: DNSProviderCloudflare}
+	first, err := g.dnsProvider(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider, _ := g.dnsProvider(config); provider != first {
+		t.Error("Expected the provider of the config to be reused")
+	}
+	config.Dest = "other.conf"
+	if provider, _ := g.dnsProvider(config); provider == first {
+		t.Error("Expected another config to have its own provider")
+	}
+}
@@ -3,16 +3,38 @@ package dockergen
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 )
 
+// DockerClientOptions tune the connections to the docker daemon. Zero values
+// keep the defaults of go-dockerclient.
+type DockerClientOptions struct {
+	// DialTimeout bounds establishing a connection
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout bounds waiting for the headers of a response
+	ResponseHeaderTimeout time.Duration
+	// KeepAlive is the TCP keep-alive period of connections
+	KeepAlive time.Duration
+	// MaxIdleConns enables HTTP keep-alive with up to this many idle connections
+	MaxIdleConns int
+}
+
 func NewDockerClient(endpoint string, tlsVerify bool, tlsCert, tlsCaCert, tlsKey string) (*docker.Client, error) {
+	return NewDockerClientWithOptions(endpoint, tlsVerify, tlsCert, tlsCaCert, tlsKey, DockerClientOptions{})
+}
+
+func NewDockerClientWithOptions(endpoint string, tlsVerify bool, tlsCert, tlsCaCert, tlsKey string, options DockerClientOptions) (*docker.Client, error) {
+	var client *docker.Client
+	var err error
 	if strings.HasPrefix(endpoint, "unix:") {
-		return docker.NewClient(endpoint)
+		client, err = docker.NewClient(endpoint)
 	} else if tlsVerify || tlsEnabled(tlsCert, tlsCaCert, tlsKey) {
 		if tlsVerify {
 			if e, err := pathExists(tlsCaCert); !e || err != nil {
@@ -20,9 +42,38 @@ func NewDockerClient(endpoint string, tlsVerify bool, tlsCert, tlsCaCert, tlsKey
 			}
 		}
 
-		return docker.NewTLSClient(endpoint, tlsCert, tlsKey, tlsCaCert)
+		client, err = docker.NewTLSClient(endpoint, tlsCert, tlsKey, tlsCaCert)
+	} else {
+		client, err = docker.NewClient(endpoint)
+	}
+	if err != nil {
+		return nil, err
+	}
+	options.apply(client, endpoint)
+	return client, nil
+}
+
+func (o DockerClientOptions) apply(client *docker.Client, endpoint string) {
+	if o.DialTimeout > 0 || o.KeepAlive > 0 {
+		// unix socket connections are dialed by client.Dialer
+		client.Dialer = &net.Dialer{Timeout: o.DialTimeout, KeepAlive: o.KeepAlive}
+	}
+
+	transport, ok := client.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	if (o.DialTimeout > 0 || o.KeepAlive > 0) && !strings.HasPrefix(endpoint, "unix:") {
+		transport.DialContext = client.Dialer.(*net.Dialer).DialContext
+	}
+	if o.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = o.ResponseHeaderTimeout
+	}
+	if o.MaxIdleConns > 0 {
+		transport.DisableKeepAlives = false
+		transport.MaxIdleConns = o.MaxIdleConns
+		transport.MaxIdleConnsPerHost = o.MaxIdleConns
 	}
-	return docker.NewClient(endpoint)
 }
 
 func tlsEnabled(tlsCert, tlsCaCert, tlsKey string) bool {
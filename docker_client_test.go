@@ -1,7 +1,10 @@
 package dockergen
 
 import (
+	"net"
+	"net/http"
 	"testing"
+	"time"
 )
 
 func TestSplitDockerImageRepository(t *testing.T) {
@@ -194,3 +197,27 @@ func TestParseHostTCPDefault(t *testing.T) {
 		t.Fatal("failed to parse unix:///var/run/docker.sock")
 	}
 }
+
+func TestNewDockerClientWithOptions(t *testing.T) {
+	client, err := NewDockerClientWithOptions("tcp://127.0.0.1:2375", false, "", "", "", DockerClientOptions{
+		DialTimeout:           2 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		KeepAlive:             time.Minute,
+		MaxIdleConns:          4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialer := client.Dialer.(*net.Dialer)
+	if dialer.Timeout != 2*time.Second || dialer.KeepAlive != time.Minute {
+		t.Errorf("unexpected dialer: %+v", dialer)
+	}
+	transport := client.HTTPClient.Transport.(*http.Transport)
+	if transport.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("expected response header timeout 5s, got %s", transport.ResponseHeaderTimeout)
+	}
+	if transport.DisableKeepAlives || transport.MaxIdleConnsPerHost != 4 {
+		t.Errorf("expected 4 idle connections, got %d (keep-alives disabled: %v)", transport.MaxIdleConnsPerHost, transport.DisableKeepAlives)
+	}
+}
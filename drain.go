@@ -0,0 +1,89 @@
+package dockergen
+
+import (
+	"syscall"
+)
+
+// drainingContexts are the contexts being rendered by drains
+var drainingContexts = map[*Context]bool{}
+
+// Draining returns whether docker-gen is generating the configs with drain
+// set a last time before exiting on SIGTERM. It is only available from the
+// root context.
+func (c *Context) Draining() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return drainingContexts[c]
+}
+
+func setDraining(c *Context, d bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !d {
+		delete(drainingContexts, c)
+		return
+	}
+	drainingContexts[c] = true
+}
+
+// drainConfigs returns the configs generated a last time on SIGTERM. Only
+// configs of long running instances, watching or generating at intervals,
+// are drained.
+func (g *generator) drainConfigs() []Config {
+	configs := []Config{}
+	running := false
+	for _, config := range g.configs().Config {
+		if config.Watch || config.Interval > 0 {
+			running = true
+		}
+		if config.Drain {
+			configs = append(configs, config)
+		}
+	}
+	if !running {
+		return nil
+	}
+	return configs
+}
+
+// watchTermination records whether docker-gen is stopped by SIGTERM, after
+// which Generate drains the configs
+func (g *generator) watchTermination() {
+	if len(g.drainConfigs()) == 0 {
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		sigChan := g.newSignalChannel()
+		for {
+			switch <-sigChan {
+			case syscall.SIGTERM:
+				g.terminated = true
+				return
+			case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGINT:
+				return
+			}
+		}
+	}()
+}
+
+// drain generates and notifies the configs with drain set with Draining
+// true in their context, once all other generations stopped
+func (g *generator) drain() {
+	configs := g.drainConfigs()
+	if !g.terminated || len(configs) == 0 {
+		return
+	}
+	containers, errs, err := g.getContainers()
+	if err != nil {
+		logErrorf("Error listing containers: %s\n", err)
+		return
+	}
+	for _, config := range configs {
+		logInfof("Draining %s", config.Dest)
+		config.trigger = "drain"
+		config.draining = true
+		g.generateConfig(config, containers, errs, true)
+	}
+}
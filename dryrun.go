@@ -0,0 +1,100 @@
+package dockergen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DryRun renders every config once and writes to w a diff of each dest file
+// that would change, without writing them or running notifications. Configs
+// without dest are written to w. It returns whether any dest would change or
+// any template failed to render.
+func (g *generator) DryRun(w io.Writer) (bool, error) {
+	if err := startPlugins(g.configs().Plugin); err != nil {
+		stopPlugins()
+		return false, err
+	}
+	defer stopPlugins()
+	if err := startFuncs(g.configs().Func); err != nil {
+		return false, err
+	}
+	defer stopFuncs()
+	if err := g.connectConfigHosts(); err != nil {
+		return false, err
+	}
+	g.loadConsul()
+	g.loadEtcd()
+
+	containers, errs, err := g.getContainers()
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, config := range g.configs().Config {
+		config.trigger = "dry run"
+		config.contextErrors = errs
+		configContainers := filterContainers(config, g.withStats(config, containers))
+		groups := []fanOutGroup{{config.Dest, configContainers}}
+		if config.FanOut != "" {
+			if groups, err = fanOutGroups(config, configContainers, g.DestRoot); err != nil {
+				fmt.Fprintf(w, "FAIL %s: %s\n", config.Dest, err)
+				changed = true
+				continue
+			}
+		}
+		for _, group := range groups {
+			groupConfig := config
+			groupConfig.Dest = group.dest
+			if g.dryRunConfig(groupConfig, group.containers, w) {
+				changed = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+// dryRunConfig renders config and writes how its dest would change to w. It
+// returns whether dest would change or the template failed.
+func (g *generator) dryRunConfig(config Config, containers Context, w io.Writer) bool {
+	timeout, err := config.TemplateDeadline()
+	if err != nil {
+		fmt.Fprintf(w, "FAIL %s: %s\n", config.Template, err)
+		return true
+	}
+	done := make(chan struct{})
+	defer close(done)
+	contents, err := executeTemplate(config, containers, timeout, g.streamFuncs(config, containers, done), g.vaultFuncs(), pluginFuncs(config))
+	if err != nil {
+		fmt.Fprintf(w, "FAIL %s: %s\n", config.Template, err)
+		return true
+	}
+	if !config.KeepBlankLines {
+		buf := new(bytes.Buffer)
+		removeBlankLines(bytes.NewReader(contents), buf)
+		contents = buf.Bytes()
+	}
+
+	if config.Dest == "" {
+		w.Write(contents)
+		return false
+	}
+	current, err := readDest(config.Dest, g.swarmClient())
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		fmt.Fprintf(w, "FAIL %s: %s\n", config.Dest, err)
+		return true
+	}
+	current = stripProvenanceHeader(config, current)
+	if !missing && bytes.Equal(current, contents) {
+		fmt.Fprintf(w, "ok   %s\n", config.Dest)
+		return false
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s (rendered)\n", config.Dest, config.Dest)
+	for _, line := range diffLines(string(current), string(contents)) {
+		fmt.Fprintln(w, line)
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package dockergen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestDryRun(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	SetDockerEnv(&docker.Env{})
+	server, host := newFakeDockerHost(t, "web1")
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "docker-gen-dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmpl := filepath.Join(dir, "tmpl")
+	if err := ioutil.WriteFile(tmpl, []byte("{{ range . }}server {{ .Name }}\n{{ end }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	current := filepath.Join(dir, "current")
+	if err := ioutil.WriteFile(current, []byte("server web1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(dir, "stale")
+	if err := ioutil.WriteFile(stale, []byte("server web0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &generator{Client: host.Client, Endpoint: host.Endpoint}
+	dryRun := func(dests ...string) (bool, string) {
+		g.Configs.Config = nil
+		for _, dest := range dests {
+			g.Configs.Config = append(g.Configs.Config, Config{Template: tmpl, Dest: dest, IncludeStopped: true})
+		}
+		var out bytes.Buffer
+		changed, err := g.DryRun(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changed, out.String()
+	}
+
+	if changed, out := dryRun(current); changed || out != "ok   "+current+"\n" {
+		t.Errorf("Expected %s to be unchanged, got %q", current, out)
+	}
+	changed, out := dryRun(current, stale)
+	expected := "--- " + stale + "\n+++ " + stale + " (rendered)\n-server web0\n+server web1\n \n"
+	if !changed || !strings.HasSuffix(out, expected) {
+		t.Errorf("Expected the diff of %s, got %q", stale, out)
+	}
+	if contents, _ := ioutil.ReadFile(stale); string(contents) != "server web0\n" {
+		t.Errorf("Expected %s to be left unchanged, got %q", stale, contents)
+	}
+	missing := filepath.Join(dir, "missing")
+	if changed, _ := dryRun(missing); !changed {
+		t.Errorf("Expected the missing %s to be reported", missing)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("Expected %s not to be created", missing)
+	}
+}
@@ -0,0 +1,37 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// DumpContext writes the containers templates are rendered with to w as an
+// indented JSON array, in the format of the .json files of template tests
+func (g *generator) DumpContext(w io.Writer) error {
+	if err := g.connectConfigHosts(); err != nil {
+		return err
+	}
+	containers, _, err := g.getContainers()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(containers, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func (g *generator) handleContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := g.DumpContext(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,248 @@
+package dockergen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	etcdMu   sync.RWMutex
+	etcdData = map[string]interface{}{}
+)
+
+// Etcd returns the keys below the configured etcd prefix as a nested map,
+// e.g. the key <prefix>/hosts/web/port is available as .Etcd.hosts.web.port
+func (c *Context) Etcd() map[string]interface{} {
+	etcdMu.RLock()
+	defer etcdMu.RUnlock()
+	return etcdData
+}
+
+type etcdClient struct {
+	endpoint string
+	prefix   string
+	client   *http.Client
+}
+
+type etcdKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func newEtcdClient(endpoint, prefix string) *etcdClient {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	return &etcdClient{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		prefix:   prefix,
+		client:   &http.Client{},
+	}
+}
+
+// rangeEnd returns the end of the key range covering all keys with prefix
+func etcdRangeEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	// the prefix is all 0xff bytes; the range extends to the end of the keyspace
+	return "\x00"
+}
+
+func (c *etcdClient) keyRange() map[string]string {
+	return map[string]string{
+		"key":       base64.StdEncoding.EncodeToString([]byte(c.prefix)),
+		"range_end": base64.StdEncoding.EncodeToString([]byte(etcdRangeEnd(c.prefix))),
+	}
+}
+
+func (c *etcdClient) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.endpoint+path, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("POST %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+// refresh loads all keys below the prefix and returns the store revision
+func (c *etcdClient) refresh(ctx context.Context) (int64, error) {
+	resp, err := c.post(ctx, "/v3/kv/range", c.keyRange())
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Header struct {
+			Revision string `json:"revision"`
+		} `json:"header"`
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+
+	data := map[string]interface{}{}
+	for _, kv := range result.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return 0, err
+		}
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return 0, err
+		}
+		setNested(data, strings.TrimPrefix(string(key), c.prefix), string(value))
+	}
+
+	etcdMu.Lock()
+	etcdData = data
+	etcdMu.Unlock()
+
+	revision, _ := strconv.ParseInt(result.Header.Revision, 10, 64)
+	return revision, nil
+}
+
+// setNested stores value in data at the "/" separated path key. A key that is
+// also the parent of other keys is replaced by the map of its children.
+func setNested(data map[string]interface{}, key string, value string) {
+	parts := strings.Split(strings.Trim(key, "/"), "/")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := data[part].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			data[part] = child
+		}
+		data = child
+	}
+	last := parts[len(parts)-1]
+	if _, ok := data[last].(map[string]interface{}); !ok {
+		data[last] = value
+	}
+}
+
+// watch blocks until a key below the prefix changes after revision
+func (c *etcdClient) watch(ctx context.Context, revision int64) error {
+	request := c.keyRange()
+	resp, err := c.post(ctx, "/v3/watch", map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            request["key"],
+			"range_end":      request["range_end"],
+			"start_revision": strconv.FormatInt(revision+1, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var message struct {
+			Result struct {
+				Events []json.RawMessage `json:"events"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return err
+		}
+		if len(message.Result.Events) > 0 {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("watch stream closed")
+}
+
+// loadEtcd loads the etcd prefix before the first generation
+func (g *generator) loadEtcd() int64 {
+	if g.EtcdEndpoint == "" {
+		return 0
+	}
+	revision, err := newEtcdClient(g.EtcdEndpoint, g.EtcdPrefix).refresh(context.Background())
+	if err != nil {
+		logErrorf("Error loading etcd keys: %s\n", err)
+	}
+	return revision
+}
+
+// generateFromEtcd regenerates all configs when a key below the etcd prefix changes
+func (g *generator) generateFromEtcd(revision int64) {
+	if g.EtcdEndpoint == "" || len(g.configs().FilterWatches().Config) == 0 {
+		return
+	}
+
+	etcd := newEtcdClient(g.EtcdEndpoint, g.EtcdPrefix)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		sigChan := g.newSignalChannel()
+		for sig := range sigChan {
+			switch sig {
+			case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+				cancel()
+				return
+			}
+		}
+	}()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		logInfof("Watching etcd keys %s at %s", etcd.prefix, etcd.endpoint)
+		for {
+			err := etcd.watch(ctx, revision)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logErrorf("Error watching etcd keys: %s\n", err)
+				time.Sleep(10 * time.Second)
+			}
+
+			newRevision, err := etcd.refresh(ctx)
+			if err != nil {
+				logErrorf("Error loading etcd keys: %s\n", err)
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			if newRevision == revision {
+				continue
+			}
+			revision = newRevision
+			logInfof("etcd keys changed")
+			g.generateFromContainers("etcd change")
+		}
+	}()
+}
@@ -0,0 +1,65 @@
+package dockergen
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEtcdRangeEnd(t *testing.T) {
+	if end := etcdRangeEnd("/config/"); end != "/config0" {
+		t.Errorf("expected: %s. got: %s", "/config0", end)
+	}
+	if end := etcdRangeEnd("a\xff"); end != "b" {
+		t.Errorf("expected: %s. got: %q", "b", end)
+	}
+}
+
+func TestEtcdRefresh(t *testing.T) {
+	kvs := map[string]string{
+		"/config/hosts/web/port": "80",
+		"/config/hosts/web/name": "web.local",
+		"/config/region":         "eu",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/kv/range" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		if key, _ := base64.StdEncoding.DecodeString(request["key"]); string(key) != "/config/" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		result := []etcdKeyValue{}
+		for k, v := range kvs {
+			result = append(result, etcdKeyValue{
+				Key:   base64.StdEncoding.EncodeToString([]byte(k)),
+				Value: base64.StdEncoding.EncodeToString([]byte(v)),
+			})
+		}
+		fmt.Fprint(w, `{"header":{"revision":"7"},"kvs":`)
+		json.NewEncoder(w).Encode(result)
+		fmt.Fprint(w, `}`)
+	}))
+	defer server.Close()
+
+	revision, err := newEtcdClient(server.URL, "/config/").refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Error loading etcd keys: %v", err)
+	}
+	if revision != 7 {
+		t.Errorf("expected: %d. got: %d", 7, revision)
+	}
+
+	tests := templateTestList{
+		{`{{.Etcd.hosts.web.name}}:{{.Etcd.hosts.web.port}} {{.Etcd.region}}`, &Context{}, `web.local:80 eu`},
+	}
+	tests.run(t, "etcd")
+}
@@ -0,0 +1,74 @@
+package dockergen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// execResult is the outcome of a command run in a container
+type execResult struct {
+	ExitCode int
+	Output   string
+}
+
+// execInContainer runs cmd in container through the docker exec API and
+// returns its exit code and combined output
+func execInContainer(client *docker.Client, container string, cmd []string) (execResult, error) {
+	exec, err := client.CreateExec(docker.CreateExecOptions{
+		Container:    container,
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return execResult{}, err
+	}
+	var output bytes.Buffer
+	if err := client.StartExec(exec.ID, docker.StartExecOptions{
+		OutputStream: &output,
+		ErrorStream:  &output,
+	}); err != nil {
+		return execResult{}, err
+	}
+	inspect, err := client.InspectExec(exec.ID)
+	if err != nil {
+		return execResult{}, err
+	}
+	return execResult{ExitCode: inspect.ExitCode, Output: output.String()}, nil
+}
+
+// execInNotifyContainers runs the NotifyContainersExec commands of config in
+// their containers. The output is logged when the command fails or with
+// NotifyOutput.
+func (g *generator) execInNotifyContainers(config Config) {
+	if len(config.NotifyContainersExec) < 1 {
+		return
+	}
+	client := g.notifyHost(config).Client
+	for container, cmd := range config.NotifyContainersExec {
+		if len(cmd) == 0 {
+			continue
+		}
+		logInfof("Running '%s' in container '%s'", strings.Join(cmd, " "), container)
+		result, err := execInContainer(client, container, cmd)
+		if err != nil {
+			logErrorf("Error running command in container %s: %s", container, err)
+			continue
+		}
+		failed := result.ExitCode != 0
+		if failed {
+			logErrorf("Command '%s' in container %s exited with code %d", strings.Join(cmd, " "), container, result.ExitCode)
+		}
+		if failed || config.NotifyOutput {
+			prefix := fmt.Sprintf("[%s: %s]", container, strings.Join(cmd, " "))
+			for _, line := range strings.Split(result.Output, "\n") {
+				if line != "" {
+					logInfof("%s: %s", prefix, line)
+				}
+			}
+		}
+	}
+}
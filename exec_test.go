@@ -0,0 +1,45 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	dockertest "github.com/fsouza/go-dockerclient/testing"
+)
+
+func TestExecInContainer(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	client, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PullImage(docker.PullImageOptions{Repository: "nginx"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateContainer(docker.CreateContainerOptions{Name: "nginx", Config: &docker.Config{Image: "nginx"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	executed := false
+	server.PrepareExec("*", func() {
+		executed = true
+	})
+	result, err := execInContainer(client, "nginx", []string{"nginx", "-s", "reload"})
+	if err != nil {
+		t.Fatalf("Expected the command to run, got %v", err)
+	}
+	if !executed || result.ExitCode != 0 {
+		t.Errorf("Expected the command to run successfully, got %+v", result)
+	}
+
+	if _, err := execInContainer(client, "missing", []string{"true"}); err == nil {
+		t.Error("Expected a missing container to fail")
+	}
+}
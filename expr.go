@@ -0,0 +1,280 @@
+package dockergen
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A filter expression as accepted by whereExpr, e.g.
+//
+//	.Labels.traefik.enable == "true" && (.State.Running || !.Env.OPTIONAL)
+//
+// Operands are field paths starting with a dot (resolved with deepGet),
+// quoted strings, numbers, true, false and nil. Operators are ==, !=, !, &&
+// and || with the usual precedence. A field path on its own is true when it
+// exists and is not a zero value.
+
+type exprNode interface {
+	eval(item interface{}) interface{}
+}
+
+type exprPath string
+
+func (p exprPath) eval(item interface{}) interface{} {
+	return deepGet(item, string(p))
+}
+
+type exprLiteral struct {
+	value interface{}
+}
+
+func (l exprLiteral) eval(interface{}) interface{} {
+	return l.value
+}
+
+type exprNot struct {
+	operand exprNode
+}
+
+func (n exprNot) eval(item interface{}) interface{} {
+	return !truthy(n.operand.eval(item))
+}
+
+type exprBinary struct {
+	op          string
+	left, right exprNode
+}
+
+func (b exprBinary) eval(item interface{}) interface{} {
+	switch b.op {
+	case "&&":
+		return truthy(b.left.eval(item)) && truthy(b.right.eval(item))
+	case "||":
+		return truthy(b.left.eval(item)) || truthy(b.right.eval(item))
+	case "==":
+		return exprEqual(b.left.eval(item), b.right.eval(item))
+	case "!=":
+		return !exprEqual(b.left.eval(item), b.right.eval(item))
+	}
+	return nil
+}
+
+// exprEqual compares values of different types, such as a label value and a
+// number literal, by their string representation
+func exprEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return reflect.DeepEqual(a, b) || fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func truthy(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() != 0
+	case reflect.Ptr, reflect.Interface:
+		return !v.IsNil()
+	}
+	return true
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseExpr(expr string) (exprNode, error) {
+	tokens, err := tokenizeExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression %q", p.tokens[p.pos], expr)
+	}
+	return node, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary{"||", left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary{"&&", left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek() == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); op == "==" || op == "!=" {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return exprBinary{op, left, right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return node, nil
+	case token[0] == '.':
+		return exprPath(token), nil
+	case token[0] == '"' || token[0] == '`':
+		value, err := strconv.Unquote(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", token)
+		}
+		return exprLiteral{value}, nil
+	case token == "true":
+		return exprLiteral{true}, nil
+	case token == "false":
+		return exprLiteral{false}, nil
+	case token == "nil":
+		return exprLiteral{nil}, nil
+	}
+	if i, err := strconv.Atoi(token); err == nil {
+		return exprLiteral{i}, nil
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return exprLiteral{f}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q in expression", token)
+}
+
+func isExprPathChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-/", r)
+}
+
+func isExprOperator(s string) bool {
+	switch s {
+	case "==", "!=", "&&", "||":
+		return true
+	}
+	return false
+}
+
+func tokenizeExpr(expr string) ([]string, error) {
+	tokens := []string{}
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case i+1 < len(runes) && isExprOperator(string(runes[i:i+2])):
+			tokens = append(tokens, string(runes[i:i+2]))
+			i += 2
+		case r == '!':
+			tokens = append(tokens, "!")
+			i++
+		case r == '"' || r == '`':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && r == '"' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in expression %q", expr)
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case isExprPathChar(r):
+			j := i
+			for ; j < len(runes) && isExprPathChar(runes[j]); j++ {
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q in expression %q", r, expr)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,157 @@
+package dockergen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FanOutContainer is the fan_out value rendering the template once per
+// container; any other value is the path of the property grouping the
+// containers, as with groupBy
+const FanOutContainer = "container"
+
+// fanOutGroup is a rendering of a fan_out config
+type fanOutGroup struct {
+	dest       string
+	containers Context
+}
+
+// fanOutGroups returns the renderings of config: one per container, whose
+// dest template is executed with the container, or one per value of the
+// fan_out property, whose dest template is executed with the value. With a
+// destRoot, the rendered dests must be inside it.
+func fanOutGroups(config Config, containers Context, destRoot string) ([]fanOutGroup, error) {
+	destTmpl, err := newTemplate("dest").Parse(config.Dest)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse dest %q: %s", config.Dest, err)
+	}
+	resolvedRoot := ""
+	if destRoot != "" {
+		if resolvedRoot, err = resolvePath(destRoot); err != nil {
+			return nil, fmt.Errorf("Invalid dest root %s: %s", destRoot, err)
+		}
+	}
+	renderDest := func(data interface{}) (string, error) {
+		var buf bytes.Buffer
+		if err := destTmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("Unable to render dest %q: %s", config.Dest, err)
+		}
+		dest := strings.TrimSpace(buf.String())
+		if dest == "" || dest[len(dest)-1] == '/' {
+			return "", fmt.Errorf("dest %q rendered to %q, which is not a file", config.Dest, dest)
+		}
+		for _, elem := range strings.Split(dest, string(filepath.Separator)) {
+			if elem == ".." {
+				return "", fmt.Errorf("dest %q rendered to %q, which leaves its directory", config.Dest, dest)
+			}
+		}
+		if destRoot != "" {
+			// container labels may render any absolute path
+			if err := checkDestInRoot(dest, destRoot, resolvedRoot); err != nil {
+				return "", fmt.Errorf("dest %q rendered to %q: %s", config.Dest, dest, err)
+			}
+		}
+		return dest, nil
+	}
+
+	groups := []fanOutGroup{}
+	if config.FanOut == FanOutContainer {
+		for _, container := range containers {
+			dest, err := renderDest(container)
+			if err != nil {
+				return nil, err
+			}
+			groups = append(groups, fanOutGroup{dest, Context{container}})
+		}
+		return groups, nil
+	}
+
+	byKey := map[string]Context{}
+	for _, container := range containers {
+		value := deepGet(*container, config.FanOut)
+		if value == nil || fmt.Sprint(value) == "" {
+			continue
+		}
+		key := fmt.Sprint(value)
+		byKey[key] = append(byKey[key], container)
+	}
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		dest, err := renderDest(key)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, fanOutGroup{dest, byKey[key]})
+	}
+	return groups, nil
+}
+
+// generateFanOut writes the renderings of a fan_out config, and removes the
+// files it wrote in the previous generation that no longer have containers.
+// It returns whether any file changed.
+func (g *generator) generateFanOut(config Config, containers Context) (bool, error) {
+	groups, err := fanOutGroups(config, filterContainers(config, containers), g.DestRoot)
+	if err != nil {
+		logErrorf("%s. Leaving the files of '%s' unchanged\n", err, config.Dest)
+		g.recordError(config, err)
+		return false, err
+	}
+
+	changed := false
+	var renderErr error
+	dests := map[string]bool{}
+	for _, group := range groups {
+		if dests[group.dest] {
+			logWarnf("Several renderings of '%s' write to '%s'; keeping the last one", config.Dest, group.dest)
+		}
+		dests[group.dest] = true
+		groupConfig := config
+		groupConfig.Dest = group.dest
+		groupChanged, err := g.renderFile(groupConfig, group.containers)
+		if err != nil && renderErr == nil {
+			renderErr = err
+		}
+		if groupChanged {
+			changed = true
+		}
+	}
+
+	key := config.Template + ":" + config.Dest
+	g.fanOutMu.Lock()
+	defer g.fanOutMu.Unlock()
+	if g.fanOutDests == nil {
+		g.fanOutDests = make(map[string]map[string]bool)
+	}
+	for dest := range g.fanOutDests[key] {
+		if dests[dest] {
+			continue
+		}
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			logErrorf("Unable to remove '%s': %s\n", dest, err)
+			continue
+		}
+		logInfof("Removed '%s'", dest)
+		changed = true
+	}
+	g.fanOutDests[key] = dests
+	return changed, renderErr
+}
+
+// generateFile renders config, once per container or group for fan_out
+// configs, and returns whether the output changed and the first error
+// rendering it
+func (g *generator) generateFile(config Config, containers Context) (bool, error) {
+	containers = g.withStats(config, containers)
+	if config.FanOut != "" {
+		return g.generateFanOut(config, containers)
+	}
+	return g.renderFile(config, containers)
+}
@@ -0,0 +1,80 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateFanOut(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmplPath := filepath.Join(dir, "vhost.tmpl")
+	if err := ioutil.WriteFile(tmplPath, []byte(`{{range .}}{{.Name}} {{.Env.VIRTUAL_HOST}}{{end}}`), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	web := &RuntimeContainer{ID: "1", Name: "web", State: State{Running: true}, Env: map[string]string{"VIRTUAL_HOST": "example.com"}}
+	api := &RuntimeContainer{ID: "2", Name: "api", State: State{Running: true}, Env: map[string]string{"VIRTUAL_HOST": "api.example.com"}}
+	config := Config{Template: tmplPath, Dest: filepath.Join(dir, "{{ .Name }}.conf"), FanOut: FanOutContainer}
+	g := &generator{}
+
+	if changed, err := g.generateFile(config, Context{web, api}); err != nil || !changed {
+		t.Fatalf("Expected the files to be generated, got %v", err)
+	}
+	for name, expected := range map[string]string{"web.conf": "web example.com", "api.conf": "api api.example.com"} {
+		if contents, _ := ioutil.ReadFile(filepath.Join(dir, name)); string(contents) != expected {
+			t.Errorf("expected %s to contain %q, got %q", name, expected, contents)
+		}
+	}
+
+	if changed, _ := g.generateFile(config, Context{web, api}); changed {
+		t.Error("Expected unchanged files not to be reported as changed")
+	}
+	if changed, _ := g.generateFile(config, Context{web}); !changed {
+		t.Error("Expected the removal of a file to be reported as a change")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "api.conf")); !os.IsNotExist(err) {
+		t.Errorf("Expected the file of the removed container to be removed, got %v", err)
+	}
+
+	config = Config{Template: tmplPath, Dest: filepath.Join(dir, "{{ . }}.host"), FanOut: "Env.VIRTUAL_HOST"}
+	if changed, err := g.generateFile(config, Context{web, api}); err != nil || !changed {
+		t.Fatalf("Expected the grouped files to be generated, got %v", err)
+	}
+	if contents, _ := ioutil.ReadFile(filepath.Join(dir, "api.example.com.host")); string(contents) != "api api.example.com" {
+		t.Errorf("unexpected contents of the group: %q", contents)
+	}
+
+	config.Dest = filepath.Join(dir, "{{ .Labels.site }}.conf")
+	api.Labels = map[string]string{"site": "../escape"}
+	config.FanOut = FanOutContainer
+	if _, err := fanOutGroups(config, Context{api}, ""); err == nil {
+		t.Error("Expected a dest leaving its directory to fail")
+	}
+
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	config.Dest = "{{ .Labels.site }}"
+	api.Labels = map[string]string{"site": filepath.Join(root, "api.conf")}
+	if _, err := fanOutGroups(config, Context{api}, root); err != nil {
+		t.Errorf("Expected a dest inside the dest root to be rendered, got %v", err)
+	}
+	api.Labels["site"] = filepath.Join(dir, "api.conf")
+	if _, err := fanOutGroups(config, Context{api}, root); err == nil {
+		t.Error("Expected a dest rendered outside of the dest root to fail")
+	}
+	g.DestRoot = root
+	if changed, err := g.generateFile(config, Context{api}); changed || err == nil {
+		t.Error("Expected the generation of a dest outside of the dest root to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "api.conf")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file outside of the dest root, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package dockergen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"plugin"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// FuncConfig declares site-specific template functions in a [[func]]
+// section: either the function Name implemented by the command Exec, or all
+// functions of the TemplateFuncs variable of the Go plugin Plugin.
+type FuncConfig struct {
+	Name    string
+	Exec    string
+	Args    []string
+	Timeout string
+	Plugin  string
+}
+
+// funcPluginSymbol is the variable of Go plugins holding their functions,
+// e.g. var TemplateFuncs = template.FuncMap{"ipam": lookupIPAM}
+const funcPluginSymbol = "TemplateFuncs"
+
+// execFuncRequest is written as JSON to the stdin of exec functions, which
+// write the JSON encoded result to stdout
+type execFuncRequest struct {
+	Function string        `json:"function"`
+	Args     []interface{} `json:"args"`
+}
+
+var (
+	customFuncsMu sync.RWMutex
+	customFuncs   = template.FuncMap{}
+)
+
+// startFuncs registers the functions of the [[func]] sections for all
+// templates
+func startFuncs(configs []FuncConfig) error {
+	funcs := template.FuncMap{}
+	for _, config := range configs {
+		switch {
+		case config.Plugin != "" && config.Exec == "":
+			loaded, err := loadFuncPlugin(config.Plugin)
+			if err != nil {
+				return err
+			}
+			for name, fn := range loaded {
+				funcs[name] = fn
+			}
+		case config.Exec != "" && config.Plugin == "" && config.Name != "":
+			timeout := time.Duration(0)
+			if config.Timeout != "" {
+				var err error
+				if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout < 0 {
+					return fmt.Errorf("Invalid timeout %q of func %s: must be a duration such as \"5s\"", config.Timeout, config.Name)
+				}
+			}
+			funcs[config.Name] = execFunc(config, timeout)
+		default:
+			return fmt.Errorf("Func %q requires either a name and an exec command, or a plugin", config.Name)
+		}
+	}
+	for name := range funcs {
+		if _, ok := templateFuncs[name]; ok {
+			return fmt.Errorf("Func %s is already defined by docker-gen", name)
+		}
+	}
+
+	customFuncsMu.Lock()
+	customFuncs = funcs
+	customFuncsMu.Unlock()
+	return nil
+}
+
+func stopFuncs() {
+	customFuncsMu.Lock()
+	customFuncs = template.FuncMap{}
+	customFuncsMu.Unlock()
+}
+
+// templateCustomFuncs returns the functions registered by startFuncs
+func templateCustomFuncs() template.FuncMap {
+	customFuncsMu.RLock()
+	defer customFuncsMu.RUnlock()
+	return customFuncs
+}
+
+// loadFuncPlugin returns the functions of the Go plugin at path
+func loadFuncPlugin(path string) (template.FuncMap, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load func plugin %s: %s", path, err)
+	}
+	symbol, err := p.Lookup(funcPluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load func plugin %s: %s", path, err)
+	}
+	var funcs map[string]interface{}
+	switch s := symbol.(type) {
+	case *template.FuncMap:
+		funcs = *s
+	case *map[string]interface{}:
+		funcs = *s
+	default:
+		return nil, fmt.Errorf("Unable to load func plugin %s: %s must be a template.FuncMap, not %T", path, funcPluginSymbol, symbol)
+	}
+	for name, fn := range funcs {
+		if reflect.TypeOf(fn).Kind() != reflect.Func {
+			return nil, fmt.Errorf("Unable to load func plugin %s: %s is not a function", path, name)
+		}
+	}
+	logInfof("Loaded %d template functions from %s", len(funcs), path)
+	return funcs, nil
+}
+
+// execFunc returns a template function running the command of config with
+// the function name and arguments as JSON on stdin, and decoding its stdout
+// as the result
+func execFunc(config FuncConfig, timeout time.Duration) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if args == nil {
+			args = []interface{}{}
+		}
+		request, err := json.Marshal(execFuncRequest{Function: config.Name, Args: args})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", config.Name, err)
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.Command(config.Exec, config.Args...)
+		cmd.Stdin = bytes.NewReader(request)
+		cmd.Stderr = &stderr
+		out, err := runFuncCommand(cmd, timeout)
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("%s: %s: %s", config.Name, err, msg)
+			}
+			return nil, fmt.Errorf("%s: %s", config.Name, err)
+		}
+
+		var result interface{}
+		if err := json.Unmarshal(out, &result); err != nil {
+			return nil, fmt.Errorf("%s: invalid result: %s", config.Name, err)
+		}
+		return result, nil
+	}
+}
+
+// runFuncCommand returns the stdout of cmd, which is killed with the
+// processes it started after timeout
+func runFuncCommand(cmd *exec.Cmd, timeout time.Duration) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		err := cmd.Wait()
+		return stdout.Bytes(), err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return stdout.Bytes(), err
+	case <-time.After(timeout):
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return nil, fmt.Errorf("killed after %s", timeout)
+	}
+}
@@ -0,0 +1,62 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecFuncs(t *testing.T) {
+	err := startFuncs([]FuncConfig{
+		// echoes the request, which is a valid JSON result
+		{Name: "echo", Exec: "/bin/sh", Args: []string{"-c", "cat"}},
+		{Name: "fail", Exec: "/bin/sh", Args: []string{"-c", "echo no such subnet >&2; exit 3"}},
+		{Name: "slow", Exec: "/bin/sh", Args: []string{"-c", "sleep 5"}, Timeout: "100ms"},
+	})
+	if err != nil {
+		t.Fatalf("Unable to start funcs: %v", err)
+	}
+	defer stopFuncs()
+
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	render := func(tmpl string) (string, error) {
+		tmplPath := filepath.Join(dir, "test.tmpl")
+		if err := ioutil.WriteFile(tmplPath, []byte(tmpl), 0644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+		contents, err := executeTemplate(Config{Template: tmplPath}, Context{}, 0)
+		return string(contents), err
+	}
+
+	contents, err := render(`{{$r := echo "10.0.0.0/24" 2}}{{$r.function}} {{index $r.args 0}} {{index $r.args 1}}`)
+	if err != nil || contents != "echo 10.0.0.0/24 2" {
+		t.Fatalf("Expected the echoed request, got %q, %v", contents, err)
+	}
+	if _, err := render(`{{fail}}`); err == nil || !strings.Contains(err.Error(), "no such subnet") {
+		t.Fatalf("Expected the stderr of the failed command, got %v", err)
+	}
+	if _, err := render(`{{slow}}`); err == nil || !strings.Contains(err.Error(), "killed after 100ms") {
+		t.Fatalf("Expected the command to be killed, got %v", err)
+	}
+}
+
+func TestStartFuncsErrors(t *testing.T) {
+	defer stopFuncs()
+	for _, configs := range [][]FuncConfig{
+		{{Name: "first", Exec: "/bin/true"}},
+		{{Exec: "/bin/true"}},
+		{{Name: "lookup", Exec: "/bin/true", Plugin: "/lib/funcs.so"}},
+		{{Name: "lookup", Exec: "/bin/true", Timeout: "soon"}},
+		{{Plugin: "/nonexistent/funcs.so"}},
+	} {
+		if err := startFuncs(configs); err == nil {
+			t.Errorf("Expected an error for %+v", configs)
+		}
+	}
+}
@@ -1,11 +1,17 @@
 package dockergen
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/exec"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -18,313 +24,958 @@ type generator struct {
 	Client                     *docker.Client
 	Configs                    ConfigFile
 	Endpoint                   string
+	ExtraHosts                 []dockerHost
 	TLSVerify                  bool
 	TLSCert, TLSCaCert, TLSKey string
 	All                        bool
+	PingInterval               time.Duration
+	PingTimeout                time.Duration
+	ControlSocket              string
+	ConsulAddr                 string
+	EtcdEndpoint               string
+	EtcdPrefix                 string
+	ComposeFiles               []string
+	ConfigFiles                []string
+	PollInterval               time.Duration
+	MaxJobs                    int
+	InspectJobs                int
+	InspectCacheTTL            time.Duration
+	ReconnectInterval          time.Duration
+	ReconnectMaxInterval       time.Duration
+	ReconnectAttempts          int
+	ClientOptions              DockerClientOptions
+	APITimeout                 time.Duration
+	HTTPAddr                   string
+	HTTPToken                  string
+	StateFile                  string
+	ReadOnly                   bool
+	DestRoot                   string
+	NotifyInterval             time.Duration
+	ResyncInterval             time.Duration
+
+	publisher *publisher
+
+	// vault is used by the vaultSecret template function; it is nil unless
+	// docker-gen is configured with a Vault address
+	vault *vaultClient
+	// containerStreamer inspects the containers of config in batches of
+	// size, stopping early when done is closed
+	containerStreamer func(config Config, size int, done <-chan struct{}) <-chan Context
+
+	// configsMu guards Configs, which are replaced by config reloads
+	configsMu sync.RWMutex
+
+	// podman is set when Endpoint is Podman's Docker-compatible API
+	podman bool
 
 	wg    sync.WaitGroup
 	retry bool
+
+	// terminated is set when docker-gen is stopped by SIGTERM
+	terminated bool
+
+	deltaMu        sync.Mutex
+	lastContainers map[string]Context
+
+	// configLocks serialize the generations of each config, whichever
+	// trigger started them
+	configLocksMu sync.Mutex
+	configLocks   map[string]*sync.Mutex
+
+	// configHosts are the docker daemons of the endpoints of configs
+	configHosts []dockerHost
+	// clientsMu guards Client and the hosts of ExtraHosts and configHosts,
+	// whose clients are replaced when their connection is lost
+	clientsMu sync.RWMutex
+
+	inspections inspectCache
+	store       containerStore
+	images      imageCache
+	stats       statsCache
+	statuses    statusStore
+
+	// hostStates are the event connections of the docker hosts
+	hostsMu    sync.Mutex
+	hostStates map[string]*hostState
+
+	// fanOutDests are the files written by each fan_out config
+	fanOutMu    sync.Mutex
+	fanOutDests map[string]map[string]bool
+
+	notifyLimit notifyLimiter
+
+	// dnsProviders are the DNS providers of the configs with dns_provider
+	dnsMu        sync.Mutex
+	dnsProviders map[string]dnsProvider
+
+	locks []*os.File
+
+	stopMu  sync.Mutex
+	stop    chan struct{}
+	stopped bool
+
+	// reloadConfig loads the configs again from ConfigFiles; the configs it
+	// returned are reloadedConfigs until Generate restarts with them
+	reloadConfig    func() (ConfigFile, error)
+	reloadedConfigs *ConfigFile
 }
 
 type GeneratorConfig struct {
 	Endpoint string
 
+	// Endpoints are additional docker daemons whose containers are merged
+	// with those of Endpoint into the template context
+	Endpoints []string
+
 	TLSCert   string
 	TLSKey    string
 	TLSCACert string
 	TLSVerify bool
 	All       bool
 
+	// PingInterval is how long the event loop waits for an event before
+	// checking the daemon's liveness; PingTimeout bounds each ping.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+
+	// ClientOptions tune the connections to the docker daemon; APITimeout
+	// bounds each container list and inspect call
+	ClientOptions DockerClientOptions
+	APITimeout    time.Duration
+
+	// PollInterval, when set, replaces the docker event stream by listing
+	// the containers at this interval
+	PollInterval time.Duration
+
+	// ReconnectInterval is the first wait before reconnecting to a docker
+	// daemon, doubled after each failed attempt up to ReconnectMaxInterval.
+	// After ReconnectAttempts consecutive failures (0 for no limit), the
+	// events of the daemon are no longer watched.
+	ReconnectInterval    time.Duration
+	ReconnectMaxInterval time.Duration
+	ReconnectAttempts    int
+
+	// MaxJobs bounds how many configs are generated concurrently on
+	// intervals, docker events and signals
+	MaxJobs int
+
+	// InspectJobs bounds how many containers are inspected concurrently
+	// when listing them
+	InspectJobs int
+
+	// InspectCacheTTL, when set, caches container inspections while configs
+	// watch docker events, until an event of the container arrives or for
+	// at most this duration
+	InspectCacheTTL time.Duration
+
+	// ControlSocket is the path of a unix socket accepting trigger commands
+	ControlSocket string
+
+	// ConsulAddr is the address of a Consul agent whose catalog is merged
+	// into the template context
+	ConsulAddr string
+
+	// EtcdEndpoint is the address of an etcd v3 server whose keys below
+	// EtcdPrefix are merged into the template context
+	EtcdEndpoint string
+	EtcdPrefix   string
+
+	// VaultAddr is the address of the Vault server used by vaultSecret
+	VaultAddr string
+
+	// ComposeFiles are docker-compose files whose projects are available to
+	// templates; they are parsed again on each generation
+	ComposeFiles []string
+
+	// PublishURL is a nats:// or mqtt:// URL whose subject or topic receives
+	// an event after each generation
+	PublishURL string
+
+	// HTTPAddr is the listen address of the HTTP endpoints; HTTPToken is the
+	// bearer token they require
+	HTTPAddr  string
+	HTTPToken string
+
+	// StateFile receives the state of the generator on SIGUSR1 instead of
+	// the log
+	StateFile string
+
+	// ReadOnly refuses configs requiring docker API calls other than reads,
+	// such as signalling or exec in containers
+	ReadOnly bool
+
+	// DestRoot, when set, is the directory the dests of fan_out configs
+	// must be in once rendered; the other dests are checked by
+	// ConfigFile.CheckDestRoot
+	DestRoot string
+
+	// NotifyInterval is the minimum interval between the notifications of
+	// all configs; those inside it are delayed and coalesced
+	NotifyInterval time.Duration
+
+	// ResyncInterval, when set, updates the containers from the docker
+	// events of their own instead of listing them on each event, and lists
+	// the containers of all hosts every ResyncInterval
+	ResyncInterval time.Duration
+
+	// ConfigFiles are the files ConfigFile was loaded from. When set with
+	// ReloadConfig, which loads them again, changes to them and SIGUSR2
+	// reload the configs without restarting docker-gen.
+	ConfigFiles  []string
+	ReloadConfig func() (ConfigFile, error)
+
+	// LogLevel is the minimum level of the logged messages (default info)
+	// and LogFormat is "text" (default) or "json"
+	LogLevel  string
+	LogFormat string
+
 	ConfigFile ConfigFile
 }
 
+const (
+	defaultPingInterval = 10 * time.Second
+	defaultPingTimeout  = 5 * time.Second
+)
+
 func NewGenerator(gc GeneratorConfig) (*generator, error) {
+	level := LogInfo
+	if gc.LogLevel != "" {
+		var err error
+		if level, err = ParseLogLevel(gc.LogLevel); err != nil {
+			return nil, err
+		}
+	}
+	if err := SetLogging(level, gc.LogFormat); err != nil {
+		return nil, err
+	}
+
 	endpoint, err := GetEndpoint(gc.Endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("Bad endpoint: %s", err)
 	}
+	if gc.ReadOnly {
+		if err := checkReadOnly(gc.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkStream(gc.ConfigFile); err != nil {
+		return nil, err
+	}
 
-	client, err := NewDockerClient(endpoint, gc.TLSVerify, gc.TLSCert, gc.TLSCACert, gc.TLSKey)
+	client, err := NewDockerClientWithOptions(endpoint, gc.TLSVerify, gc.TLSCert, gc.TLSCACert, gc.TLSKey, gc.ClientOptions)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to create docker client: %s", err)
 	}
 
+	extraHosts, err := newDockerHosts(gc)
+	if err != nil {
+		return nil, err
+	}
+
 	apiVersion, err := client.Version()
 	if err != nil {
-		log.Printf("Error retrieving docker server version info: %s\n", err)
+		logErrorf("Error retrieving docker server version info: %s\n", err)
 	}
 
 	// Grab the docker daemon info once and hold onto it
 	SetDockerEnv(apiVersion)
+	podman := isPodman(apiVersion)
+	if podman {
+		logInfof("Connected to Podman: Swarm services, tasks and nodes are not inspected")
+	}
+
+	var vault *vaultClient
+	if gc.VaultAddr != "" {
+		vault = newVaultClient(gc.VaultAddr)
+	}
 
-	return &generator{
-		Client:    client,
-		Endpoint:  gc.Endpoint,
-		TLSVerify: gc.TLSVerify,
-		TLSCert:   gc.TLSCert,
-		TLSCaCert: gc.TLSCACert,
-		TLSKey:    gc.TLSKey,
-		All:       gc.All,
-		Configs:   gc.ConfigFile,
-		retry:     true,
-	}, nil
+	var pub *publisher
+	if gc.PublishURL != "" {
+		if pub, err = newPublisher(gc.PublishURL); err != nil {
+			return nil, err
+		}
+	}
+
+	g := &generator{
+		Client:               client,
+		Endpoint:             gc.Endpoint,
+		ExtraHosts:           extraHosts,
+		podman:               podman,
+		TLSVerify:            gc.TLSVerify,
+		TLSCert:              gc.TLSCert,
+		TLSCaCert:            gc.TLSCACert,
+		TLSKey:               gc.TLSKey,
+		All:                  gc.All,
+		PingInterval:         gc.PingInterval,
+		PingTimeout:          gc.PingTimeout,
+		PollInterval:         gc.PollInterval,
+		MaxJobs:              gc.MaxJobs,
+		InspectJobs:          gc.InspectJobs,
+		InspectCacheTTL:      gc.InspectCacheTTL,
+		ReconnectInterval:    gc.ReconnectInterval,
+		ReconnectMaxInterval: gc.ReconnectMaxInterval,
+		ReconnectAttempts:    gc.ReconnectAttempts,
+		ClientOptions:        gc.ClientOptions,
+		APITimeout:           gc.APITimeout,
+		ControlSocket:        gc.ControlSocket,
+		ConsulAddr:           gc.ConsulAddr,
+		EtcdEndpoint:         gc.EtcdEndpoint,
+		EtcdPrefix:           gc.EtcdPrefix,
+		ComposeFiles:         gc.ComposeFiles,
+		HTTPAddr:             gc.HTTPAddr,
+		HTTPToken:            gc.HTTPToken,
+		StateFile:            gc.StateFile,
+		ReadOnly:             gc.ReadOnly,
+		DestRoot:             gc.DestRoot,
+		NotifyInterval:       gc.NotifyInterval,
+		ResyncInterval:       gc.ResyncInterval,
+		publisher:            pub,
+		vault:                vault,
+		Configs:              gc.ConfigFile,
+		ConfigFiles:          gc.ConfigFiles,
+		reloadConfig:         gc.ReloadConfig,
+		retry:                true,
+	}
+	g.containerStreamer = g.streamContainers
+	return g, nil
 }
 
+// Generate generates the configs and keeps regenerating them on their
+// triggers until docker-gen is stopped. When configs are reloaded, all
+// triggers are stopped and started again with the new configs.
 func (g *generator) Generate() error {
-	g.generateFromContainers()
-	g.generateAtInterval()
-	g.generateFromEvents()
-	g.generateFromSignals()
-	g.wg.Wait()
+	reason := "startup"
+	for {
+		if err := g.generate(reason); err != nil {
+			return err
+		}
 
-	return nil
+		g.stopMu.Lock()
+		configs := g.reloadedConfigs
+		g.reloadedConfigs = nil
+		restart := configs != nil && !g.stopped && !g.terminated
+		if restart {
+			g.stop = nil
+		}
+		g.stopMu.Unlock()
+		if !restart {
+			return nil
+		}
+		g.setConfigs(*configs)
+		reason = "config reload"
+	}
 }
 
-func (g *generator) generateFromSignals() {
-	var hasWatcher bool
-	for _, config := range g.Configs.Config {
-		if config.Watch {
-			hasWatcher = true
-			break
-		}
+// configs returns a copy of the current configs. They are replaced by config
+// reloads between generation cycles, while the state dump, control socket
+// and HTTP triggers may read them.
+func (g *generator) configs() *ConfigFile {
+	g.configsMu.RLock()
+	defer g.configsMu.RUnlock()
+	configs := g.Configs
+	return &configs
+}
+
+// setConfigs replaces the configs, e.g. with the reloaded config files
+func (g *generator) setConfigs(configs ConfigFile) {
+	g.configsMu.Lock()
+	defer g.configsMu.Unlock()
+	g.Configs = configs
+}
+
+func (g *generator) generate(reason string) error {
+	if err := g.lockDests(); err != nil {
+		return err
 	}
+	defer g.unlockDests()
 
-	// If none of the configs need to watch for events, don't watch for signals either
-	if !hasWatcher {
-		return
+	if err := startPlugins(g.configs().Plugin); err != nil {
+		stopPlugins()
+		return err
+	}
+	defer stopPlugins()
+	if err := startFuncs(g.configs().Func); err != nil {
+		return err
+	}
+	defer stopFuncs()
+	if err := g.connectConfigHosts(); err != nil {
+		return err
 	}
 
-	g.wg.Add(1)
-	go func() {
-		defer g.wg.Done()
+	consulIndex := g.loadConsul()
+	etcdRevision := g.loadEtcd()
 
-		sigChan := newSignalChannel()
-		for {
-			sig := <-sigChan
-			log.Printf("Received signal: %s\n", sig)
-			switch sig {
-			case syscall.SIGHUP:
-				g.generateFromContainers()
-			case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
-				// exit when context is done
-				return
-			}
-		}
-	}()
+	if err := g.generateFromContainers(reason); err != nil && !g.keepsRunning() {
+		// one-shot runs fail, leaving the dests that couldn't be generated
+		// unchanged
+		return err
+	}
+	g.startScheduler()
+	g.generateFromFiles()
+	g.watchConfigFiles()
+	g.watchStateSignal()
+	g.generateFromControlSocket()
+	g.serveHTTP()
+	g.generateFromConsul(consulIndex)
+	g.generateFromEtcd(etcdRevision)
+	g.generateFromVault()
+	g.resyncPeriodically()
+	g.watchTermination()
+	g.wg.Wait()
+	g.drain()
+	if g.publisher != nil {
+		// one-shot runs exit right after
+		g.publisher.flush()
+	}
+
+	return nil
 }
 
-func (g *generator) generateFromContainers() {
-	containers, err := g.getContainers()
-	if err != nil {
-		log.Printf("Error listing containers: %s\n", err)
-		return
-	}
-	for _, config := range g.Configs.Config {
-		changed := GenerateFile(config, containers)
-		if !changed {
-			log.Printf("Contents of %s did not change. Skipping notification '%s'", config.Dest, config.NotifyCmd)
+// lockDests locks the destinations of all configs with Lock set
+func (g *generator) lockDests() error {
+	for _, config := range g.configs().Config {
+		if !config.Lock || config.Dest == "" || isRemoteDest(config.Dest) {
 			continue
 		}
-		g.runNotifyCmd(config)
-		g.sendSignalToContainer(config)
-		g.sendSignalToService(config)
+		if err := ensureDestDir(config); err != nil {
+			g.unlockDests()
+			return err
+		}
+		lock, err := lockDest(config.Dest)
+		if err != nil {
+			g.unlockDests()
+			return err
+		}
+		g.locks = append(g.locks, lock)
 	}
+	return nil
 }
 
-func (g *generator) generateAtInterval() {
-	for _, config := range g.Configs.Config {
+func (g *generator) unlockDests() {
+	for _, lock := range g.locks {
+		lock.Close()
+	}
+	g.locks = nil
+}
 
-		if config.Interval == 0 {
-			continue
+// generateFromContainers generates all configs from a single container
+// listing; reason is mentioned in provenance headers. It returns the error of
+// the listing or of the first config that could not be generated.
+func (g *generator) generateFromContainers(reason string) error {
+	containers, errs, err := g.getContainers()
+	if err != nil {
+		logErrorf("Error listing containers: %s\n", err)
+		return fmt.Errorf("Error listing containers: %s", err)
+	}
+	var generateErr error
+	for _, config := range g.configs().Config {
+		config.trigger = reason
+		if err := g.generateConfig(config, containers, errs, false); err != nil && generateErr == nil {
+			generateErr = fmt.Errorf("Unable to generate '%s': %s", config.Dest, err)
 		}
+	}
+	return generateErr
+}
 
-		log.Printf("Generating every %d seconds", config.Interval)
-		g.wg.Add(1)
-		ticker := time.NewTicker(time.Duration(config.Interval) * time.Second)
-		go func(config Config) {
-			defer g.wg.Done()
-
-			sigChan := newSignalChannel()
-			for {
-				select {
-				case <-ticker.C:
-					containers, err := g.getContainers()
-					if err != nil {
-						log.Printf("Error listing containers: %s\n", err)
-						continue
-					}
-					// ignore changed return value. always run notify command
-					GenerateFile(config, containers)
-					g.runNotifyCmd(config)
-					g.sendSignalToContainer(config)
-					g.sendSignalToService(config)
-				case sig := <-sigChan:
-					log.Printf("Received signal: %s\n", sig)
-					switch sig {
-					case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
-						ticker.Stop()
-						return
-					}
-				}
-			}
-		}(config)
+// lockConfig locks the generations of config and returns the function
+// unlocking them
+func (g *generator) lockConfig(config Config) func() {
+	key := config.Template + ":" + config.Dest
+
+	g.configLocksMu.Lock()
+	if g.configLocks == nil {
+		g.configLocks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := g.configLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		g.configLocks[key] = lock
 	}
+	g.configLocksMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
 }
 
-func (g *generator) generateFromEvents() {
-	configs := g.Configs.FilterWatches()
-	if len(configs.Config) == 0 {
-		return
+// generateConfig renders config from containers, whose listing encountered
+// errs, and runs its notifications. Notifications are skipped when the
+// output did not change unless alwaysNotify is set. The error rendering or
+// writing dest, which is then left unchanged, is returned.
+func (g *generator) generateConfig(config Config, containers Context, errs []string, alwaysNotify bool) error {
+	defer g.lockConfig(config)()
+	return g.generateConfigLocked(config, containers, errs, alwaysNotify)
+}
+
+// generateConfigLocked is generateConfig with the lock of config held by the
+// caller
+func (g *generator) generateConfigLocked(config Config, containers Context, errs []string, alwaysNotify bool) error {
+	config.contextErrors = errs
+	partialFailure, err := config.PartialFailureMode()
+	if err != nil {
+		logErrorf("%s. Rendering %s with partial container meta-data\n", err, config.Dest)
+		g.recordError(config, err)
+	}
+	if len(errs) > 0 && partialFailure == PartialFailureSkip {
+		logWarnf("Skipping generation of %s: %d error(s) retrieving container meta-data", config.Dest, len(errs))
+		return nil
 	}
 
-	client := g.Client
-	var watchers []chan *docker.APIEvents
+	// the delta is only recorded once it was notified, so the changes of a
+	// failed generation are notified by the next one
+	delta := g.containerDelta(config, containers)
+	changed, err := g.generateFile(config, containers)
+	g.publishGeneration(config, changed)
+	if err != nil {
+		return err
+	}
+	if !changed && !alwaysNotify {
+		logDebugf("Contents of %s did not change. Skipping notification '%s'", config.Dest, config.NotifyCmd)
+		return nil
+	}
+	if len(errs) > 0 && partialFailure == PartialFailureNoNotify {
+		logWarnf("Generated %s from partial container meta-data. Skipping notification '%s'", config.Dest, config.NotifyCmd)
+		return nil
+	}
+	g.notify(config, delta, containers, changed, alwaysNotify)
+	return nil
+}
 
-	for _, config := range configs.Config {
+// runNotifications runs all notifications of config. Once the notify command
+// and request succeeded, containers are the baseline of the next delta.
+func (g *generator) runNotifications(config Config, delta ContainerDelta, containers Context, changed bool) {
+	cmdErr := g.runNotifyCmd(config, delta, changed)
+	httpErr := g.notifyHTTP(config, delta, containers)
+	if cmdErr == nil && httpErr == nil {
+		g.updateDelta(config, containers)
+	}
+	notifyPlugins(config)
+	g.updateDNS(config, delta, containers)
+	g.sendSignalToContainer(config)
+	g.signalFilteredContainers(config)
+	g.signalNotifyProcesses(config)
+	g.execInNotifyContainers(config)
+	g.sendSignalToService(config)
+	g.restartNotifyContainers(config)
+	g.restartNotifyServices(config)
+}
 
-		if !config.Watch {
-			continue
-		}
+// nextInterval returns the delay until the next interval generation of config.
+// With IntervalAlign the delay ends on a wall clock multiple of the interval,
+// and IntervalJitter adds a random delay of up to that many seconds so a fleet
+// of instances doesn't hit the docker daemons at the same moment.
+func nextInterval(config Config, now time.Time) time.Duration {
+	interval := time.Duration(config.Interval) * time.Second
+	delay := interval
+	if config.IntervalAlign {
+		delay = interval - time.Duration(now.UnixNano()%int64(interval))
+	}
+	if config.IntervalJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(time.Duration(config.IntervalJitter) * time.Second)))
+	}
+	return delay
+}
 
-		g.wg.Add(1)
+// watchEvents maintains the connection to host and passes its start, stop,
+// die, health_status, network connect and disconnect and volume create and
+// destroy events to the scheduler until docker-gen is stopped, or until the
+// connection is lost without retry
+func (g *generator) watchEvents(host dockerHost, events chan<- TriggerEvent) {
+	client := host.Client
+	// channel will be closed by go-dockerclient
+	eventChan := make(chan *docker.APIEvents, 100)
+	sigChan := g.newSignalChannel()
+	retry := g.newBackoff()
+	wantsEvent := func(event *docker.APIEvents) bool {
+		for _, config := range g.configs().Config {
+			if config.WantsEvent(hostTriggerEvent(host, event)) {
+				return true
+			}
+		}
+		return false
+	}
 
-		go func(config Config, watcher chan *docker.APIEvents) {
-			defer g.wg.Done()
-			watchers = append(watchers, watcher)
+	for {
+		watching := false
 
-			debouncedChan := newDebounceChannel(watcher, config.Wait)
-			for _ = range debouncedChan {
-				containers, err := g.getContainers()
-				if err != nil {
-					log.Printf("Error listing containers: %s\n", err)
-					continue
+		if client == nil {
+			var err error
+			endpoint, err := GetEndpoint(host.Endpoint)
+			if err != nil {
+				logErrorf("Bad endpoint: %s", err)
+				if !g.reconnectWait(retry, host) {
+					close(events)
+					return
 				}
-				changed := GenerateFile(config, containers)
-				if !changed {
-					log.Printf("Contents of %s did not change. Skipping notification '%s'", config.Dest, config.NotifyCmd)
-					continue
+				continue
+			}
+			client, err = g.newHostClient(host, endpoint)
+			if err != nil {
+				logErrorf("Unable to connect to docker daemon: %s", err)
+				if !g.reconnectWait(retry, host) {
+					close(events)
+					return
 				}
-				g.runNotifyCmd(config)
-				g.sendSignalToContainer(config)
-				g.sendSignalToService(config)
+				continue
 			}
-		}(config, make(chan *docker.APIEvents, 100))
-	}
-
-	// maintains docker client connection and passes events to watchers
-	go func() {
-		// channel will be closed by go-dockerclient
-		eventChan := make(chan *docker.APIEvents, 100)
-		sigChan := newSignalChannel()
+			host.Client = client
+			g.setHostClient(host.Endpoint, client)
+		}
 
 		for {
-			watching := false
-
 			if client == nil {
-				var err error
-				endpoint, err := GetEndpoint(g.Endpoint)
-				if err != nil {
-					log.Printf("Bad endpoint: %s", err)
-					time.Sleep(10 * time.Second)
-					continue
-				}
-				client, err = NewDockerClient(endpoint, g.TLSVerify, g.TLSCert, g.TLSCaCert, g.TLSKey)
-				if err != nil {
-					log.Printf("Unable to connect to docker daemon: %s", err)
-					time.Sleep(10 * time.Second)
+				break
+			}
+			if !watching {
+				err := client.AddEventListener(eventChan)
+				if err != nil && err != docker.ErrListenerAlreadyExists {
+					logErrorf("Error registering docker event listener: %s", err)
+					if !g.reconnectWait(retry, host) {
+						close(events)
+						return
+					}
 					continue
 				}
+				watching = true
+				g.setWatching(host, true)
+				logInfof("Watching docker events")
+				g.reconnected(retry, host)
+				// sync all configs after resuming listener
+				g.clearInspections(host)
+				g.resyncContainers()
+				g.generateHostConfigs(host, "docker events resumed")
 			}
-
-			for {
-				if client == nil {
-					break
-				}
-				if !watching {
-					err := client.AddEventListener(eventChan)
-					if err != nil && err != docker.ErrListenerAlreadyExists {
-						log.Printf("Error registering docker event listener: %s", err)
-						time.Sleep(10 * time.Second)
-						continue
+			select {
+			case event, ok := <-eventChan:
+				if !ok {
+					logWarnf("Docker daemon connection interrupted")
+					g.setWatching(host, false)
+					if watching {
+						client.RemoveEventListener(eventChan)
+						watching = false
+						client = nil
 					}
-					watching = true
-					log.Println("Watching docker events")
-					// sync all configs after resuming listener
-					g.generateFromContainers()
-				}
-				select {
-				case event, ok := <-eventChan:
-					if !ok {
-						log.Printf("Docker daemon connection interrupted")
-						if watching {
-							client.RemoveEventListener(eventChan)
-							watching = false
-							client = nil
-						}
-						if !g.retry {
-							// close all watchers and exit
-							for _, watcher := range watchers {
-								close(watcher)
-							}
-							return
-						}
-						// recreate channel and attempt to resume
-						eventChan = make(chan *docker.APIEvents, 100)
-						time.Sleep(10 * time.Second)
-						break
+					if !g.retry {
+						close(events)
+						return
 					}
-					if event.Status == "start" || event.Status == "stop" || event.Status == "die" {
-						log.Printf("Received event %s for container %s", event.Status, shortIdent(event.ID))
-						// fanout event to all watchers
-						for _, watcher := range watchers {
-							watcher <- event
-						}
+					// recreate channel and attempt to resume
+					eventChan = make(chan *docker.APIEvents, 100)
+					if !g.reconnectWait(retry, host) {
+						close(events)
+						return
 					}
-				case <-time.After(10 * time.Second):
-					// check for docker liveness
-					err := client.Ping()
-					if err != nil {
-						log.Printf("Unable to ping docker daemon: %s", err)
-						if watching {
-							client.RemoveEventListener(eventChan)
-							watching = false
-							client = nil
-						}
+					break
+				}
+				event = normalizeEvent(event)
+				g.recordEvent(host)
+				g.invalidateInspections(host, event)
+				g.containerChanged(host, event)
+				wanted := false
+				switch {
+				case event.Type == "network" && (event.Action == "connect" || event.Action == "disconnect"):
+					wanted = wantsEvent(event)
+				case event.Type == "volume" && (event.Action == "create" || event.Action == "destroy"):
+					wanted = wantsEvent(event)
+				case event.Type == "" || event.Type == "container":
+					wanted = event.Status == "start" || event.Status == "stop" || event.Status == "die" ||
+						(isHealthEvent(event.Status) && wantsEvent(event))
+				}
+				if wanted {
+					logInfof("Received event %s", describeEvent(event))
+					events <- hostTriggerEvent(host, event)
+				}
+			case <-time.After(g.pingInterval()):
+				// check for docker liveness
+				err := g.ping(client)
+				if err != nil {
+					logWarnf("Unable to ping docker daemon: %s", err)
+					g.setWatching(host, false)
+					if watching {
+						client.RemoveEventListener(eventChan)
+						watching = false
+						client = nil
 					}
-				case sig := <-sigChan:
-					log.Printf("Received signal: %s\n", sig)
-					switch sig {
-					case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
-						// close all watchers and exit
-						for _, watcher := range watchers {
-							close(watcher)
-						}
-						return
+				}
+			case sig := <-sigChan:
+				logInfof("Received signal: %s\n", sig)
+				switch sig {
+				case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+					if watching {
+						client.RemoveEventListener(eventChan)
 					}
+					close(events)
+					return
 				}
 			}
 		}
-	}()
+	}
+}
+
+// pollEvents lists the containers every PollInterval and passes start and
+// stop events synthesized from the differences to the scheduler, for API
+// proxies that block the events endpoint
+func (g *generator) pollEvents(events chan<- TriggerEvent) {
+	sigChan := g.newSignalChannel()
+	ticker := time.NewTicker(g.PollInterval)
+	defer ticker.Stop()
+
+	logInfof("Polling containers every %s", g.PollInterval)
+	// previous are the containers of the last listing of each host
+	previous := map[string]map[string]bool{}
+	poll := func() {
+		for _, host := range g.dockerHosts() {
+			current, err := g.runningContainers(host)
+			if err != nil {
+				logErrorf("Error listing containers of %s: %s\n", host.Endpoint, err)
+				continue
+			}
+			if last, ok := previous[host.Endpoint]; ok {
+				for _, event := range containerStateEvents(last, current) {
+					logInfof("Detected %s of container %s", event.Status, shortIdent(event.ID))
+					events <- hostTriggerEvent(host, event)
+				}
+			}
+			previous[host.Endpoint] = current
+		}
+	}
+	poll()
+	for {
+		select {
+		case <-ticker.C:
+			poll()
+		case sig := <-sigChan:
+			logInfof("Received signal: %s\n", sig)
+			switch sig {
+			case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+				close(events)
+				return
+			}
+		}
+	}
+}
+
+// runningContainers returns whether each container of host is running, by ID
+func (g *generator) runningContainers(host dockerHost) (map[string]bool, error) {
+	ctx, cancel := g.apiContext()
+	apiContainers, err := host.Client.ListContainers(docker.ListContainersOptions{All: true, Context: ctx})
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	running := make(map[string]bool)
+	for _, apiContainer := range apiContainers {
+		running[apiContainer.ID] = apiContainer.State == "running"
+	}
+	return running, nil
+}
+
+// describeEvent returns the action and object of a docker event for the log,
+// e.g. "connect of network frontend for container 4f3c2a1b9d8e"
+func describeEvent(event *docker.APIEvents) string {
+	switch event.Type {
+	case "network":
+		return fmt.Sprintf("%s of network %s for container %s", event.Action, event.Actor.Attributes["name"], shortIdent(event.Actor.Attributes["container"]))
+	case "volume":
+		return fmt.Sprintf("%s of volume %s", event.Action, event.Actor.ID)
+	}
+	return fmt.Sprintf("%s for container %s", event.Status, shortIdent(event.ID))
+}
+
+// isHealthEvent returns whether status is a health_status event, e.g.
+// "health_status: healthy" or "health_status: unhealthy"
+func isHealthEvent(status string) bool {
+	return strings.HasPrefix(status, "health_status")
+}
+
+// containerStateEvents returns a start event for each container that is
+// running in current but wasn't in previous, and a stop event for each
+// container that was running but no longer is or was removed
+func containerStateEvents(previous, current map[string]bool) []*docker.APIEvents {
+	ids := make([]string, 0, len(current))
+	for id := range current {
+		ids = append(ids, id)
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	events := []*docker.APIEvents{}
+	for _, id := range ids {
+		switch {
+		case current[id] && !previous[id]:
+			events = append(events, &docker.APIEvents{ID: id, Status: "start"})
+		case previous[id] && !current[id]:
+			events = append(events, &docker.APIEvents{ID: id, Status: "stop"})
+		}
+	}
+	return events
+}
+
+// containerDelta returns how the containers config is generated from differ
+// from those of its previous notification
+func (g *generator) containerDelta(config Config, containers Context) ContainerDelta {
+	key := config.Template + ":" + config.Dest
+
+	g.deltaMu.Lock()
+	defer g.deltaMu.Unlock()
+	return diffContainers(g.lastContainers[key], filterContainers(config, containers))
 }
 
-func (g *generator) runNotifyCmd(config Config) {
+// updateDelta records the containers config was notified of as the baseline
+// of its next delta
+func (g *generator) updateDelta(config Config, containers Context) {
+	key := config.Template + ":" + config.Dest
+
+	g.deltaMu.Lock()
+	defer g.deltaMu.Unlock()
+	if g.lastContainers == nil {
+		g.lastContainers = make(map[string]Context)
+	}
+	g.lastContainers[key] = filterContainers(config, containers)
+}
+
+func (g *generator) pingInterval() time.Duration {
+	if g.PingInterval <= 0 {
+		return defaultPingInterval
+	}
+	return g.PingInterval
+}
+
+// apiContext returns the context of a docker API call, bounded by APITimeout
+// so a slow daemon can't block a generation forever
+func (g *generator) apiContext() (context.Context, context.CancelFunc) {
+	if g.APITimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), g.APITimeout)
+}
+
+// ping checks the liveness of the docker daemon, giving up after PingTimeout
+// so a hung daemon can't block the event loop
+func (g *generator) ping(client *docker.Client) error {
+	timeout := g.PingTimeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return client.PingWithContext(ctx)
+}
+
+func (g *generator) runNotifyCmd(config Config, delta ContainerDelta, changed bool) error {
 	if config.NotifyCmd == "" {
-		return
+		return nil
+	}
+	timeout, err := config.NotifyDeadline()
+	if err != nil {
+		logErrorf("%s. Skipping notification '%s'\n", err, config.NotifyCmd)
+		return err
 	}
 
-	log.Printf("Running '%s'", config.NotifyCmd)
+	logInfof("Running '%s'", config.NotifyCmd)
 	cmd := exec.Command("/bin/sh", "-c", config.NotifyCmd)
-	out, err := cmd.CombinedOutput()
+	cmd.Env = append(os.Environ(), deltaEnv(delta)...)
+	cmd.Env = append(cmd.Env, triggerEnv(config)...)
+	cmd.Env = append(cmd.Env,
+		"DOCKER_GEN_DEST="+config.Dest,
+		"DOCKER_GEN_FILE_CHANGED="+strconv.FormatBool(changed),
+	)
+
+	if deltaFile, err := writeDeltaFile(delta); err != nil {
+		logErrorf("Unable to write container delta file: %s\n", err)
+	} else {
+		defer os.Remove(deltaFile)
+		cmd.Env = append(cmd.Env, "DOCKER_GEN_DELTA_FILE="+deltaFile)
+	}
+	if eventsFile, err := writeTriggerEventsFile(config); err != nil {
+		logErrorf("Unable to write trigger events file: %s\n", err)
+	} else {
+		defer os.Remove(eventsFile)
+		cmd.Env = append(cmd.Env, "DOCKER_GEN_TRIGGER_EVENTS_FILE="+eventsFile)
+	}
+
+	out, err := runCommand(cmd, timeout)
 	if err != nil {
-		log.Printf("Error running notify command: %s, %s\n", config.NotifyCmd, err)
+		logErrorf("Error running notify command: %s, %s\n", config.NotifyCmd, err)
 	}
 	if config.NotifyOutput {
 		for _, line := range strings.Split(string(out), "\n") {
 			if line != "" {
-				log.Printf("[%s]: %s", config.NotifyCmd, line)
+				logInfof("[%s]: %s", config.NotifyCmd, line)
 			}
 		}
 	}
+	return err
+}
+
+// runCommand runs cmd and returns its combined output. With a timeout, cmd
+// runs in its own process group, which is killed with the processes cmd
+// started once the timeout expires.
+func runCommand(cmd *exec.Cmd, timeout time.Duration) ([]byte, error) {
+	if timeout <= 0 {
+		return cmd.CombinedOutput()
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return out.Bytes(), err
+	case <-timer.C:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return out.Bytes(), fmt.Errorf("killed after %s", timeout)
+	}
+}
+
+// deltaEnv returns the environment variables describing delta to the notify command
+func deltaEnv(delta ContainerDelta) []string {
+	refs := func(name string, refs []ContainerRef) []string {
+		ids := make([]string, len(refs))
+		names := make([]string, len(refs))
+		for i, ref := range refs {
+			ids[i] = ref.ID
+			names[i] = ref.Name
+		}
+		return []string{
+			name + "=" + strings.Join(ids, " "),
+			name + "_NAMES=" + strings.Join(names, " "),
+		}
+	}
+
+	env := refs("DOCKER_GEN_ADDED", delta.Added)
+	env = append(env, refs("DOCKER_GEN_REMOVED", delta.Removed)...)
+	env = append(env, refs("DOCKER_GEN_CHANGED", delta.Changed)...)
+	return env
+}
+
+// writeDeltaFile writes delta as JSON to a temporary file and returns its path
+func writeDeltaFile(delta ContainerDelta) (string, error) {
+	f, err := ioutil.TempFile("", "docker-gen-delta")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(delta); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
 }
 
 func (g *generator) sendSignalToContainer(config Config) {
@@ -332,14 +983,15 @@ func (g *generator) sendSignalToContainer(config Config) {
 		return
 	}
 
+	client := g.notifyHost(config).Client
 	for container, signal := range config.NotifyContainers {
-		log.Printf("Sending container '%s' signal '%v'", container, signal)
+		logInfof("Sending container '%s' signal '%v'", container, signal)
 		killOpts := docker.KillContainerOptions{
 			ID:     container,
 			Signal: signal,
 		}
-		if err := g.Client.KillContainer(killOpts); err != nil {
-			log.Printf("Error sending signal to container: %s", err)
+		if err := client.KillContainer(killOpts); err != nil {
+			logErrorf("Error sending signal to container: %s", err)
 		}
 	}
 }
@@ -349,16 +1001,22 @@ func (g *generator) sendSignalToService(config Config) {
 		return
 	}
 
+	host := g.notifyHost(config)
+	if host.Podman {
+		logWarnf("Podman has no Swarm services. Skipping notification of %d service(s)", len(config.NotifyServices))
+		return
+	}
+
 	for service, signal := range config.NotifyServices {
-		log.Printf("Service '%s' needs notification", service)
+		logInfof("Service '%s' needs notification", service)
 		taskOpts := docker.ListTasksOptions{
 			Filters: map[string][]string{
 				"service": []string{service},
 			},
 		}
-		tasks, err := g.Client.ListTasks(taskOpts)
+		tasks, err := host.Client.ListTasks(taskOpts)
 		if err != nil {
-			log.Printf("Error retrieving task list: %s", err)
+			logErrorf("Error retrieving task list: %s", err)
 		}
 		for _, task := range tasks {
 			if task.Status.State != "running" {
@@ -367,108 +1025,236 @@ func (g *generator) sendSignalToService(config Config) {
 
 			container := task.Status.ContainerStatus.ContainerID
 
-			log.Printf("Sending container '%s' signal '%v'", shortIdent(container), signal)
+			logInfof("Sending container '%s' signal '%v'", shortIdent(container), signal)
 			killOpts := docker.KillContainerOptions{
 				ID:     container,
 				Signal: signal,
 			}
-			if err := g.Client.KillContainer(killOpts); err != nil {
-				log.Printf("Error sending signal to container %s: %s", container, err)
+			if err := host.Client.KillContainer(killOpts); err != nil {
+				logErrorf("Error sending signal to container %s: %s", container, err)
 			}
 		}
 	}
 }
 
-func (g *generator) getContainers() ([]*RuntimeContainer, error) {
-	apiInfo, err := g.Client.Info()
-	if err != nil {
-		log.Printf("Error retrieving docker server info: %s\n", err)
-	} else {
-		SetServerInfo(apiInfo)
+// getContainers lists and inspects the containers of all docker hosts, and
+// returns them with the errors retrieving their meta-data. Only a failed
+// listing of the main endpoint is an error.
+func (g *generator) getContainers() ([]*RuntimeContainer, []string, error) {
+	if containers, errs, ok := g.updateContainers(); ok {
+		return containers, errs, nil
 	}
 
-	apiContainers, err := g.Client.ListContainers(docker.ListContainersOptions{
-		All:  g.All,
-		Size: false,
-	})
+	var errs []string
+	var errsMu sync.Mutex
+	logError := func(format string, v ...interface{}) {
+		msg := fmt.Sprintf(format, v...)
+		logErrorf("%s", msg)
+		errsMu.Lock()
+		errs = append(errs, strings.TrimSpace(msg))
+		errsMu.Unlock()
+	}
+
+	apiInfo, err := g.dockerHosts()[0].Client.Info()
 	if err != nil {
-		return nil, err
+		logError("Error retrieving docker server info: %s\n", err)
+	} else {
+		SetServerInfo(apiInfo)
 	}
 
 	containers := []*RuntimeContainer{}
-	for _, apiContainer := range apiContainers {
-		container, err := g.Client.InspectContainer(apiContainer.ID)
+	for i, host := range g.dockerHosts() {
+		ids, listedBy, err := g.listContainers(host)
+		if err != nil && i == 0 {
+			return nil, nil, err
+		}
 		if err != nil {
-			log.Printf("Error inspecting container: %s: %s\n", apiContainer.ID, err)
+			// the other hosts' containers are still rendered
+			logError("Error listing containers of %s: %s\n", host.Endpoint, err)
 			continue
 		}
 
-		labels := container.Config.Labels
+		swarm := newSwarmInspector(host.Client, logError)
+		if g.streamOnly() {
+			// templates inspect the containers while rendering
+			ids = nil
+		}
+		for _, container := range g.inspectContainers(host, ids, swarm, logError) {
+			container.listedBy = listedBy[container.ID]
+			containers = append(containers, container)
+		}
+	}
 
-		registry, repository, tag := splitDockerImage(container.Config.Image)
-		runtimeContainer := &RuntimeContainer{
-			ID: container.ID,
-			Image: DockerImage{
-				Registry:   registry,
-				Repository: repository,
-				Tag:        tag,
-			},
-			State: State{
-				Running: container.State.Running,
-			},
-			Name:         strings.TrimLeft(container.Name, "/"),
-			Hostname:     container.Config.Hostname,
-			Gateway:      container.NetworkSettings.Gateway,
-			Addresses:    []Address{},
-			Networks:     []Network{},
-			Env:          make(map[string]string),
-			Volumes:      make(map[string]Volume),
-			Node:         SwarmNode{},
-			Labels:       make(map[string]string),
+	for _, err := range loadComposeProjects(g.ComposeFiles) {
+		logError("Error loading compose file: %s\n", err)
+	}
+	if len(errs) == 0 {
+		g.storeContainers(containers)
+	}
+	return containers, errs, nil
+
+}
+
+const defaultInspectJobs = 8
+
+func (g *generator) inspectJobs() int {
+	if g.InspectJobs <= 0 {
+		return defaultInspectJobs
+	}
+	return g.InspectJobs
+}
+
+// inspectContainers inspects the containers of host with up to InspectJobs
+// concurrent calls. They are returned in the order of ids, without those
+// that could not be inspected.
+func (g *generator) inspectContainers(host dockerHost, ids []string, swarm *swarmInspector, logError func(format string, v ...interface{})) []*RuntimeContainer {
+	inspected := make([]*RuntimeContainer, len(ids))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < g.inspectJobs() && i < len(ids); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if runtimeContainer, ok := g.inspectContainer(host, ids[j], swarm, logError); ok {
+					inspected[j] = runtimeContainer
+				}
+			}
+		}()
+	}
+	for i := range ids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	containers := []*RuntimeContainer{}
+	for _, runtimeContainer := range inspected {
+		if runtimeContainer != nil {
+			containers = append(containers, runtimeContainer)
+		}
+	}
+	return containers
+}
+
+// labelListFilters returns the ListContainers filters leaving dockerd to
+// filter the containers by labels
+func labelListFilters(labels []string) map[string][]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	return map[string][]string{"label": labels}
+}
+
+// inspectContainer returns the meta-data of the container id of host; errors
+// are reported to logError
+func (g *generator) inspectContainer(host dockerHost, id string, swarm *swarmInspector, logError func(format string, v ...interface{})) (*RuntimeContainer, bool) {
+	container, err := g.inspect(host, id)
+	if err != nil {
+		logError("Error inspecting container: %s: %s\n", id, err)
+		return nil, false
+	}
+	return g.runtimeContainer(host, container, swarm, logError), true
+}
+
+// runtimeContainer returns the meta-data of the inspected container of host;
+// errors retrieving the meta-data of its image and swarm service are reported
+// to logError
+func (g *generator) runtimeContainer(host dockerHost, container *docker.Container, swarm *swarmInspector, logError func(format string, v ...interface{})) *RuntimeContainer {
+	labels := container.Config.Labels
+
+	registry, repository, tag := splitDockerImage(container.Config.Image)
+	runtimeContainer := &RuntimeContainer{
+		ID: container.ID,
+		Image: DockerImage{
+			Registry:   registry,
+			Repository: repository,
+			Tag:        tag,
+		},
+		State: State{
+			Running:      container.State.Running,
+			Status:       container.State.Status,
+			Restarting:   container.State.Restarting,
+			OOMKilled:    container.State.OOMKilled,
+			ExitCode:     container.State.ExitCode,
+			StartedAt:    container.State.StartedAt,
+			FinishedAt:   container.State.FinishedAt,
+			RestartCount: container.RestartCount,
+		},
+		Health: Health{
+			Status:        container.State.Health.Status,
+			FailingStreak: container.State.Health.FailingStreak,
+			Log:           []HealthProbe{},
+		},
+		Name:         strings.TrimLeft(container.Name, "/"),
+		Hostname:     container.Config.Hostname,
+		Host:         host.Endpoint,
+		configOnly:   host.configOnly,
+		Gateway:      container.NetworkSettings.Gateway,
+		Addresses:    []Address{},
+		Networks:     []Network{},
+		Env:          make(map[string]string),
+		Volumes:      make(map[string]Volume),
+		Node:         SwarmNode{},
+		Labels:       make(map[string]string),
+		IP:           container.NetworkSettings.IPAddress,
+		IP6LinkLocal: container.NetworkSettings.LinkLocalIPv6Address,
+		IP6Global:    container.NetworkSettings.GlobalIPv6Address,
+	}
+	if runtimeContainer.State.Status == "" {
+		// older daemons don't report the status
+		runtimeContainer.State.Status = container.State.StateString()
+	}
+	for k, v := range container.NetworkSettings.Ports {
+		address := Address{
 			IP:           container.NetworkSettings.IPAddress,
 			IP6LinkLocal: container.NetworkSettings.LinkLocalIPv6Address,
 			IP6Global:    container.NetworkSettings.GlobalIPv6Address,
+			Port:         k.Port(),
+			Proto:        k.Proto(),
 		}
-		for k, v := range container.NetworkSettings.Ports {
-			address := Address{
-				IP:           container.NetworkSettings.IPAddress,
-				IP6LinkLocal: container.NetworkSettings.LinkLocalIPv6Address,
-				IP6Global:    container.NetworkSettings.GlobalIPv6Address,
-				Port:         k.Port(),
-				Proto:        k.Proto(),
-			}
-			if len(v) > 0 {
-				address.HostPort = v[0].HostPort
-				address.HostIP = v[0].HostIP
-			}
-			runtimeContainer.Addresses = append(runtimeContainer.Addresses,
-				address)
-
-		}
-		for k, v := range container.NetworkSettings.Networks {
-			network := Network{
-				IP:                  v.IPAddress,
-				Name:                k,
-				Gateway:             v.Gateway,
-				EndpointID:          v.EndpointID,
-				IPv6Gateway:         v.IPv6Gateway,
-				GlobalIPv6Address:   v.GlobalIPv6Address,
-				MacAddress:          v.MacAddress,
-				GlobalIPv6PrefixLen: v.GlobalIPv6PrefixLen,
-				IPPrefixLen:         v.IPPrefixLen,
-			}
+		if len(v) > 0 {
+			address.HostPort = v[0].HostPort
+			address.HostIP = v[0].HostIP
+		}
+		runtimeContainer.Addresses = append(runtimeContainer.Addresses,
+			address)
 
-			runtimeContainer.Networks = append(runtimeContainer.Networks,
-				network)
+	}
+	runtimeContainer.Ports = containerPorts(container)
+	if container.Image != "" {
+		if image, err := g.inspectImage(host, container.Image); err != nil {
+			logError("Error inspecting image %s of container %s: %s\n", container.Image, container.ID, err)
+		} else {
+			setImageMeta(&runtimeContainer.Image, image)
 		}
-		for k, v := range container.Volumes {
-			runtimeContainer.Volumes[k] = Volume{
-				Path:      k,
-				HostPath:  v,
-				ReadWrite: container.VolumesRW[k],
-			}
+	}
+	for k, v := range container.NetworkSettings.Networks {
+		network := Network{
+			IP:                  v.IPAddress,
+			Name:                k,
+			Gateway:             v.Gateway,
+			EndpointID:          v.EndpointID,
+			IPv6Gateway:         v.IPv6Gateway,
+			GlobalIPv6Address:   v.GlobalIPv6Address,
+			MacAddress:          v.MacAddress,
+			GlobalIPv6PrefixLen: v.GlobalIPv6PrefixLen,
+			IPPrefixLen:         v.IPPrefixLen,
 		}
 
+		runtimeContainer.Networks = append(runtimeContainer.Networks,
+			network)
+	}
+	for k, v := range container.Volumes {
+		runtimeContainer.Volumes[k] = Volume{
+			Path:      k,
+			HostPath:  v,
+			ReadWrite: container.VolumesRW[k],
+		}
+	}
+
+	// Podman has no Swarm endpoints
+	if !host.Podman {
 		// Swarm node
 		if container.Node != nil {
 			runtimeContainer.Node.ID = container.Node.ID
@@ -476,124 +1262,136 @@ func (g *generator) getContainers() ([]*RuntimeContainer, error) {
 			runtimeContainer.Node.Address = Address{
 				IP: container.Node.IP,
 			}
+			runtimeContainer.Node.Labels = container.Node.Labels
 		} else {
 			if nodeID, ok := labels["com.docker.swarm.node.id"]; ok {
-				node, err := g.Client.InspectNode(nodeID)
-				if err != nil {
-					log.Printf("Error inspecting swarm node %s: %s\n", nodeID, err)
-				} else {
-					runtimeContainer.Node = SwarmNode{
-						ID:   node.ID,
-						Name: node.Spec.Name,
-						Address: Address{
-							IP: node.Status.Addr,
-						},
-					}
+				if node, ok := swarm.node(nodeID); ok {
+					runtimeContainer.Node = *node
 				}
 			}
 		}
 
 		// Swarm service
 		if serviceID, ok := labels["com.docker.swarm.service.id"]; ok {
-			svc, err := g.Client.InspectService(serviceID)
-			if err != nil {
-				log.Printf("Error inspecting swarm service %s: %s\n", serviceID, err)
-			} else {
-				runtimeContainer.Service = SwarmService{
-					ID:   svc.ID,
-					Name: svc.Spec.Name,
-				}
+			if service, ok := swarm.service(serviceID); ok {
+				runtimeContainer.Service = *service
 
 				// alternative attempt to get service name
 				if len(runtimeContainer.Service.Name) == 0 {
 					runtimeContainer.Service.Name = labels["com.docker.swarm.service.name"]
 				}
-
-				for _, vip := range svc.Endpoint.VirtualIPs {
-					network, err := g.Client.NetworkInfo(vip.NetworkID)
-					if err != nil {
-						log.Printf("Error inspecting swarm service VIP network %s: %s\n", vip.NetworkID, err)
-					} else {
-						cleanVIP := strings.Split(vip.Addr, "/")[0]
-						svcVIPNet := SwarmServiceNetwork{
-							IP:     cleanVIP,
-							Name:   network.Name,
-							Scope:  network.Scope,
-							Driver: network.Driver,
-						}
-						runtimeContainer.Service.Networks = append(runtimeContainer.Service.Networks, svcVIPNet)
-					}
-				}
 			}
 		}
 
-		for _, v := range container.Mounts {
-			runtimeContainer.Mounts = append(runtimeContainer.Mounts, Mount{
-				Name:        v.Name,
-				Source:      v.Source,
-				Destination: v.Destination,
-				Driver:      v.Driver,
-				Mode:        v.Mode,
-				RW:          v.RW,
-			})
+		// Swarm task
+		if taskID, ok := labels["com.docker.swarm.task.id"]; ok {
+			if task, ok := swarm.task(labels["com.docker.swarm.service.id"], taskID); ok {
+				runtimeContainer.Task = task
+			}
 		}
+	}
 
-		runtimeContainer.Env = splitKeyValueSlice(container.Config.Env)
-		runtimeContainer.Labels = container.Config.Labels
-		containers = append(containers, runtimeContainer)
+	for _, v := range container.Mounts {
+		runtimeContainer.Mounts = append(runtimeContainer.Mounts, Mount{
+			Name:        v.Name,
+			Source:      v.Source,
+			Destination: v.Destination,
+			Driver:      v.Driver,
+			Mode:        v.Mode,
+			RW:          v.RW,
+		})
 	}
-	return containers, nil
 
-}
+	for _, probe := range container.State.Health.Log {
+		runtimeContainer.Health.Log = append(runtimeContainer.Health.Log, HealthProbe{
+			Start:    probe.Start,
+			End:      probe.End,
+			ExitCode: probe.ExitCode,
+			Output:   probe.Output,
+		})
+	}
 
-func newSignalChannel() <-chan os.Signal {
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGKILL)
+	if hostConfig := container.HostConfig; hostConfig != nil {
+		runtimeContainer.Resources = Resources{
+			Memory:            hostConfig.Memory,
+			MemoryReservation: hostConfig.MemoryReservation,
+			MemorySwap:        hostConfig.MemorySwap,
+			CPUShares:         hostConfig.CPUShares,
+			CPUQuota:          hostConfig.CPUQuota,
+			CPUPeriod:         hostConfig.CPUPeriod,
+			NanoCPUs:          hostConfig.NanoCPUs,
+			CpusetCpus:        hostConfig.CPUSetCPUs,
+		}
+		if hostConfig.PidsLimit != nil {
+			runtimeContainer.Resources.PidsLimit = *hostConfig.PidsLimit
+		}
+		runtimeContainer.Restart = RestartPolicy{
+			Name:              hostConfig.RestartPolicy.Name,
+			MaximumRetryCount: hostConfig.RestartPolicy.MaximumRetryCount,
+		}
+	}
 
-	return sig
+	runtimeContainer.Env = splitKeyValueSlice(container.Config.Env)
+	runtimeContainer.Labels = container.Config.Labels
+	runtimeContainer.Compose = newComposeContainer(container.Config.Labels)
+	return runtimeContainer
 }
 
-func newDebounceChannel(input chan *docker.APIEvents, wait *Wait) chan *docker.APIEvents {
-	if wait == nil {
-		return input
+// containerPorts returns the exposed and published ports of container,
+// ordered by port number and protocol
+func containerPorts(container *docker.Container) []Port {
+	ports := map[docker.Port]*Port{}
+	port := func(p docker.Port) *Port {
+		if ports[p] == nil {
+			ports[p] = &Port{Port: p.Port(), Proto: p.Proto(), Bindings: []PortBinding{}}
+		}
+		return ports[p]
+	}
+	if container.Config != nil {
+		for p := range container.Config.ExposedPorts {
+			port(p).Exposed = true
+		}
 	}
-	if wait.Min == 0 {
-		return input
+	for p, bindings := range container.NetworkSettings.Ports {
+		port(p)
+		for _, binding := range bindings {
+			ports[p].Published = true
+			ports[p].Bindings = append(ports[p].Bindings, PortBinding{
+				HostIP:   binding.HostIP,
+				HostPort: binding.HostPort,
+			})
+		}
 	}
 
-	output := make(chan *docker.APIEvents, 100)
-
-	go func() {
-		var (
-			event    *docker.APIEvents
-			minTimer <-chan time.Time
-			maxTimer <-chan time.Time
-		)
+	sorted := make([]Port, 0, len(ports))
+	for _, p := range ports {
+		sorted = append(sorted, *p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, _ := strconv.Atoi(sorted[i].Port)
+		b, _ := strconv.Atoi(sorted[j].Port)
+		if a != b {
+			return a < b
+		}
+		return sorted[i].Proto < sorted[j].Proto
+	})
+	return sorted
+}
 
-		defer close(output)
+// newSignalChannel returns a channel receiving the signals handled by
+// docker-gen, and SIGINT once Stop is called
+func (g *generator) newSignalChannel() <-chan os.Signal {
+	sig := make(chan os.Signal, 4)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGKILL)
 
-		for {
-			select {
-			case buffer, ok := <-input:
-				if !ok {
-					return
-				}
-				event = buffer
-				minTimer = time.After(wait.Min)
-				if maxTimer == nil {
-					maxTimer = time.After(wait.Max)
-				}
-			case <-minTimer:
-				log.Println("Debounce minTimer fired")
-				minTimer, maxTimer = nil, nil
-				output <- event
-			case <-maxTimer:
-				log.Println("Debounce maxTimer fired")
-				minTimer, maxTimer = nil, nil
-				output <- event
-			}
+	stop := g.stopChannel()
+	go func() {
+		<-stop
+		signal.Stop(sig)
+		select {
+		case sig <- syscall.SIGINT:
+		default:
 		}
 	}()
-
-	return output
+	return sig
 }
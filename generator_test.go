@@ -7,8 +7,12 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -146,7 +150,7 @@ func TestGenerateFromEvents(t *testing.T) {
 		Client:   client,
 		Endpoint: serverURL,
 		Configs: ConfigFile{
-			[]Config{
+			Config: []Config{
 				Config{
 					Template: tmplFile.Name(),
 					Dest:     destFiles[0].Name(),
@@ -175,7 +179,7 @@ func TestGenerateFromEvents(t *testing.T) {
 		retry: false,
 	}
 
-	generator.generateFromEvents()
+	generator.startScheduler()
 	generator.wg.Wait()
 
 	var (
@@ -205,3 +209,472 @@ func TestGenerateFromEvents(t *testing.T) {
 		}
 	}
 }
+
+func TestNextInterval(t *testing.T) {
+	now := time.Date(2017, 1, 1, 12, 0, 20, 0, time.UTC)
+
+	if d := nextInterval(Config{Interval: 60}, now); d != 60*time.Second {
+		t.Errorf("expected: %s. got: %s", 60*time.Second, d)
+	}
+
+	if d := nextInterval(Config{Interval: 60, IntervalAlign: true}, now); d != 40*time.Second {
+		t.Errorf("expected: %s. got: %s", 40*time.Second, d)
+	}
+
+	for i := 0; i < 100; i++ {
+		d := nextInterval(Config{Interval: 60, IntervalAlign: true, IntervalJitter: 5}, now)
+		if d < 40*time.Second || d >= 45*time.Second {
+			t.Fatalf("expected delay within [40s, 45s). got: %s", d)
+		}
+	}
+}
+
+func TestGenerateOnceFailsOnTemplateError(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/containers/json") {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/test.tmpl", []byte("{{ .Missing }}"), 0644)
+	ioutil.WriteFile(dir+"/out.conf", []byte("previous"), 0644)
+
+	g := &generator{
+		Client:   client,
+		Endpoint: server.URL,
+		Configs:  ConfigFile{Config: []Config{{Template: dir + "/test.tmpl", Dest: dir + "/out.conf"}}},
+	}
+	if err := g.Generate(); err == nil {
+		t.Error("Expected a one-shot run with a template error to fail")
+	}
+	if value, _ := ioutil.ReadFile(dir + "/out.conf"); string(value) != "previous" {
+		t.Errorf("Expected dest to be left unchanged, got %q", value)
+	}
+}
+
+func TestGenerateConfigPartialFailure(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	tmplFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-tmpl")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer os.Remove(tmplFile.Name())
+	ioutil.WriteFile(tmplFile.Name(), []byte("{{range .Errors}}{{.}}{{end}}"), 0644)
+
+	destFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-out")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer os.Remove(destFile.Name())
+
+	errs := []string{"inspect failed"}
+	g := &generator{}
+	g.generateConfig(Config{Template: tmplFile.Name(), Dest: destFile.Name(), PartialFailure: PartialFailureSkip}, Context{}, errs, false)
+	if value, _ := ioutil.ReadFile(destFile.Name()); string(value) != "" {
+		t.Errorf("expected generation to be skipped. got: %s", value)
+	}
+
+	g.generateConfig(Config{Template: tmplFile.Name(), Dest: destFile.Name(), PartialFailure: PartialFailureRender}, Context{}, errs, false)
+	if value, _ := ioutil.ReadFile(destFile.Name()); string(value) != "inspect failed" {
+		t.Errorf("expected: %s. got: %s", "inspect failed", value)
+	}
+}
+
+func TestGenerateConfigErrorsOfItsListing(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	tmplFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-tmpl")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer os.Remove(tmplFile.Name())
+	ioutil.WriteFile(tmplFile.Name(), []byte("{{len .Errors}}"), 0644)
+
+	g := &generator{}
+	var wg sync.WaitGroup
+	dests := map[string][]string{"0": nil, "2": {"inspect failed", "list failed"}}
+	for expected, errs := range dests {
+		destFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-out")
+		if err != nil {
+			t.Fatalf("Failed to create temp file: %v\n", err)
+		}
+		defer os.Remove(destFile.Name())
+		wg.Add(1)
+		go func(expected string, errs []string) {
+			defer wg.Done()
+			// e.g. scheduler workers generating from different listings
+			for i := 0; i < 20; i++ {
+				g.generateConfig(Config{Template: tmplFile.Name(), Dest: destFile.Name()}, Context{}, errs, false)
+				if value, _ := ioutil.ReadFile(destFile.Name()); string(value) != expected {
+					t.Errorf("expected: %s. got: %s", expected, value)
+					return
+				}
+			}
+		}(expected, errs)
+	}
+	wg.Wait()
+}
+
+func TestGenerateConfigWaitsForLock(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	tmplFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-tmpl")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer os.Remove(tmplFile.Name())
+	ioutil.WriteFile(tmplFile.Name(), []byte("generated"), 0644)
+
+	destFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-out")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer os.Remove(destFile.Name())
+
+	g := &generator{}
+	config := Config{Template: tmplFile.Name(), Dest: destFile.Name()}
+	unlock := g.lockConfig(config)
+	done := make(chan bool)
+	go func() {
+		// e.g. a control socket trigger during a scheduled generation
+		g.generateConfig(config, Context{}, nil, false)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the generation to wait for the one in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	<-done
+	if value, _ := ioutil.ReadFile(destFile.Name()); string(value) != "generated" {
+		t.Errorf("expected: %s. got: %s", "generated", value)
+	}
+}
+
+func TestGenerateConfigKeepsDeltaOfFailedGeneration(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tmplPath := dir + "/test.tmpl"
+	ioutil.WriteFile(tmplPath, []byte("{{range .}}{{.Name}} {{end}}"), 0644)
+	invalid, notified := dir+"/invalid", dir+"/notified"
+
+	g := &generator{}
+	config := Config{
+		Template:    tmplPath,
+		Dest:        dir + "/out.conf",
+		ValidateCmd: "test ! -e " + invalid,
+		NotifyCmd:   `echo "$DOCKER_GEN_ADDED_NAMES" >> ` + notified,
+	}
+	web := &RuntimeContainer{ID: "1", Name: "web", State: State{Running: true}}
+	api := &RuntimeContainer{ID: "2", Name: "api", State: State{Running: true}}
+	g.generateConfig(config, Context{web}, nil, false)
+	ioutil.WriteFile(invalid, nil, 0644)
+	g.generateConfig(config, Context{web, api}, nil, false)
+	os.Remove(invalid)
+	g.generateConfig(config, Context{web, api}, nil, false)
+
+	// the container added by the failed generation is notified by the next
+	if value, _ := ioutil.ReadFile(notified); string(value) != "web\napi\n" {
+		t.Errorf("Unexpected notifications %q", value)
+	}
+}
+
+func TestPartialFailureMode(t *testing.T) {
+	for _, mode := range []string{"", PartialFailureRender, PartialFailureSkip, PartialFailureNoNotify} {
+		config := Config{PartialFailure: mode}
+		if got, err := config.PartialFailureMode(); err != nil || (mode != "" && got != mode) {
+			t.Errorf("Expected partial_failure %q to be accepted, got %q, %v", mode, got, err)
+		}
+	}
+	config := Config{PartialFailure: "skipp"}
+	if _, err := config.PartialFailureMode(); err == nil || !strings.Contains(err.Error(), "skipp") {
+		t.Errorf("Expected an unknown partial_failure to be refused, got %v", err)
+	}
+}
+
+func TestLockDest(t *testing.T) {
+	destFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-out")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer func() {
+		os.Remove(destFile.Name())
+		os.Remove(destFile.Name() + ".lock")
+	}()
+
+	lock, err := lockDest(destFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to lock dest: %v", err)
+	}
+	if _, err := lockDest(destFile.Name()); err == nil {
+		t.Fatal("expected locking an already locked dest to fail")
+	}
+
+	lock.Close()
+	lock, err = lockDest(destFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to lock released dest: %v", err)
+	}
+	lock.Close()
+}
+
+func TestInspectContainersConcurrently(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(r.URL.Path[strings.LastIndex(r.URL.Path, "/containers/")+len("/containers/"):], "/json")
+		if id == "c3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		fmt.Fprintf(w, `{"Id":%q,"Name":"/%s","Config":{"Image":"web"},"NetworkSettings":{}}`, id, id)
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := dockerHost{Endpoint: server.URL, Client: client}
+
+	ids := []string{}
+	for i := 0; i < 10; i++ {
+		ids = append(ids, fmt.Sprintf("c%d", i))
+	}
+	errs := 0
+	g := &generator{InspectJobs: 3}
+	containers := g.inspectContainers(host, ids, newSwarmInspector(client, nil), func(format string, v ...interface{}) {
+		mu.Lock()
+		errs++
+		mu.Unlock()
+	})
+
+	got := []string{}
+	for _, container := range containers {
+		got = append(got, container.Name)
+	}
+	expected := []string{"c0", "c1", "c2", "c4", "c5", "c6", "c7", "c8", "c9"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v. got: %v", expected, got)
+	}
+	if errs != 1 {
+		t.Errorf("Expected the failed inspection to be reported once, got %d", errs)
+	}
+	if maxRunning < 2 || maxRunning > 3 {
+		t.Errorf("Expected up to 3 concurrent inspections, got %d", maxRunning)
+	}
+}
+
+func TestInspectContainerResources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Id":"web","Name":"/web","Config":{"Image":"web"},"NetworkSettings":{},
+			"HostConfig":{"Memory":536870912,"MemoryReservation":268435456,"MemorySwap":-1,"CpuShares":512,
+			"CpuQuota":50000,"CpuPeriod":100000,"CpusetCpus":"0-1","PidsLimit":100,
+			"RestartPolicy":{"Name":"on-failure","MaximumRetryCount":3}}}`)
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &generator{}
+	container, ok := g.inspectContainer(dockerHost{Endpoint: server.URL, Client: client}, "web", newSwarmInspector(client, nil), func(format string, v ...interface{}) {
+		t.Errorf(format, v...)
+	})
+	if !ok {
+		t.Fatal("Expected the container to be inspected")
+	}
+	expected := Resources{
+		Memory:            536870912,
+		MemoryReservation: 268435456,
+		MemorySwap:        -1,
+		CPUShares:         512,
+		CPUQuota:          50000,
+		CPUPeriod:         100000,
+		CpusetCpus:        "0-1",
+		PidsLimit:         100,
+	}
+	if container.Resources != expected {
+		t.Errorf("expected: %+v. got: %+v", expected, container.Resources)
+	}
+	if container.Restart != (RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}) {
+		t.Errorf("Unexpected restart policy %+v", container.Restart)
+	}
+}
+
+func TestInspectContainerState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Id":"web","Name":"/web","Config":{"Image":"web"},"NetworkSettings":{},"RestartCount":2,
+			"State":{"Running":false,"OOMKilled":true,"ExitCode":137,
+			"StartedAt":"2024-05-02T09:00:00Z","FinishedAt":"2024-05-02T10:00:00Z"}}`)
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &generator{}
+	container, ok := g.inspectContainer(dockerHost{Endpoint: server.URL, Client: client}, "web", newSwarmInspector(client, nil), func(format string, v ...interface{}) {
+		t.Errorf(format, v...)
+	})
+	if !ok {
+		t.Fatal("Expected the container to be inspected")
+	}
+	state := container.State
+	if state.Status != "exited" || !state.OOMKilled || state.ExitCode != 137 || state.RestartCount != 2 {
+		t.Errorf("Unexpected state %+v", state)
+	}
+	if !state.FinishedAt.Equal(time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)) || state.FinishedAt.Sub(state.StartedAt) != time.Hour {
+		t.Errorf("Unexpected run %s - %s", state.StartedAt, state.FinishedAt)
+	}
+	if state.Uptime() != 0 {
+		t.Errorf("Expected a stopped container to have no uptime, got %s", state.Uptime())
+	}
+	state.Running = true
+	if uptime := state.Uptime(); uptime < time.Hour {
+		t.Errorf("Expected the uptime since the start, got %s", uptime)
+	}
+}
+
+func TestContainerPorts(t *testing.T) {
+	container := &docker.Container{
+		Config: &docker.Config{
+			ExposedPorts: map[docker.Port]struct{}{"80/tcp": {}, "443/tcp": {}, "53/udp": {}},
+		},
+		NetworkSettings: &docker.NetworkSettings{
+			Ports: map[docker.Port][]docker.PortBinding{
+				"80/tcp":   {{HostIP: "0.0.0.0", HostPort: "8080"}, {HostIP: "::", HostPort: "8080"}},
+				"443/tcp":  nil,
+				"9000/tcp": {{HostIP: "127.0.0.1", HostPort: "9000"}},
+			},
+		},
+	}
+	expected := []Port{
+		{Port: "53", Proto: "udp", Exposed: true, Bindings: []PortBinding{}},
+		{Port: "80", Proto: "tcp", Exposed: true, Published: true, Bindings: []PortBinding{
+			{HostIP: "0.0.0.0", HostPort: "8080"},
+			{HostIP: "::", HostPort: "8080"},
+		}},
+		{Port: "443", Proto: "tcp", Exposed: true, Bindings: []PortBinding{}},
+		{Port: "9000", Proto: "tcp", Published: true, Bindings: []PortBinding{{HostIP: "127.0.0.1", HostPort: "9000"}}},
+	}
+	if got := containerPorts(container); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %+v. got: %+v", expected, got)
+	}
+}
+
+func TestContainerStateEvents(t *testing.T) {
+	previous := map[string]bool{"a": true, "b": true, "c": false, "d": true}
+	current := map[string]bool{"a": true, "b": false, "c": true, "e": true, "f": false}
+
+	events := containerStateEvents(previous, current)
+	got := []string{}
+	for _, event := range events {
+		got = append(got, event.Status+" "+event.ID)
+	}
+	expected := []string{"stop b", "start c", "stop d", "start e"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v. got: %v", expected, got)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDockerEnv(&docker.Env{})
+
+	tmplFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-tmpl")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer os.Remove(tmplFile.Name())
+	ioutil.WriteFile(tmplFile.Name(), []byte("{{if .Draining}}maintenance{{else}}serving{{end}}"), 0644)
+	destFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-out")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer os.Remove(destFile.Name())
+
+	g := &generator{
+		Client: client,
+		Configs: ConfigFile{
+			Config: []Config{
+				Config{Template: tmplFile.Name(), Dest: destFile.Name(), Watch: true, Drain: true},
+			},
+		},
+	}
+	g.drain()
+	if value, _ := ioutil.ReadFile(destFile.Name()); string(value) != "" {
+		t.Errorf("expected no drain without SIGTERM. got: %s", value)
+	}
+
+	g.terminated = true
+	g.drain()
+	if value, _ := ioutil.ReadFile(destFile.Name()); string(value) != "maintenance" {
+		t.Errorf("expected: %s. got: %s", "maintenance", value)
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(drainingContexts) != 0 {
+		t.Error("expected draining to be reset")
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	start := time.Now()
+	// the sleep started by the shell is killed with it
+	out, err := runCommand(exec.Command("/bin/sh", "-c", "echo started; sleep 10 & wait"), 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "killed after 100ms") {
+		t.Errorf("Expected the command to be killed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the command to be killed after its timeout, took %s", elapsed)
+	}
+	if string(out) != "started\n" {
+		t.Errorf("Expected the output before the timeout, got %q", out)
+	}
+
+	out, err = runCommand(exec.Command("/bin/sh", "-c", "echo done"), time.Second)
+	if err != nil || string(out) != "done\n" {
+		t.Errorf("Expected the command to succeed, got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,62 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// HostHealth is the docker event connection of a host as reported by /healthz
+type HostHealth struct {
+	Endpoint  string
+	Connected bool
+	Since     time.Time
+	LastEvent time.Time `json:",omitempty"`
+}
+
+// HealthReport is the body of /healthz. Healthy is false while the event listener
+// of a docker host is disconnected.
+type HealthReport struct {
+	Healthy bool
+	Docker  []HostHealth
+	Configs []GenerationStatus
+}
+
+// health returns the docker connections and the generation status of the
+// configs
+func (g *generator) health() HealthReport {
+	health := HealthReport{Healthy: true, Docker: []HostHealth{}, Configs: g.Status()}
+
+	g.hostsMu.Lock()
+	for endpoint, state := range g.hostStates {
+		health.Docker = append(health.Docker, HostHealth{
+			Endpoint:  endpoint,
+			Connected: state.watching,
+			Since:     state.since,
+			LastEvent: state.lastEvent,
+		})
+		health.Healthy = health.Healthy && state.watching
+	}
+	g.hostsMu.Unlock()
+	sort.Slice(health.Docker, func(i, j int) bool {
+		return health.Docker[i].Endpoint < health.Docker[j].Endpoint
+	})
+	return health
+}
+
+// handleHealth serves /healthz, with status 503 while unhealthy so that
+// liveness probes restart a wedged docker-gen
+func (g *generator) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	health := g.health()
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
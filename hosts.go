@@ -0,0 +1,219 @@
+package dockergen
+
+import (
+	"fmt"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// dockerHost is a docker daemon whose containers are merged into the context
+type dockerHost struct {
+	Endpoint string
+	Client   *docker.Client
+	Podman   bool
+
+	// configOnly is set for the endpoints of configs, whose containers are
+	// only rendered by these configs
+	configOnly bool
+	tls        dockerTLS
+}
+
+// dockerTLS are the TLS settings of the client of a config's endpoint
+type dockerTLS struct {
+	cert, key, caCert string
+	verify            bool
+}
+
+// newDockerHosts connects to the extra endpoints of gc with the same TLS and
+// client options as the main endpoint
+func newDockerHosts(gc GeneratorConfig) ([]dockerHost, error) {
+	hosts := []dockerHost{}
+	for _, endpoint := range gc.Endpoints {
+		if _, _, err := parseHost(endpoint); err != nil {
+			return nil, fmt.Errorf("Bad endpoint: %s", err)
+		}
+		client, err := NewDockerClientWithOptions(endpoint, gc.TLSVerify, gc.TLSCert, gc.TLSCACert, gc.TLSKey, gc.ClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create docker client for %s: %s", endpoint, err)
+		}
+		env, err := client.Version()
+		if err != nil {
+			logErrorf("Error retrieving docker server version info of %s: %s\n", endpoint, err)
+		}
+		podman := isPodman(env)
+		if podman {
+			logInfof("Connected to Podman at %s: Swarm services, tasks and nodes are not inspected", endpoint)
+		}
+		hosts = append(hosts, dockerHost{Endpoint: endpoint, Client: client, Podman: podman})
+	}
+	return hosts, nil
+}
+
+// dockerHosts returns the daemon of the main endpoint followed by the extra
+// ones
+func (g *generator) dockerHosts() []dockerHost {
+	endpoint, err := GetEndpoint(g.Endpoint)
+	if err != nil {
+		endpoint = g.Endpoint
+	}
+	g.clientsMu.RLock()
+	defer g.clientsMu.RUnlock()
+	hosts := []dockerHost{{Endpoint: endpoint, Client: g.Client, Podman: g.podman}}
+	hosts = append(hosts, g.ExtraHosts...)
+	return append(hosts, g.configHosts...)
+}
+
+// newHostClient connects to the endpoint of host again, with the TLS
+// settings of its configs for the endpoints of configs
+func (g *generator) newHostClient(host dockerHost, endpoint string) (*docker.Client, error) {
+	if host.configOnly {
+		return NewDockerClientWithOptions(endpoint, host.tls.verify, host.tls.cert, host.tls.caCert, host.tls.key, g.ClientOptions)
+	}
+	return NewDockerClientWithOptions(endpoint, g.TLSVerify, g.TLSCert, g.TLSCaCert, g.TLSKey, g.ClientOptions)
+}
+
+// setHostClient replaces the client of the docker host of endpoint, so that
+// the containers are listed and the notifications sent with the client of
+// the new connection
+func (g *generator) setHostClient(endpoint string, client *docker.Client) {
+	g.clientsMu.Lock()
+	defer g.clientsMu.Unlock()
+	if main, err := GetEndpoint(g.Endpoint); err == nil && main == endpoint || g.Endpoint == endpoint {
+		g.Client = client
+		return
+	}
+	for i := range g.ExtraHosts {
+		if g.ExtraHosts[i].Endpoint == endpoint {
+			g.ExtraHosts[i].Client = client
+			return
+		}
+	}
+	for i := range g.configHosts {
+		if g.configHosts[i].Endpoint == endpoint {
+			g.configHosts[i].Client = client
+			return
+		}
+	}
+}
+
+// notifyHost returns the docker daemon config is rendered from, which its
+// containers and services are notified through
+func (g *generator) notifyHost(config Config) dockerHost {
+	hosts := g.dockerHosts()
+	for _, host := range hosts {
+		if config.Endpoint != "" && host.Endpoint == config.Endpoint {
+			return host
+		}
+	}
+	return hosts[0]
+}
+
+// rendersHost returns whether config is rendered from the docker daemon of
+// endpoint: the config's Endpoint, or the -endpoint daemons without one
+func (c *Config) rendersHost(endpoint string, configOnly bool) bool {
+	if c.Endpoint == "" {
+		return !configOnly
+	}
+	return c.Endpoint == endpoint
+}
+
+// connectConfigHosts connects to the endpoints of configs that aren't one of
+// the -endpoint daemons. Endpoints still used after a config reload keep
+// their client.
+func (g *generator) connectConfigHosts() error {
+	endpoint, err := GetEndpoint(g.Endpoint)
+	if err != nil {
+		endpoint = g.Endpoint
+	}
+	shared := map[string]bool{endpoint: true}
+	connected := map[string]dockerHost{}
+	for _, host := range g.dockerHosts() {
+		if host.configOnly {
+			connected[host.Endpoint] = host
+		} else {
+			shared[host.Endpoint] = true
+		}
+	}
+
+	hosts := []dockerHost{}
+	seen := map[string]dockerHost{}
+	for _, config := range g.configs().Config {
+		if config.Endpoint == "" || shared[config.Endpoint] {
+			continue
+		}
+		tls := dockerTLS{config.TLSCert, config.TLSKey, config.TLSCACert, config.TLSVerify}
+		if host, ok := seen[config.Endpoint]; ok {
+			if host.tls != tls {
+				return fmt.Errorf("Configs of endpoint %s have different TLS settings", config.Endpoint)
+			}
+			continue
+		}
+		if host, ok := connected[config.Endpoint]; ok && host.tls == tls {
+			seen[config.Endpoint] = host
+			hosts = append(hosts, host)
+			continue
+		}
+
+		if _, _, err := parseHost(config.Endpoint); err != nil {
+			return fmt.Errorf("Bad endpoint of %s: %s", config.Dest, err)
+		}
+		client, err := NewDockerClientWithOptions(config.Endpoint, config.TLSVerify, config.TLSCert, config.TLSCACert, config.TLSKey, g.ClientOptions)
+		if err != nil {
+			return fmt.Errorf("Unable to create docker client for %s: %s", config.Endpoint, err)
+		}
+		env, err := client.Version()
+		if err != nil {
+			logErrorf("Error retrieving docker server version info of %s: %s\n", config.Endpoint, err)
+		}
+		host := dockerHost{Endpoint: config.Endpoint, Client: client, Podman: isPodman(env), configOnly: true, tls: tls}
+		seen[config.Endpoint] = host
+		hosts = append(hosts, host)
+	}
+	g.clientsMu.Lock()
+	g.configHosts = hosts
+	g.clientsMu.Unlock()
+	return nil
+}
+
+// generateHostConfigs generates the configs rendered from host from a single
+// container listing, e.g. once its events are watched again
+func (g *generator) generateHostConfigs(host dockerHost, reason string) {
+	containers, errs, err := g.getContainers()
+	if err != nil {
+		logErrorf("Error listing containers: %s\n", err)
+		return
+	}
+	for _, config := range g.configs().Config {
+		if !config.rendersHost(host.Endpoint, host.configOnly) {
+			continue
+		}
+		config.trigger = reason
+		g.generateConfig(config, containers, errs, false)
+	}
+}
+
+// watchHosts passes the events of all docker hosts to the scheduler, and
+// closes events once the events of every host ended
+func (g *generator) watchHosts(events chan<- TriggerEvent) {
+	hosts := g.dockerHosts()
+	if len(hosts) == 1 {
+		g.watchEvents(hosts[0], events)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		hostEvents := make(chan TriggerEvent, 100)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for event := range hostEvents {
+				events <- event
+			}
+		}()
+		go g.watchEvents(host, hostEvents)
+	}
+	wg.Wait()
+	close(events)
+}
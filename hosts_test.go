@@ -0,0 +1,151 @@
+package dockergen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func newFakeDockerHost(t *testing.T, id string) (*httptest.Server, dockerHost) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			fmt.Fprintf(w, `[{"Id":%q}]`, id)
+		case strings.HasSuffix(r.URL.Path, "/containers/"+id+"/json"):
+			fmt.Fprintf(w, `{"Id":%q,"Name":"/%s","Config":{"Image":"web"},"NetworkSettings":{}}`, id, id)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, dockerHost{Endpoint: server.URL, Client: client}
+}
+
+func TestGetContainersFromHosts(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	SetDockerEnv(&docker.Env{})
+	server1, host1 := newFakeDockerHost(t, "web1")
+	defer server1.Close()
+	server2, host2 := newFakeDockerHost(t, "web2")
+	defer server2.Close()
+	down, host3 := newFakeDockerHost(t, "web3")
+	down.Close()
+
+	g := &generator{Client: host1.Client, Endpoint: host1.Endpoint, ExtraHosts: []dockerHost{host2, host3}}
+	containers, errs, err := g.getContainers()
+	if err != nil {
+		t.Fatalf("Expected the containers to be listed, got %v", err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("Expected the containers of both reachable hosts, got %d", len(containers))
+	}
+	for i, host := range []dockerHost{host1, host2} {
+		if containers[i].Name != fmt.Sprintf("web%d", i+1) || containers[i].Host != host.Endpoint {
+			t.Errorf("Unexpected container %s of %s", containers[i].Name, containers[i].Host)
+		}
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0], host3.Endpoint) {
+		t.Errorf("Expected the unreachable host to be reported, got %q", errs)
+	}
+}
+
+func TestConfigEndpoints(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	SetDockerEnv(&docker.Env{})
+	server1, host1 := newFakeDockerHost(t, "local")
+	defer server1.Close()
+	server2, _ := newFakeDockerHost(t, "remote")
+	defer server2.Close()
+	endpoint := "tcp://" + strings.TrimPrefix(server2.URL, "http://")
+
+	local := Config{Dest: "local.conf", IncludeStopped: true}
+	remote := Config{Dest: "remote.conf", Endpoint: endpoint, IncludeStopped: true}
+	g := &generator{Client: host1.Client, Endpoint: host1.Endpoint, Configs: ConfigFile{Config: []Config{local, remote, remote}}}
+	if err := g.connectConfigHosts(); err != nil {
+		t.Fatalf("Expected the config endpoint to be connected, got %v", err)
+	}
+	if len(g.configHosts) != 1 || g.configHosts[0].Endpoint != endpoint {
+		t.Fatalf("Expected one client for the config endpoint, got %+v", g.configHosts)
+	}
+	client := g.configHosts[0].Client
+
+	containers, _, err := g.getContainers()
+	if err != nil {
+		t.Fatalf("Expected the containers to be listed, got %v", err)
+	}
+	for config, expected := range map[*Config]string{&local: "local", &remote: "remote"} {
+		filtered := filterContainers(*config, containers)
+		if len(filtered) != 1 || filtered[0].Name != expected {
+			t.Errorf("Expected %s to be rendered from %s, got %d containers", config.Dest, expected, len(filtered))
+		}
+	}
+
+	// a config reload keeps the client of endpoints still in use
+	if err := g.connectConfigHosts(); err != nil || g.configHosts[0].Client != client {
+		t.Errorf("Expected the client to be kept, got %v", err)
+	}
+
+	conflicting := remote
+	conflicting.TLSVerify = true
+	g.Configs.Config = append(g.Configs.Config, conflicting)
+	if err := g.connectConfigHosts(); err == nil {
+		t.Error("Expected an error for configs of the same endpoint with different TLS settings")
+	}
+}
+
+func TestConfigEndpointEventsAndClients(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	SetDockerEnv(&docker.Env{})
+	server1, host1 := newFakeDockerHost(t, "local")
+	defer server1.Close()
+	server2, _ := newFakeDockerHost(t, "remote")
+	defer server2.Close()
+	endpoint := "tcp://" + strings.TrimPrefix(server2.URL, "http://")
+
+	local := Config{Dest: "local.conf", Watch: true}
+	remote := Config{Dest: "remote.conf", Endpoint: endpoint, Watch: true}
+	g := &generator{Client: host1.Client, Endpoint: host1.Endpoint, Configs: ConfigFile{Config: []Config{local, remote}}}
+	if err := g.connectConfigHosts(); err != nil {
+		t.Fatal(err)
+	}
+	hosts := g.dockerHosts()
+
+	start := &docker.APIEvents{ID: "web", Status: "start"}
+	for i, host := range hosts {
+		event := hostTriggerEvent(host, start)
+		if !g.Configs.Config[i].WantsEvent(event) || g.Configs.Config[1-i].WantsEvent(event) {
+			t.Errorf("Expected the events of %s to only regenerate %s", host.Endpoint, g.Configs.Config[i].Dest)
+		}
+		if got := g.notifyHost(g.Configs.Config[i]); got.Endpoint != host.Endpoint {
+			t.Errorf("Expected %s to be notified through %s, got %s", g.Configs.Config[i].Dest, host.Endpoint, got.Endpoint)
+		}
+	}
+
+	// the client of a reconnected config endpoint keeps its TLS settings
+	hosts[1].tls.verify = true
+	if _, err := g.newHostClient(hosts[1], endpoint); err == nil {
+		t.Error("Expected the client of the config endpoint to require its TLS certificates")
+	}
+	client, err := docker.NewClient(server2.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.setHostClient(endpoint, client)
+	if g.dockerHosts()[1].Client != client || g.notifyHost(remote).Client != client {
+		t.Error("Expected the reconnected client to replace the client of the config endpoint")
+	}
+	if g.dockerHosts()[0].Client != host1.Client {
+		t.Error("Expected the client of the main endpoint to be kept")
+	}
+}
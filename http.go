@@ -0,0 +1,110 @@
+package dockergen
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// newHTTPHandler returns the handler of the HTTP listener:
+//
+//	POST /regenerate[?config=NAME][&notify=false]
+//
+// regenerates the named config, or all configs, regardless of whether
+// anything changed.
+//
+//	GET /context
+//
+// returns the containers templates are rendered with as JSON. Requests must
+// carry the HTTPToken as a bearer token.
+//
+//	GET /healthz
+//
+// reports the docker connections and the last generation of each config,
+// without authentication.
+func (g *generator) newHTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/regenerate", g.authenticated(g.handleRegenerate))
+	mux.HandleFunc("/context", g.authenticated(g.handleContext))
+	mux.HandleFunc("/healthz", g.handleHealth)
+	return mux
+}
+
+// authenticated rejects requests without the configured bearer token. Without
+// a token, the protected endpoints are disabled.
+func (g *generator) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if g.HTTPToken == "" {
+			http.Error(w, "no HTTP token configured", http.StatusForbidden)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(g.HTTPToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (g *generator) handleRegenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	notify := true
+	if value := r.URL.Query().Get("notify"); value != "" {
+		var err error
+		if notify, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "invalid notify value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := g.trigger(r.URL.Query().Get("config"), notify)
+	switch {
+	case errors.Is(err, errUnknownConfig):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Write([]byte("ok\n"))
+	}
+}
+
+func (g *generator) serveHTTP() {
+	if g.HTTPAddr == "" {
+		return
+	}
+	if g.HTTPToken == "" {
+		logWarnf("No HTTP token configured; /regenerate and /context are disabled")
+	}
+
+	server := &http.Server{Addr: g.HTTPAddr, Handler: g.newHTTPHandler()}
+	go func() {
+		sigChan := g.newSignalChannel()
+		for sig := range sigChan {
+			switch sig {
+			case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+				server.Shutdown(context.Background())
+				return
+			}
+		}
+	}()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		logInfof("Listening on http://%s", g.HTTPAddr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logErrorf("Unable to listen on %s: %s\n", g.HTTPAddr, err)
+		}
+	}()
+}
@@ -0,0 +1,117 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestRegenerateEndpointErrors(t *testing.T) {
+	g := &generator{
+		HTTPToken: "secret",
+		Configs: ConfigFile{
+			Config: []Config{
+				Config{Name: "nginx", Dest: "/etc/nginx/conf.d/default.conf"},
+			},
+		},
+	}
+	handler := g.newHTTPHandler()
+
+	tests := []struct {
+		method string
+		url    string
+		token  string
+		status int
+	}{
+		{"POST", "/regenerate?config=nginx", "", http.StatusUnauthorized},
+		{"POST", "/regenerate?config=nginx", "wrong", http.StatusUnauthorized},
+		{"GET", "/regenerate?config=nginx", "secret", http.StatusMethodNotAllowed},
+		{"POST", "/regenerate?config=nginx&notify=maybe", "secret", http.StatusBadRequest},
+		{"POST", "/regenerate?config=missing", "secret", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d", test.method, test.url, test.status, w.Code)
+		}
+	}
+
+	g.HTTPToken = ""
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/regenerate", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d without a token, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestContextEndpoint(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	SetDockerEnv(&docker.Env{})
+	server, host := newFakeDockerHost(t, "web1")
+	defer server.Close()
+	g := &generator{Client: host.Client, Endpoint: host.Endpoint, HTTPToken: "secret"}
+	handler := g.newHTTPHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/context", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without the token, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/context", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var containers Context
+	if err := json.Unmarshal(w.Body.Bytes(), &containers); err != nil {
+		t.Fatalf("Expected a JSON array of containers, got %q: %v", w.Body.String(), err)
+	}
+	if len(containers) != 1 || containers[0].Name != "web1" {
+		t.Errorf("Unexpected containers %q", w.Body.String())
+	}
+}
+
+func TestHealthEndpoint(t *testing.T) {
+	g := &generator{}
+	handler := g.newHTTPHandler()
+	host := dockerHost{Endpoint: "unix:///var/run/docker.sock"}
+
+	health := func() (int, HealthReport) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		var health HealthReport
+		if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+			t.Fatalf("Unable to decode health: %s", err)
+		}
+		return w.Code, health
+	}
+
+	g.setWatching(host, true)
+	code, h := health()
+	if code != http.StatusOK || !h.Healthy {
+		t.Fatalf("Expected healthy while connected, got %d %+v", code, h)
+	}
+	if len(h.Docker) != 1 || h.Docker[0].Endpoint != host.Endpoint || !h.Docker[0].Connected {
+		t.Fatalf("Incorrect docker connections: %+v", h.Docker)
+	}
+
+	g.setWatching(host, false)
+	code, h = health()
+	if code != http.StatusServiceUnavailable || h.Healthy {
+		t.Fatalf("Expected unhealthy while disconnected, got %d %+v", code, h)
+	}
+}
@@ -0,0 +1,96 @@
+package dockergen
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// toInt64 converts numbers and numeric strings passed to template functions
+func toInt64(funcName string, input interface{}) (int64, error) {
+	if d, ok := input.(time.Duration); ok {
+		return int64(d), nil
+	}
+
+	v := reflect.ValueOf(input)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(v.Float()), nil
+	case reflect.String:
+		n, err := strconv.ParseInt(strings.TrimSpace(v.String()), 10, 64)
+		if err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("Must pass a number to '%s'; received %v", funcName, input)
+}
+
+// humanizeBytes formats a number of bytes with binary units, e.g. "1.5 GiB"
+func humanizeBytes(input interface{}) (string, error) {
+	n, err := toInt64("humanizeBytes", input)
+	if err != nil {
+		return "", err
+	}
+
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	if n < 1024 {
+		return fmt.Sprintf("%s%d B", sign, n), nil
+	}
+
+	value := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	unit := ""
+	for _, unit = range units {
+		value /= 1024
+		if value < 1024 {
+			break
+		}
+	}
+	return sign + strings.TrimSuffix(strings.TrimSuffix(fmt.Sprintf("%.1f", value), "0"), ".") + " " + unit, nil
+}
+
+// humanizeDuration formats a duration (or a number of nanoseconds) in days,
+// hours, minutes and seconds, e.g. "2d 3h 4m"
+func humanizeDuration(input interface{}) (string, error) {
+	n, err := toInt64("humanizeDuration", input)
+	if err != nil {
+		return "", err
+	}
+
+	d := time.Duration(n)
+	if d > -time.Second && d < time.Second {
+		return d.String(), nil
+	}
+
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	d = d.Round(time.Second)
+
+	parts := []string{}
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	} {
+		if d >= unit.size {
+			parts = append(parts, fmt.Sprintf("%d%s", d/unit.size, unit.suffix))
+			d %= unit.size
+		}
+	}
+	return sign + strings.Join(parts, " "), nil
+}
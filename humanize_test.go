@@ -0,0 +1,59 @@
+package dockergen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumanizeBytes(t *testing.T) {
+	tests := map[interface{}]string{
+		0:                  "0 B",
+		1023:               "1023 B",
+		1024:               "1 KiB",
+		int64(1536):        "1.5 KiB",
+		uint64(268435456):  "256 MiB",
+		"1610612736":       "1.5 GiB",
+		int64(-2048):       "-2 KiB",
+		float64(1 << 40):   "1 TiB",
+		int64(1073741824):  "1 GiB",
+		int64(1181116006):  "1.1 GiB",
+		int64(10737418240): "10 GiB",
+	}
+
+	for input, expected := range tests {
+		got, err := humanizeBytes(input)
+		if err != nil {
+			t.Fatalf("humanizeBytes(%v) failed: %v", input, err)
+		}
+		if got != expected {
+			t.Errorf("humanizeBytes(%v): expected %q, got %q", input, expected, got)
+		}
+	}
+
+	if _, err := humanizeBytes("lots"); err == nil {
+		t.Error("expected an error humanizing a non-number")
+	}
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	tests := map[interface{}]string{
+		time.Duration(0):                               "0s",
+		1500 * time.Millisecond:                        "2s",
+		90 * time.Second:                               "1m 30s",
+		26*time.Hour + 4*time.Minute:                   "1d 2h 4m",
+		int64(3 * time.Hour):                           "3h",
+		-(2*time.Hour + time.Second):                   "-2h 1s",
+		250 * time.Millisecond:                         "250ms",
+		48*time.Hour + 59*time.Minute + 59*time.Second: "2d 59m 59s",
+	}
+
+	for input, expected := range tests {
+		got, err := humanizeDuration(input)
+		if err != nil {
+			t.Fatalf("humanizeDuration(%v) failed: %v", input, err)
+		}
+		if got != expected {
+			t.Errorf("humanizeDuration(%v): expected %q, got %q", input, expected, got)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package dockergen
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// imageCache holds the inspections of the images of all hosts, keyed by host
+// endpoint and image ID. Images are immutable, so entries don't expire.
+type imageCache struct {
+	sync.Mutex
+	entries map[string]*docker.Image
+}
+
+// inspectImage returns the inspection of the image id of host
+func (g *generator) inspectImage(host dockerHost, id string) (*docker.Image, error) {
+	key := host.Endpoint + "/" + id
+	g.images.Lock()
+	image, ok := g.images.entries[key]
+	g.images.Unlock()
+	if ok {
+		return image, nil
+	}
+
+	image, err := host.Client.InspectImage(id)
+	if err != nil {
+		return nil, err
+	}
+	g.images.Lock()
+	if g.images.entries == nil {
+		g.images.entries = map[string]*docker.Image{}
+	}
+	g.images.entries[key] = image
+	g.images.Unlock()
+	return image, nil
+}
+
+// setImageMeta adds the meta-data of the inspection of the image of a
+// container to image
+func setImageMeta(image *DockerImage, inspection *docker.Image) {
+	image.ID = inspection.ID
+	image.Created = inspection.Created
+	image.Labels = map[string]string{}
+	image.ExposedPorts = []string{}
+	if inspection.Config != nil {
+		for k, v := range inspection.Config.Labels {
+			image.Labels[k] = v
+		}
+		for port := range inspection.Config.ExposedPorts {
+			image.ExposedPorts = append(image.ExposedPorts, string(port))
+		}
+		sort.Strings(image.ExposedPorts)
+	}
+
+	// the digest of the repository the container was started from, if the
+	// image was pulled from several
+	for _, repoDigest := range inspection.RepoDigests {
+		i := strings.LastIndex(repoDigest, "@")
+		if i < 0 {
+			continue
+		}
+		repository := repoDigest[:i]
+		if image.Digest == "" || repository == image.Repository || repository == image.Registry+"/"+image.Repository {
+			image.Digest = repoDigest[i+1:]
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package dockergen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestInspectImage(t *testing.T) {
+	inspections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/images/sha256:abc/json") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		inspections++
+		w.Write([]byte(`{
+			"Id": "sha256:abc",
+			"Created": "2024-05-02T10:00:00Z",
+			"RepoDigests": ["mirror.local/nginx@sha256:111", "nginx@sha256:222"],
+			"Config": {"Labels": {"org.opencontainers.image.version": "1.25"}, "ExposedPorts": {"80/tcp": {}, "443/tcp": {}}}
+		}`))
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := dockerHost{Endpoint: server.URL, Client: client}
+
+	g := &generator{}
+	for i := 0; i < 2; i++ {
+		inspection, err := g.inspectImage(host, "sha256:abc")
+		if err != nil {
+			t.Fatalf("Unable to inspect image: %v", err)
+		}
+		image := DockerImage{Repository: "nginx", Tag: "1.25"}
+		setImageMeta(&image, inspection)
+		expected := DockerImage{
+			Repository:   "nginx",
+			Tag:          "1.25",
+			ID:           "sha256:abc",
+			Digest:       "sha256:222",
+			Labels:       map[string]string{"org.opencontainers.image.version": "1.25"},
+			ExposedPorts: []string{"443/tcp", "80/tcp"},
+			Created:      time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+		}
+		if !reflect.DeepEqual(image, expected) {
+			t.Fatalf("expected: %+v. got: %+v", expected, image)
+		}
+	}
+	if inspections != 1 {
+		t.Errorf("Expected the image to be inspected once, got %d", inspections)
+	}
+}
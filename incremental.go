@@ -0,0 +1,231 @@
+package dockergen
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// containerStore is the context maintained from docker events with
+// -resync-interval: only the containers of events are inspected again, and
+// the containers of all hosts are listed every ResyncInterval
+type containerStore struct {
+	sync.Mutex
+	containers []*RuntimeContainer
+	synced     time.Time
+	// changed are the IDs of the containers of the events since the last
+	// update, by host endpoint
+	changed map[string]map[string]bool
+
+	// updateMu serializes the updates, so that a generation doesn't miss
+	// the containers another one is inspecting
+	updateMu sync.Mutex
+}
+
+// incremental returns whether the context is updated from docker events
+// between full listings. Events aren't watched when polling, and the list
+// filters of configs are only applied by dockerd.
+func (g *generator) incremental() bool {
+	if g.ResyncInterval <= 0 || g.PollInterval > 0 || g.streamOnly() {
+		return false
+	}
+	watching := false
+	for _, config := range g.configs().Config {
+		if len(config.Filters) > 0 {
+			return false
+		}
+		watching = watching || config.Watch
+	}
+	return watching
+}
+
+// eventContainerID returns the container an event concerns: the container of
+// container events and the container connected or disconnected by network
+// events
+func eventContainerID(event *docker.APIEvents) string {
+	switch event.Type {
+	case "", "container":
+		return event.ID
+	case "network":
+		return event.Actor.Attributes["container"]
+	}
+	return ""
+}
+
+// containerChanged records the container of an event of host to be inspected
+// again by the next update of the context
+func (g *generator) containerChanged(host dockerHost, event *docker.APIEvents) {
+	id := eventContainerID(event)
+	if id == "" || !g.incremental() {
+		return
+	}
+	g.containerIDChanged(host.Endpoint, id)
+}
+
+// containerIDChanged records the container id of the host endpoint to be
+// inspected again by the next update of the context
+func (g *generator) containerIDChanged(endpoint, id string) {
+	g.store.Lock()
+	defer g.store.Unlock()
+	if g.store.changed == nil {
+		g.store.changed = make(map[string]map[string]bool)
+	}
+	if g.store.changed[endpoint] == nil {
+		g.store.changed[endpoint] = make(map[string]bool)
+	}
+	g.store.changed[endpoint][id] = true
+}
+
+// resyncContainers makes the next context a full listing, e.g. after events
+// may have been missed
+func (g *generator) resyncContainers() {
+	g.store.Lock()
+	defer g.store.Unlock()
+	g.store.synced = time.Time{}
+}
+
+// storeContainers records the containers of a full listing
+func (g *generator) storeContainers(containers []*RuntimeContainer) {
+	if !g.incremental() {
+		return
+	}
+	g.store.Lock()
+	defer g.store.Unlock()
+	g.store.containers = append([]*RuntimeContainer{}, containers...)
+	g.store.synced = time.Now()
+}
+
+// updateContainers returns the context of the previous listing updated with
+// the containers of the events since and the errors inspecting them, or
+// false when the containers have to be listed
+func (g *generator) updateContainers() ([]*RuntimeContainer, []string, bool) {
+	if !g.incremental() {
+		return nil, nil, false
+	}
+	g.store.updateMu.Lock()
+	defer g.store.updateMu.Unlock()
+	// the containers are inspected without the lock, which the event loop
+	// takes for each event
+	g.store.Lock()
+	changed := g.store.changed
+	g.store.changed = nil
+	if g.store.synced.IsZero() || time.Since(g.store.synced) >= g.ResyncInterval {
+		// the listing covers the events so far, those arriving meanwhile
+		// are applied to it next time
+		g.store.Unlock()
+		return nil, nil, false
+	}
+	g.store.Unlock()
+
+	var errs []string
+	logError := func(format string, v ...interface{}) {
+		msg := fmt.Sprintf(format, v...)
+		logErrorf("%s", msg)
+		errs = append(errs, strings.TrimSpace(msg))
+	}
+	hosts := map[string]dockerHost{}
+	for _, host := range g.dockerHosts() {
+		hosts[host.Endpoint] = host
+	}
+	listed := &Config{LabelFilters: g.configs().LabelFilters()}
+
+	type update struct {
+		host, id  string
+		container *RuntimeContainer
+	}
+	updates := []update{}
+	for endpoint, ids := range changed {
+		host, ok := hosts[endpoint]
+		if !ok {
+			continue
+		}
+		swarm := newSwarmInspector(host.Client, logError)
+		for id := range ids {
+			var updated *RuntimeContainer
+			inspection, err := g.inspect(host, id)
+			if _, removed := err.(*docker.NoSuchContainer); err != nil && !removed {
+				logError("Error inspecting container: %s: %s\n", id, err)
+				// inspected again by the next update
+				g.containerIDChanged(endpoint, id)
+				continue
+			} else if err == nil {
+				updated = g.runtimeContainer(host, inspection, swarm, logError)
+				// the containers dockerd would list
+				if !(g.All || updated.State.Running) || !listed.MatchesLabels(updated.Labels) {
+					updated = nil
+				}
+			}
+			updates = append(updates, update{endpoint, id, updated})
+		}
+	}
+
+	g.store.Lock()
+	containers := g.store.containers
+	for _, u := range updates {
+		containers = replaceContainer(containers, u.host, u.id, u.container)
+		logDebugf("Updated container %s of %s", shortIdent(u.id), u.host)
+	}
+	g.store.containers = containers
+	g.store.Unlock()
+
+	for _, err := range loadComposeProjects(g.ComposeFiles) {
+		logError("Error loading compose file: %s\n", err)
+	}
+	return append([]*RuntimeContainer{}, containers...), errs, true
+}
+
+// replaceContainer returns containers with the container id of host replaced
+// by updated, or without it when updated is nil. New containers come first,
+// as dockerd lists the most recent containers first.
+func replaceContainer(containers []*RuntimeContainer, host, id string, updated *RuntimeContainer) []*RuntimeContainer {
+	result := make([]*RuntimeContainer, 0, len(containers)+1)
+	found := false
+	for _, container := range containers {
+		if container.Host != host || container.ID != id {
+			result = append(result, container)
+			continue
+		}
+		found = true
+		if updated != nil {
+			result = append(result, updated)
+		}
+	}
+	if !found && updated != nil {
+		result = append([]*RuntimeContainer{updated}, result...)
+	}
+	return result
+}
+
+// resyncPeriodically lists the containers of all hosts and generates all
+// configs every ResyncInterval, so that changes without a container event,
+// e.g. of swarm services, aren't missed
+func (g *generator) resyncPeriodically() {
+	if !g.incremental() {
+		return
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		ticker := time.NewTicker(g.ResyncInterval)
+		defer ticker.Stop()
+		sigChan := g.newSignalChannel()
+		for {
+			select {
+			case <-ticker.C:
+				g.resyncContainers()
+				g.generateFromContainers("resync")
+			case sig := <-sigChan:
+				switch sig {
+				case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+					return
+				}
+			}
+		}
+	}()
+}
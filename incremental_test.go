@@ -0,0 +1,191 @@
+package dockergen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestIncrementalContainers(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	SetDockerEnv(&docker.Env{})
+
+	var mu sync.Mutex
+	running := map[string]bool{"web1": true, "web2": true}
+	lists, inspects := 0, map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			lists++
+			ids := []string{}
+			for id := range running {
+				ids = append(ids, fmt.Sprintf(`{"Id":%q}`, id))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(ids, ","))
+		case strings.HasPrefix(r.URL.Path, "/containers/") && strings.HasSuffix(r.URL.Path, "/json"):
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/json")
+			inspects[id]++
+			if _, ok := running[id]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"Id":%q,"Name":"/%s","Config":{"Image":"web"},"State":{"Running":true},"NetworkSettings":{}}`, id, id)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := dockerHost{Endpoint: server.URL, Client: client}
+
+	g := &generator{
+		Client:         client,
+		Endpoint:       server.URL,
+		ResyncInterval: time.Hour,
+		Configs:        ConfigFile{Config: []Config{{Watch: true}}},
+	}
+	names := func(containers []*RuntimeContainer) []string {
+		names := []string{}
+		for _, container := range containers {
+			names = append(names, container.Name)
+		}
+		return names
+	}
+
+	if _, _, err := g.getContainers(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	delete(running, "web2")
+	running["web3"] = true
+	mu.Unlock()
+	g.containerChanged(host, &docker.APIEvents{Type: "container", Action: "destroy", ID: "web2"})
+	g.containerChanged(host, &docker.APIEvents{Type: "container", Action: "start", ID: "web3"})
+	containers, _, err := g.getContainers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names(containers), ","); got != "web3,web1" {
+		t.Errorf("Expected the containers to be updated from the events, got %s", got)
+	}
+	mu.Lock()
+	if lists != 1 || inspects["web1"] != 1 || inspects["web2"] != 2 || inspects["web3"] != 1 {
+		t.Errorf("Expected only the containers of the events to be inspected again, got %d listings and inspections %v", lists, inspects)
+	}
+	mu.Unlock()
+
+	g.resyncContainers()
+	containers, _, err = g.getContainers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 {
+		t.Errorf("Expected the 2 running containers, got %v", names(containers))
+	}
+	mu.Lock()
+	if lists != 2 {
+		t.Errorf("Expected a resync to list the containers, got %d listings", lists)
+	}
+	mu.Unlock()
+}
+
+func TestIncrementalRequiresEvents(t *testing.T) {
+	watch := ConfigFile{Config: []Config{{Watch: true}}}
+	for _, test := range []struct {
+		g        *generator
+		expected bool
+	}{
+		{&generator{Configs: watch}, false},
+		{&generator{ResyncInterval: time.Minute, Configs: watch}, true},
+		{&generator{ResyncInterval: time.Minute, Configs: ConfigFile{Config: []Config{{}}}}, false},
+		{&generator{ResyncInterval: time.Minute, PollInterval: time.Second, Configs: watch}, false},
+		{&generator{ResyncInterval: time.Minute, Configs: ConfigFile{Config: []Config{{Watch: true, Filters: map[string][]string{"label": {"web"}}}}}}, false},
+	} {
+		if got := test.g.incremental(); got != test.expected {
+			t.Errorf("Expected incremental to be %v for %+v, got %v", test.expected, test.g.Configs.Config, got)
+		}
+	}
+}
+
+func TestIncrementalEventsDuringInspection(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	SetDockerEnv(&docker.Env{})
+
+	inspecting, release := make(chan bool, 1), make(chan bool)
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.Write([]byte(`[]`))
+		case strings.HasSuffix(r.URL.Path, "/containers/slow/json"):
+			once.Do(func() {
+				inspecting <- true
+				<-release
+			})
+			w.Write([]byte(`{"Id":"slow","Name":"/slow","Config":{"Image":"web"},"State":{"Running":true},"NetworkSettings":{}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := dockerHost{Endpoint: server.URL, Client: client}
+	g := &generator{
+		Client:         client,
+		Endpoint:       server.URL,
+		ResyncInterval: time.Hour,
+		Configs:        ConfigFile{Config: []Config{{Watch: true}}},
+	}
+	if _, _, err := g.getContainers(); err != nil {
+		t.Fatal(err)
+	}
+
+	g.containerChanged(host, &docker.APIEvents{Type: "container", Action: "start", ID: "slow"})
+	done := make(chan []*RuntimeContainer)
+	go func() {
+		containers, _, _ := g.getContainers()
+		done <- containers
+	}()
+	<-inspecting
+
+	recorded := make(chan bool)
+	go func() {
+		g.containerChanged(host, &docker.APIEvents{Type: "container", Action: "start", ID: "other"})
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected events to be recorded while a container is inspected")
+	}
+	close(release)
+	if containers := <-done; len(containers) != 1 || containers[0].ID != "slow" {
+		t.Errorf("Expected the inspected container to be added, got %d containers", len(containers))
+	}
+	g.store.Lock()
+	defer g.store.Unlock()
+	if !g.store.changed[server.URL]["other"] {
+		t.Error("Expected the event received during the update to be kept for the next one")
+	}
+}
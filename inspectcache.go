@@ -0,0 +1,123 @@
+package dockergen
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// inspectCache holds the inspections of the containers of all hosts, keyed by
+// host endpoint and container ID
+type inspectCache struct {
+	sync.Mutex
+	entries map[string]inspectCacheEntry
+	// inflight counts the inspections in progress of each key, and stale
+	// marks those of them started before an invalidation, which aren't cached
+	inflight map[string]int
+	stale    map[string]bool
+}
+
+type inspectCacheEntry struct {
+	container *docker.Container
+	inspected time.Time
+}
+
+func inspectCacheKey(host dockerHost, id string) string {
+	return host.Endpoint + "/" + id
+}
+
+// cachingInspections returns whether container inspections are cached. They
+// are only cached while configs watch docker events, which invalidate them;
+// polling misses the events updating containers.
+func (g *generator) cachingInspections() bool {
+	if g.InspectCacheTTL <= 0 || g.PollInterval > 0 {
+		return false
+	}
+	for _, config := range g.configs().Config {
+		if config.Watch {
+			return true
+		}
+	}
+	return false
+}
+
+// inspect returns the inspection of the container id of host, cached until an
+// event of the container arrives or for at most InspectCacheTTL
+func (g *generator) inspect(host dockerHost, id string) (*docker.Container, error) {
+	caching := g.cachingInspections()
+	key := inspectCacheKey(host, id)
+	if caching {
+		g.inspections.Lock()
+		entry, ok := g.inspections.entries[key]
+		if ok && time.Since(entry.inspected) < g.InspectCacheTTL {
+			g.inspections.Unlock()
+			return entry.container, nil
+		}
+		if g.inspections.inflight == nil {
+			g.inspections.inflight = make(map[string]int)
+			g.inspections.stale = make(map[string]bool)
+		}
+		g.inspections.inflight[key]++
+		g.inspections.Unlock()
+	}
+
+	ctx, cancel := g.apiContext()
+	container, err := host.Client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: id, Context: ctx})
+	cancel()
+	if !caching {
+		return container, err
+	}
+	g.inspections.Lock()
+	defer g.inspections.Unlock()
+	stale := g.inspections.stale[key]
+	if g.inspections.inflight[key]--; g.inspections.inflight[key] == 0 {
+		delete(g.inspections.inflight, key)
+		delete(g.inspections.stale, key)
+	}
+	// an event during the inspection may have changed the container
+	if err != nil || stale {
+		return container, err
+	}
+	if g.inspections.entries == nil {
+		g.inspections.entries = make(map[string]inspectCacheEntry)
+	}
+	g.inspections.entries[key] = inspectCacheEntry{container, time.Now()}
+	return container, nil
+}
+
+// invalidateInspections drops the cached inspections of the containers an
+// event of host concerns: the container of container events, and the
+// container connected or disconnected by network events
+func (g *generator) invalidateInspections(host dockerHost, event *docker.APIEvents) {
+	id := eventContainerID(event)
+	if id == "" {
+		return
+	}
+	key := inspectCacheKey(host, id)
+	g.inspections.Lock()
+	defer g.inspections.Unlock()
+	delete(g.inspections.entries, key)
+	if g.inspections.inflight[key] > 0 {
+		g.inspections.stale[key] = true
+	}
+}
+
+// clearInspections drops the cached inspections of host, whose events may
+// have been missed while its connection was lost
+func (g *generator) clearInspections(host dockerHost) {
+	prefix := inspectCacheKey(host, "")
+	g.inspections.Lock()
+	defer g.inspections.Unlock()
+	for key := range g.inspections.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(g.inspections.entries, key)
+		}
+	}
+	for key := range g.inspections.inflight {
+		if strings.HasPrefix(key, prefix) {
+			g.inspections.stale[key] = true
+		}
+	}
+}
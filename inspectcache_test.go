@@ -0,0 +1,112 @@
+package dockergen
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestInspectCache(t *testing.T) {
+	var inspections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&inspections, 1)
+		fmt.Fprint(w, `{"Id":"web","Name":"/web","Config":{"Image":"web"},"NetworkSettings":{}}`)
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := dockerHost{Endpoint: server.URL, Client: client}
+	g := &generator{
+		Configs:         ConfigFile{Config: []Config{{Watch: true}}},
+		InspectCacheTTL: time.Minute,
+	}
+
+	expectInspections := func(expected int32) {
+		t.Helper()
+		if _, err := g.inspect(host, "web"); err != nil {
+			t.Fatal(err)
+		}
+		if got := atomic.LoadInt32(&inspections); got != expected {
+			t.Errorf("Expected %d inspections, got %d", expected, got)
+		}
+	}
+	expectInspections(1)
+	expectInspections(1)
+
+	// events of other containers keep the inspection
+	g.invalidateInspections(host, &docker.APIEvents{Type: "container", ID: "db"})
+	expectInspections(1)
+	g.invalidateInspections(host, &docker.APIEvents{Type: "container", ID: "web"})
+	expectInspections(2)
+	g.invalidateInspections(host, &docker.APIEvents{
+		Type:  "network",
+		Actor: docker.APIActor{ID: "net", Attributes: map[string]string{"container": "web"}},
+	})
+	expectInspections(3)
+	g.clearInspections(host)
+	expectInspections(4)
+
+	g.InspectCacheTTL = time.Nanosecond
+	expectInspections(5)
+
+	// without watched events, nothing invalidates the inspections
+	g.InspectCacheTTL = time.Minute
+	g.Configs.Config[0].Watch = false
+	expectInspections(6)
+	expectInspections(7)
+}
+
+func TestInspectCacheInvalidatedDuringInspection(t *testing.T) {
+	var inspections int32
+	inspecting, release := make(chan bool), make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&inspections, 1) == 1 {
+			inspecting <- true
+			<-release
+		}
+		fmt.Fprint(w, `{"Id":"web","Name":"/web","Config":{"Image":"web"},"NetworkSettings":{}}`)
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := dockerHost{Endpoint: server.URL, Client: client}
+	g := &generator{
+		Configs:         ConfigFile{Config: []Config{{Watch: true}}},
+		InspectCacheTTL: time.Minute,
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := g.inspect(host, "web")
+		done <- err
+	}()
+	<-inspecting
+	g.invalidateInspections(host, &docker.APIEvents{Type: "container", ID: "web"})
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the inspection started before the event isn't cached
+	if _, err := g.inspect(host, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&inspections); got != 2 {
+		t.Errorf("Expected the container to be inspected again, got %d inspections", got)
+	}
+	if _, err := g.inspect(host, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&inspections); got != 2 {
+		t.Errorf("Expected the second inspection to be cached, got %d inspections", got)
+	}
+}
@@ -0,0 +1,268 @@
+package dockergen
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// kvTimeout limits each request to a KV store
+const kvTimeout = 30 * time.Second
+
+// kvCASAttempts is how often an update conflicting with a concurrent writer
+// is retried
+const kvCASAttempts = 5
+
+// remoteDest is a dest outside of the local filesystem, such as a Consul or
+// etcd key, a Swarm config or a Kubernetes ConfigMap. Updates are conditional on the version read before, so that
+// concurrent writers don't clobber each other.
+type remoteDest interface {
+	// read returns the current contents and their version, or
+	// os.ErrNotExist when the dest doesn't exist yet
+	read(ctx context.Context) ([]byte, string, error)
+	// write replaces the contents if they are still at version, "" meaning
+	// that the dest must not exist. It returns false on a conflict.
+	write(ctx context.Context, contents []byte, version string) (bool, error)
+}
+
+// newRemoteDest returns the remote dest of consul://host:port/key,
+// etcd://host:port/key, swarm-config://name and
+// configmap://namespace/name/key URIs, or false for file destinations. Swarm
+// configs are written with swarmClient.
+func newRemoteDest(dest string, swarmClient *docker.Client) (remoteDest, bool, error) {
+	i := strings.Index(dest, "://")
+	if i < 0 {
+		return nil, false, nil
+	}
+	switch dest[:i] {
+	case "consul", "etcd", "swarm-config", "configmap":
+	default:
+		return nil, false, nil
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, true, fmt.Errorf("Invalid dest %q: %s", dest, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+
+	switch u.Scheme {
+	case "swarm-config":
+		if u.Host == "" || key != "" {
+			return nil, true, fmt.Errorf("Invalid dest %q: must be swarm-config://name", dest)
+		}
+		if swarmClient == nil {
+			return nil, true, fmt.Errorf("Invalid dest %q: no docker client", dest)
+		}
+		return &swarmConfig{swarmClient, u.Host}, true, nil
+	case "configmap":
+		parts := strings.Split(key, "/")
+		if u.Host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, true, fmt.Errorf("Invalid dest %q: must be configmap://namespace/name/key", dest)
+		}
+		client, err := newKubernetesClient()
+		if err != nil {
+			return nil, true, err
+		}
+		return &configMapKey{client, u.Host, parts[0], parts[1]}, true, nil
+	}
+
+	if u.Host == "" || key == "" {
+		return nil, true, fmt.Errorf("Invalid dest %q: must be %s://host:port/key", dest, u.Scheme)
+	}
+	if u.Scheme == "consul" {
+		return &consulKey{newConsulClient(u.Host), key}, true, nil
+	}
+	// etcd keys are commonly absolute paths
+	return &etcdKey{newEtcdClient(u.Host, ""), "/" + key}, true, nil
+}
+
+// isRemoteDest returns whether dest is written to a remote store rather than a file
+func isRemoteDest(dest string) bool {
+	_, ok, _ := newRemoteDest(dest, nil)
+	return ok
+}
+
+// readDest returns the current contents of dest, a file or a remote dest.
+// Swarm configs are read with swarmClient.
+func readDest(dest string, swarmClient *docker.Client) ([]byte, error) {
+	remote, ok, err := newRemoteDest(dest, swarmClient)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return ioutil.ReadFile(dest)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kvTimeout)
+	defer cancel()
+	contents, _, err := remote.read(ctx)
+	return contents, err
+}
+
+// writeRemoteDest stores contents with the provenance header of config in a
+// remote dest unless it already holds them. Conflicting updates by other
+// writers are retried on the new version.
+func writeRemoteDest(config Config, remote remoteDest, contents []byte) (bool, error) {
+	output := append(provenanceHeader(config, contents), contents...)
+	for attempt := 1; attempt <= kvCASAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), kvTimeout)
+		current, version, err := remote.read(ctx)
+		if err == os.ErrNotExist {
+			version, err = "", nil
+		} else if err == nil && bytes.Equal(stripProvenanceHeader(config, current), contents) {
+			cancel()
+			return false, nil
+		}
+		if err != nil {
+			cancel()
+			return false, err
+		}
+		ok, err := remote.write(ctx, output, version)
+		cancel()
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+		logDebugf("Concurrent update of %s, retrying", config.Dest)
+	}
+	return false, fmt.Errorf("Unable to update %s: %d concurrent updates", config.Dest, kvCASAttempts)
+}
+
+// consulKey is a key of the Consul KV store, updated with check-and-set
+type consulKey struct {
+	client *consulClient
+	key    string
+}
+
+func (k *consulKey) do(ctx context.Context, method, query string, body []byte) (*http.Response, error) {
+	u := k.client.addr + "/v1/kv/" + k.key + query
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if k.client.token != "" {
+		req.Header.Set("X-Consul-Token", k.client.token)
+	}
+	return k.client.client.Do(req)
+}
+
+func (k *consulKey) read(ctx context.Context) ([]byte, string, error) {
+	resp, err := k.do(ctx, "GET", "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET /v1/kv/%s: %s", k.key, resp.Status)
+	}
+	var entries []struct {
+		ModifyIndex uint64
+		Value       []byte
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, "", err
+	}
+	if len(entries) == 0 {
+		return nil, "", os.ErrNotExist
+	}
+	return entries[0].Value, strconv.FormatUint(entries[0].ModifyIndex, 10), nil
+}
+
+func (k *consulKey) write(ctx context.Context, contents []byte, version string) (bool, error) {
+	// a cas index of 0 only creates the key
+	if version == "" {
+		version = "0"
+	}
+	resp, err := k.do(ctx, "PUT", "?cas="+version, contents)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("PUT /v1/kv/%s: %s", k.key, resp.Status)
+	}
+	var ok bool
+	if err := json.NewDecoder(resp.Body).Decode(&ok); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// etcdKey is a key of an etcd v3 server, updated with transactions comparing
+// its mod revision
+type etcdKey struct {
+	client *etcdClient
+	key    string
+}
+
+func (k *etcdKey) read(ctx context.Context) ([]byte, string, error) {
+	resp, err := k.client.post(ctx, "/v3/kv/range", map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(k.key)),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Kvs []struct {
+			Value       []byte `json:"value"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, "", err
+	}
+	if len(result.Kvs) == 0 {
+		return nil, "", os.ErrNotExist
+	}
+	return result.Kvs[0].Value, result.Kvs[0].ModRevision, nil
+}
+
+func (k *etcdKey) write(ctx context.Context, contents []byte, version string) (bool, error) {
+	key := base64.StdEncoding.EncodeToString([]byte(k.key))
+	compare := map[string]string{"key": key, "target": "MOD", "mod_revision": version}
+	if version == "" {
+		// the key must not exist yet
+		compare = map[string]string{"key": key, "target": "CREATE", "create_revision": "0"}
+	}
+	resp, err := k.client.post(ctx, "/v3/kv/txn", map[string]interface{}{
+		"compare": []interface{}{compare},
+		"success": []interface{}{
+			map[string]interface{}{
+				"request_put": map[string]string{
+					"key":   key,
+					"value": base64.StdEncoding.EncodeToString(contents),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Succeeded, nil
+}
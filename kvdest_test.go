@@ -0,0 +1,170 @@
+package dockergen
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeConsulKV serves the check-and-set API of a Consul KV store
+type fakeConsulKV struct {
+	mu       sync.Mutex
+	value    []byte
+	index    uint64
+	puts     int
+	conflict bool
+}
+
+func (kv *fakeConsulKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	switch r.Method {
+	case "GET":
+		if kv.index == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]interface{}{{"ModifyIndex": kv.index, "Value": kv.value}})
+	case "PUT":
+		kv.puts++
+		cas, _ := strconv.ParseUint(r.URL.Query().Get("cas"), 10, 64)
+		if kv.conflict {
+			// another writer updated the key after it was read
+			kv.conflict = false
+			kv.index++
+		}
+		if cas != kv.index {
+			fmt.Fprint(w, "false")
+			return
+		}
+		kv.value, _ = ioutil.ReadAll(r.Body)
+		kv.index++
+		fmt.Fprint(w, "true")
+	}
+}
+
+func TestGenerateFileConsulDest(t *testing.T) {
+	kv := &fakeConsulKV{}
+	server := httptest.NewServer(kv)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmplPath := filepath.Join(dir, "test.tmpl")
+	if err := ioutil.WriteFile(tmplPath, []byte("backend web"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	config := Config{
+		Template: tmplPath,
+		Dest:     "consul://" + strings.TrimPrefix(server.URL, "http://") + "/haproxy/backends",
+	}
+
+	if !GenerateFile(config, Context{}) {
+		t.Fatal("Expected the key to be created")
+	}
+	if string(kv.value) != "backend web" {
+		t.Fatalf("Incorrect value; expected %q, got %q", "backend web", kv.value)
+	}
+	if GenerateFile(config, Context{}) {
+		t.Fatal("Expected the key to be unchanged")
+	}
+	if contents, err := readDest(config.Dest, nil); err != nil || string(contents) != "backend web" {
+		t.Fatalf("Expected to read the key back, got %q, %v", contents, err)
+	}
+
+	if err := ioutil.WriteFile(tmplPath, []byte("backend api"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	kv.puts = 0
+	kv.conflict = true
+	if !GenerateFile(config, Context{}) {
+		t.Fatal("Expected the key to be updated")
+	}
+	if string(kv.value) != "backend api" || kv.puts != 2 {
+		t.Fatalf("Expected the conflicting update to be retried, got %q after %d puts", kv.value, kv.puts)
+	}
+}
+
+func TestEtcdKeyCompareAndSwap(t *testing.T) {
+	var (
+		value    []byte
+		revision int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			if key, _ := base64.StdEncoding.DecodeString(request["key"].(string)); string(key) != "/haproxy/backends" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if revision == 0 {
+				fmt.Fprint(w, `{"header":{"revision":"1"}}`)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"kvs": []map[string]interface{}{{"value": value, "mod_revision": strconv.Itoa(revision)}},
+			})
+		case "/v3/kv/txn":
+			compare := request["compare"].([]interface{})[0].(map[string]interface{})
+			succeeded := (compare["target"] == "CREATE" && revision == 0) ||
+				(compare["target"] == "MOD" && compare["mod_revision"] == strconv.Itoa(revision))
+			if succeeded {
+				put := request["success"].([]interface{})[0].(map[string]interface{})["request_put"].(map[string]interface{})
+				value, _ = base64.StdEncoding.DecodeString(put["value"].(string))
+				revision++
+			}
+			fmt.Fprintf(w, `{"succeeded":%t}`, succeeded)
+		}
+	}))
+	defer server.Close()
+
+	dest := "etcd://" + strings.TrimPrefix(server.URL, "http://") + "/haproxy/backends"
+	remote, ok, err := newRemoteDest(dest, nil)
+	if !ok || err != nil {
+		t.Fatalf("Expected %s to be a remote dest, got %v", dest, err)
+	}
+	config := Config{Dest: dest}
+	for i, contents := range []string{"backend web", "backend api"} {
+		changed, err := writeRemoteDest(config, remote, []byte(contents))
+		if err != nil || !changed {
+			t.Fatalf("Expected %q to be written, got %t, %v", contents, changed, err)
+		}
+		if string(value) != contents || revision != i+1 {
+			t.Fatalf("Incorrect value; expected %q at revision %d, got %q at %d", contents, i+1, value, revision)
+		}
+	}
+	if changed, err := writeRemoteDest(config, remote, []byte("backend api")); changed || err != nil {
+		t.Fatalf("Expected the key to be unchanged, got %t, %v", changed, err)
+	}
+}
+
+func TestNewRemoteDest(t *testing.T) {
+	for dest, expected := range map[string]bool{
+		"/etc/nginx/conf.d/default.conf": false,
+		"consul://127.0.0.1:8500/a/b":    true,
+		"etcd://127.0.0.1:2379/a":        true,
+		"consul.conf":                    false,
+	} {
+		if _, ok, err := newRemoteDest(dest, nil); ok != expected || err != nil {
+			t.Errorf("%s: expected remote %t, got %t, %v", dest, expected, ok, err)
+		}
+	}
+	if _, _, err := newRemoteDest("consul://127.0.0.1:8500/", nil); err == nil {
+		t.Error("Expected an error for a dest without key")
+	}
+}
@@ -0,0 +1,103 @@
+package dockergen
+
+import (
+	"sort"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// listFiltersKey returns a canonical form of the config's Filters, empty
+// when the config has none
+func (c *Config) listFiltersKey() string {
+	names := make([]string, 0, len(c.Filters))
+	for name := range c.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		values := append([]string{}, c.Filters[name]...)
+		sort.Strings(values)
+		parts = append(parts, name+"="+strings.Join(values, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// mergeListFilters returns the ListContainers filters of both a and b
+func mergeListFilters(a, b map[string][]string) map[string][]string {
+	if len(a) == 0 {
+		return b
+	}
+	merged := make(map[string][]string, len(a)+len(b))
+	for name, values := range a {
+		merged[name] = append(merged[name], values...)
+	}
+	for name, values := range b {
+		merged[name] = append(merged[name], values...)
+	}
+	return merged
+}
+
+// listContainers lists the containers of host once with the label filters
+// shared by all configs if some config has no filters, and once more per
+// distinct Filters of the configs. It returns the IDs of all listed
+// containers and, for each, the keys of the Filters that listed it.
+func (g *generator) listContainers(host dockerHost) ([]string, map[string]map[string]bool, error) {
+	filters := map[string]map[string][]string{}
+	unfiltered := len(g.configs().Config) == 0
+	for _, config := range g.configs().Config {
+		if len(config.Filters) == 0 {
+			unfiltered = true
+			continue
+		}
+		filters[config.listFiltersKey()] = config.Filters
+	}
+	keys := make([]string, 0, len(filters)+1)
+	if unfiltered {
+		keys = append(keys, "")
+	}
+	sorted := make([]string, 0, len(filters))
+	for key := range filters {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	keys = append(keys, sorted...)
+
+	shared := labelListFilters(g.configs().LabelFilters())
+	ids := []string{}
+	listedBy := map[string]map[string]bool{}
+	for _, key := range keys {
+		ctx, cancel := g.apiContext()
+		apiContainers, err := host.Client.ListContainers(docker.ListContainersOptions{
+			All:     g.All,
+			Size:    false,
+			Filters: mergeListFilters(filters[key], shared),
+			Context: ctx,
+		})
+		cancel()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, apiContainer := range apiContainers {
+			if _, ok := listedBy[apiContainer.ID]; !ok {
+				ids = append(ids, apiContainer.ID)
+				listedBy[apiContainer.ID] = map[string]bool{}
+			}
+			if key != "" {
+				listedBy[apiContainer.ID][key] = true
+			}
+		}
+	}
+	return ids, listedBy, nil
+}
+
+// matchesListFilters returns whether the container was listed with the
+// config's Filters. Containers that were not listed by docker-gen, such as
+// those of template tests, match all filters.
+func (c *Config) matchesListFilters(container *RuntimeContainer) bool {
+	if len(c.Filters) == 0 || container.listedBy == nil {
+		return true
+	}
+	return container.listedBy[c.listFiltersKey()]
+}
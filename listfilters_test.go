@@ -0,0 +1,85 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestListContainersWithConfigFilters(t *testing.T) {
+	lists := []map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		if value := r.URL.Query().Get("filters"); value != "" {
+			json.Unmarshal([]byte(value), &filters)
+		}
+		lists = append(lists, filters)
+		ids := []string{"c1", "c2", "c3"}
+		switch {
+		case len(filters["network"]) > 0:
+			ids = []string{"c2"}
+		case len(filters["status"]) > 0:
+			ids = []string{"c3", "c4"}
+		}
+		fmt.Fprintf(w, `[{"Id":"%s"}]`, strings.Join(ids, `"},{"Id":"`))
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := Config{Filters: map[string][]string{"network": {"proxy"}}, LabelFilters: []string{"app"}}
+	exited := Config{Filters: map[string][]string{"status": {"exited", "created"}}, LabelFilters: []string{"app"}}
+	g := &generator{Configs: ConfigFile{Config: []Config{proxy, exited, exited}}}
+	ids, listedBy, err := g.listContainers(dockerHost{Client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 {
+		t.Fatalf("Expected one listing per distinct filters, got %v", lists)
+	}
+	if !reflect.DeepEqual(lists[0], map[string][]string{"network": {"proxy"}, "label": {"app"}}) {
+		t.Errorf("Expected the config and shared label filters, got %v", lists[0])
+	}
+	if !reflect.DeepEqual(ids, []string{"c2", "c3", "c4"}) {
+		t.Errorf("Unexpected containers %v", ids)
+	}
+
+	containers := Context{}
+	for _, id := range ids {
+		containers = append(containers, &RuntimeContainer{ID: id, Labels: map[string]string{"app": "shop"}, State: State{Running: true}, listedBy: listedBy[id]})
+	}
+	for _, test := range []struct {
+		config   Config
+		expected []string
+	}{
+		{proxy, []string{"c2"}},
+		{exited, []string{"c3", "c4"}},
+	} {
+		got := []string{}
+		for _, container := range filterContainers(test.config, containers) {
+			got = append(got, container.ID)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%v: expected: %v. got: %v", test.config.Filters, test.expected, got)
+		}
+	}
+
+	// a config without filters needs all containers
+	lists = nil
+	g.Configs.Config = append(g.Configs.Config, Config{})
+	ids, _, err = g.listContainers(dockerHost{Client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 3 || lists[0] != nil || len(ids) != 4 {
+		t.Errorf("Expected an unfiltered listing first, got %v and %v", lists, ids)
+	}
+}
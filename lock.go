@@ -0,0 +1,31 @@
+package dockergen
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// lockDest takes an exclusive lock on the lock file of dest so that no other
+// docker-gen instance can write to dest. The lock is held until the returned
+// file is closed.
+func lockDest(dest string) (*os.File, error) {
+	path := dest + ".lock"
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open lock file %s: %s", path, err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("%s is locked by another docker-gen instance (lock file %s)", dest, path)
+		}
+		return nil, fmt.Errorf("Unable to lock %s: %s", path, err)
+	}
+
+	f.Truncate(0)
+	f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	return f, nil
+}
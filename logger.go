@@ -0,0 +1,116 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is the minimum severity of the messages logged by docker-gen
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogDebug: "debug",
+	LogInfo:  "info",
+	LogWarn:  "warn",
+	LogError: "error",
+}
+
+func (l LogLevel) String() string {
+	return logLevelNames[l]
+}
+
+// ParseLogLevel returns the level named debug, info, warn or error
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LogInfo, fmt.Errorf("unknown log level %q: expected debug, info, warn or error", name)
+}
+
+// Formats of the log output
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var logging = struct {
+	sync.RWMutex
+	level LogLevel
+	json  bool
+}{level: LogInfo}
+
+// SetLogging sets the minimum level of the logged messages and whether they
+// are written as one JSON object per line ("json") or as text ("text", the
+// default)
+func SetLogging(level LogLevel, format string) error {
+	switch format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("unknown log format %q: expected text or json", format)
+	}
+	logging.Lock()
+	defer logging.Unlock()
+	logging.level = level
+	logging.json = format == LogFormatJSON
+	return nil
+}
+
+// loggingSettings returns the minimum level and whether messages are JSON
+func loggingSettings() (LogLevel, bool) {
+	logging.RLock()
+	defer logging.RUnlock()
+	return logging.level, logging.json
+}
+
+// logf writes the message to the standard logger's output. Text messages
+// other than info are prefixed with their level; JSON messages are objects
+// with time, level and msg.
+func logf(level LogLevel, format string, v ...interface{}) {
+	minLevel, asJSON := loggingSettings()
+	if level < minLevel {
+		return
+	}
+
+	msg := strings.TrimRight(fmt.Sprintf(format, v...), "\n")
+	if !asJSON {
+		if level != LogInfo {
+			msg = "[" + strings.ToUpper(level.String()) + "] " + msg
+		}
+		log.Output(3, msg)
+		return
+	}
+	line, err := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{time.Now().UTC().Format(time.RFC3339Nano), level.String(), msg})
+	if err != nil {
+		return
+	}
+	log.Writer().Write(append(line, '\n'))
+}
+
+func logDebugf(format string, v ...interface{}) { logf(LogDebug, format, v...) }
+func logInfof(format string, v ...interface{})  { logf(LogInfo, format, v...) }
+func logWarnf(format string, v ...interface{})  { logf(LogWarn, format, v...) }
+func logErrorf(format string, v ...interface{}) { logf(LogError, format, v...) }
+
+// logFatalf logs the message as an error and exits
+func logFatalf(format string, v ...interface{}) {
+	logf(LogError, format, v...)
+	os.Exit(1)
+}
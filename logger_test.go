@@ -0,0 +1,46 @@
+package dockergen
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetLogging(LogInfo, LogFormatText)
+
+	if err := SetLogging(LogWarn, LogFormatText); err != nil {
+		t.Fatal(err)
+	}
+	logInfof("Generated %s", "a")
+	logWarnf("Skipping %s\n", "b")
+	if out := buf.String(); strings.Contains(out, "Generated") || !strings.Contains(out, "[WARN] Skipping b\n") {
+		t.Errorf("unexpected text output: %q", out)
+	}
+
+	buf.Reset()
+	SetLogging(LogDebug, LogFormatJSON)
+	logDebugf("Debounce %s fired", "minTimer")
+	var entry struct {
+		Time, Level, Msg string
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON line, got %q: %v", buf.String(), err)
+	}
+	if entry.Level != "debug" || entry.Msg != "Debounce minTimer fired" || entry.Time == "" {
+		t.Errorf("unexpected JSON entry: %+v", entry)
+	}
+
+	if err := SetLogging(LogInfo, "xml"); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+	if level, err := ParseLogLevel("WARN"); err != nil || level != LogWarn {
+		t.Errorf("expected warn, got %v, %v", level, err)
+	}
+}
@@ -0,0 +1,138 @@
+package dockergen
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// parseIP parses an IPv4 or IPv6 address, ignoring a prefix length such as
+// the /16 of the IPPrefixLen of docker networks
+func parseIP(funcName, s string) (net.IP, error) {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return nil, fmt.Errorf("%s: invalid IP address %q", funcName, s)
+	}
+	return ip, nil
+}
+
+// cidrContains returns whether the network cidr, e.g. "172.17.0.0/16",
+// contains ip
+func cidrContains(cidr, ip string) (bool, error) {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return false, fmt.Errorf("cidrContains: %s", err)
+	}
+	addr, err := parseIP("cidrContains", ip)
+	if err != nil {
+		return false, err
+	}
+	return network.Contains(addr), nil
+}
+
+// ipAdd returns ip plus n, which may be negative, e.g. the first host of a
+// network from its address. It fails when the result leaves the address
+// family.
+func ipAdd(ip string, n int) (string, error) {
+	addr, err := parseIP("ipAdd", ip)
+	if err != nil {
+		return "", err
+	}
+	size := net.IPv6len
+	if v4 := addr.To4(); v4 != nil {
+		addr, size = v4, net.IPv4len
+	}
+	sum := new(big.Int).SetBytes(addr)
+	sum.Add(sum, big.NewInt(int64(n)))
+	if sum.Sign() < 0 || sum.BitLen() > size*8 {
+		return "", fmt.Errorf("ipAdd: %s %+d is out of range", ip, n)
+	}
+	result := make(net.IP, size)
+	sum.FillBytes(result)
+	return result.String(), nil
+}
+
+// maskBits returns the prefix length of a CIDR such as "10.0.0.0/8" or of a
+// netmask such as "255.255.255.0"
+func maskBits(mask string) (int, error) {
+	mask = strings.TrimSpace(mask)
+	if strings.Contains(mask, "/") {
+		_, network, err := net.ParseCIDR(mask)
+		if err != nil {
+			return 0, fmt.Errorf("maskBits: %s", err)
+		}
+		ones, _ := network.Mask.Size()
+		return ones, nil
+	}
+	ip := net.ParseIP(mask)
+	if ip == nil {
+		return 0, fmt.Errorf("maskBits: invalid netmask %q", mask)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	ones, bits := net.IPMask(ip).Size()
+	if bits == 0 {
+		return 0, fmt.Errorf("maskBits: non-contiguous netmask %q", mask)
+	}
+	return ones, nil
+}
+
+// isIPv6 returns whether ip, with or without prefix length, is an IPv6
+// address
+func isIPv6(ip string) bool {
+	addr, err := parseIP("isIPv6", ip)
+	return err == nil && addr.To4() == nil
+}
+
+// sortByIP returns the entries ordered by the IP address at key (see
+// groupBy), or by their value without key, IPv4 before IPv6. Entries without
+// a valid address are last, in their original order.
+func sortByIP(entries interface{}, key ...string) ([]interface{}, error) {
+	if len(key) > 1 {
+		return nil, fmt.Errorf("Too many arguments passed to 'sortByIP'")
+	}
+	entriesVal, err := getArrayValues("sortByIP", entries)
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		value interface{}
+		ip    net.IP
+	}
+	sorted := make([]entry, entriesVal.Len())
+	for i := range sorted {
+		value := entriesVal.Index(i).Interface()
+		sorted[i].value = value
+		ip := deepGet(reflect.Indirect(entriesVal.Index(i)).Interface(), strings.Join(key, ""))
+		if s, ok := ip.(string); ok {
+			if addr, err := parseIP("sortByIP", s); err == nil {
+				sorted[i].ip = addr.To16()
+			}
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].ip, sorted[j].ip
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		if a4, b4 := a.To4() != nil, b.To4() != nil; a4 != b4 {
+			return a4
+		}
+		return bytes.Compare(a, b) < 0
+	})
+
+	result := make([]interface{}, len(sorted))
+	for i, e := range sorted {
+		result[i] = e.value
+	}
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package dockergen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCidrContains(t *testing.T) {
+	for _, test := range []struct {
+		cidr, ip string
+		expected bool
+	}{
+		{"172.17.0.0/16", "172.17.0.2", true},
+		{"172.17.0.0/16", "172.18.0.2", false},
+		{"10.0.0.0/8", "10.1.2.3/24", true},
+		{"fd00::/8", "fd00::1", true},
+		{"fd00::/8", "10.0.0.1", false},
+	} {
+		if contains, err := cidrContains(test.cidr, test.ip); err != nil || contains != test.expected {
+			t.Errorf("cidrContains(%q, %q): expected %t, got %t, %v", test.cidr, test.ip, test.expected, contains, err)
+		}
+	}
+	if _, err := cidrContains("172.17.0.0", "172.17.0.2"); err == nil {
+		t.Error("expected an error for an invalid CIDR")
+	}
+}
+
+func TestIPAdd(t *testing.T) {
+	for _, test := range []struct {
+		ip       string
+		n        int
+		expected string
+	}{
+		{"172.17.0.1", 1, "172.17.0.2"},
+		{"10.0.0.255", 1, "10.0.1.0"},
+		{"10.0.1.0", -1, "10.0.0.255"},
+		{"fd00::ffff", 1, "fd00::1:0"},
+	} {
+		if ip, err := ipAdd(test.ip, test.n); err != nil || ip != test.expected {
+			t.Errorf("ipAdd(%q, %d): expected %s, got %s, %v", test.ip, test.n, test.expected, ip, err)
+		}
+	}
+	if _, err := ipAdd("255.255.255.255", 1); err == nil {
+		t.Error("expected an error for an overflowing IPv4 address")
+	}
+	if _, err := ipAdd("0.0.0.0", -1); err == nil {
+		t.Error("expected an error for a negative address")
+	}
+}
+
+func TestMaskBits(t *testing.T) {
+	for mask, expected := range map[string]int{
+		"10.0.0.0/8":      8,
+		"fd00::/64":       64,
+		"255.255.255.0":   24,
+		"255.255.255.255": 32,
+	} {
+		if bits, err := maskBits(mask); err != nil || bits != expected {
+			t.Errorf("maskBits(%q): expected %d, got %d, %v", mask, expected, bits, err)
+		}
+	}
+	if _, err := maskBits("255.0.255.0"); err == nil {
+		t.Error("expected an error for a non-contiguous netmask")
+	}
+}
+
+func TestIsIPv6(t *testing.T) {
+	for ip, expected := range map[string]bool{
+		"172.17.0.2":       false,
+		"fd00::1":          true,
+		"fd00::1/64":       true,
+		"::ffff:10.0.0.1":  false,
+		"not an ip":        false,
+		"2001:db8::8a2e:1": true,
+	} {
+		if isIPv6(ip) != expected {
+			t.Errorf("isIPv6(%q): expected %t", ip, expected)
+		}
+	}
+}
+
+func TestSortByIP(t *testing.T) {
+	ips := []string{"10.0.0.10", "fd00::1", "", "10.0.0.9", "172.17.0.1"}
+	sorted, err := sortByIP(ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"10.0.0.9", "10.0.0.10", "172.17.0.1", "fd00::1", ""}
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("expected: %v. got: %v", expected, sorted)
+	}
+
+	containers := Context{
+		&RuntimeContainer{ID: "1", IP: "172.17.0.10"},
+		&RuntimeContainer{ID: "2", IP: "172.17.0.2"},
+	}
+	tests := templateTestList{
+		{`{{range sortByIP . "IP"}}{{.ID}}{{end}}`, containers, `21`},
+	}
+	tests.run(t, "sortByIP")
+}
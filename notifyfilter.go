@@ -0,0 +1,67 @@
+package dockergen
+
+import (
+	"fmt"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// parseContainerSelector parses a NotifyContainersFiltered selector of comma
+// separated docker ps filters, e.g. "label=com.example.role=proxy,name=nginx",
+// into ListContainers filters. Containers must match filters of different
+// names, and any value of a repeated name.
+func parseContainerSelector(selector string) (map[string][]string, error) {
+	filters := map[string][]string{}
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.IndexByte(part, '=')
+		if i <= 0 || i == len(part)-1 {
+			return nil, fmt.Errorf("Invalid container selector %q: %q must be a filter such as \"label=com.example.role=proxy\"", selector, part)
+		}
+		name := strings.TrimSpace(part[:i])
+		filters[name] = append(filters[name], strings.TrimSpace(part[i+1:]))
+	}
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("Invalid container selector %q: no filter", selector)
+	}
+	return filters, nil
+}
+
+// signalFilteredContainers sends the NotifyContainersFiltered signals of
+// config to the running containers matching their selector at notify time,
+// so the targets may be recreated or renamed
+func (g *generator) signalFilteredContainers(config Config) {
+	if len(config.NotifyContainersFiltered) < 1 {
+		return
+	}
+	client := g.notifyHost(config).Client
+	for selector, signal := range config.NotifyContainersFiltered {
+		filters, err := parseContainerSelector(selector)
+		if err != nil {
+			logErrorf("%s. Skipping its signal\n", err)
+			g.recordError(config, err)
+			continue
+		}
+		ctx, cancel := g.apiContext()
+		containers, err := client.ListContainers(docker.ListContainersOptions{Filters: filters, Context: ctx})
+		cancel()
+		if err != nil {
+			logErrorf("Error listing the containers of '%s': %s", selector, err)
+			continue
+		}
+		if len(containers) == 0 {
+			logWarnf("No running container matches '%s'. Skipping its signal", selector)
+			continue
+		}
+		for _, container := range containers {
+			logInfof("Sending container '%s' matching '%s' signal '%v'", shortIdent(container.ID), selector, signal)
+			if err := client.KillContainer(docker.KillContainerOptions{ID: container.ID, Signal: signal}); err != nil {
+				logErrorf("Error sending signal to container %s: %s", shortIdent(container.ID), err)
+			}
+		}
+	}
+}
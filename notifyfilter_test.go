@@ -0,0 +1,72 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestParseContainerSelector(t *testing.T) {
+	filters, err := parseContainerSelector("label=com.example.role=proxy, name=nginx,name=haproxy")
+	if err != nil {
+		t.Fatalf("Expected the selector to parse, got %v", err)
+	}
+	expected := map[string][]string{"label": {"com.example.role=proxy"}, "name": {"nginx", "haproxy"}}
+	if !reflect.DeepEqual(filters, expected) {
+		t.Errorf("Expected %v, got %v", expected, filters)
+	}
+
+	for _, selector := range []string{"", "nginx", "label=", "=proxy"} {
+		if _, err := parseContainerSelector(selector); err == nil {
+			t.Errorf("Expected selector %q to be refused", selector)
+		}
+	}
+}
+
+func TestSignalFilteredContainers(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	var mu sync.Mutex
+	var filters map[string][]string
+	kills := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+			w.Write([]byte(`[{"Id":"proxy1"},{"Id":"proxy2"}]`))
+		case strings.HasSuffix(r.URL.Path, "/kill"):
+			path := r.URL.Path[strings.Index(r.URL.Path, "/containers/")+1:]
+			kills = append(kills, path+" "+r.URL.Query().Get("signal"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &generator{Client: client}
+	g.signalFilteredContainers(Config{NotifyContainersFiltered: map[string]docker.Signal{"label=com.example.role=proxy": docker.SIGHUP}})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(filters, map[string][]string{"label": {"com.example.role=proxy"}}) {
+		t.Errorf("Expected the containers to be listed with the selector, got %v", filters)
+	}
+	expected := []string{"containers/proxy1/kill 1", "containers/proxy2/kill 1"}
+	if !reflect.DeepEqual(kills, expected) {
+		t.Errorf("Expected the matching containers to be signalled, got %v", kills)
+	}
+}
@@ -0,0 +1,148 @@
+package dockergen
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// notifyLimiter keeps a minimum interval between the notifications of each
+// config and, with -notify-interval, between those of all configs.
+// Notifications inside the interval are coalesced into one at its end.
+type notifyLimiter struct {
+	sync.Mutex
+	last    time.Time
+	configs map[string]time.Time
+	pending map[string]*pendingNotify
+}
+
+// pendingNotify is a delayed notification of a config, with the changes of
+// all generations since its previous notification. Its delta is replaced by
+// the one of each generation, as the baseline of deltas only moves once they
+// were notified.
+type pendingNotify struct {
+	config     Config
+	delta      ContainerDelta
+	containers Context
+	changed    bool
+}
+
+// notify runs the notifications of config, unless it or another config
+// notified less than their notify interval ago. The notification is then
+// delayed to the end of the interval, where it covers all generations since.
+// alwaysNotify notifies right away.
+func (g *generator) notify(config Config, delta ContainerDelta, containers Context, changed, alwaysNotify bool) {
+	interval, err := config.NotifyMinInterval()
+	if err != nil {
+		logErrorf("%s. Not limiting the notifications of %s\n", err, config.Dest)
+		g.recordError(config, err)
+	}
+	key := config.Template + ":" + config.Dest
+
+	g.notifyLimit.Lock()
+	if pending, ok := g.notifyLimit.pending[key]; ok {
+		events := appendTriggerEvents(pending.config.triggerEvents, config.triggerEvents...)
+		pending.config, pending.containers = config, containers
+		pending.config.triggerEvents = events
+		pending.delta = delta
+		pending.changed = pending.changed || changed
+		if !alwaysNotify {
+			g.notifyLimit.Unlock()
+			logDebugf("Coalescing the notification of %s with the pending one", config.Dest)
+			return
+		}
+		delete(g.notifyLimit.pending, key)
+		config, delta, containers, changed = pending.config, pending.delta, pending.containers, pending.changed
+	}
+	wait := g.notifyWait(key, interval, time.Now())
+	if wait > 0 && !alwaysNotify {
+		if g.notifyLimit.pending == nil {
+			g.notifyLimit.pending = make(map[string]*pendingNotify)
+		}
+		g.notifyLimit.pending[key] = &pendingNotify{config, delta, containers, changed}
+		g.notifyLimit.Unlock()
+		logInfof("Delaying the notification of %s by %s", config.Dest, wait)
+		g.wg.Add(1)
+		go g.notifyPending(key, interval, wait)
+		return
+	}
+	g.notified(key)
+	g.notifyLimit.Unlock()
+
+	g.runNotifications(config, delta, containers, changed)
+}
+
+// notifyPending runs the pending notification of the config key once its
+// interval and the global one ended. When the generator is stopped first, it
+// is run right away, as dest already changed.
+func (g *generator) notifyPending(key string, interval, wait time.Duration) {
+	defer g.wg.Done()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sigChan)
+	stop := g.stopChannel()
+
+	for {
+		stopping := false
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-stop:
+			stopping = true
+		case <-sigChan:
+			stopping = true
+		}
+		timer.Stop()
+
+		g.notifyLimit.Lock()
+		pending, ok := g.notifyLimit.pending[key]
+		if !ok {
+			// notified in the meantime
+			g.notifyLimit.Unlock()
+			return
+		}
+		if !stopping {
+			if wait = g.notifyWait(key, interval, time.Now()); wait > 0 {
+				g.notifyLimit.Unlock()
+				continue
+			}
+		}
+		delete(g.notifyLimit.pending, key)
+		g.notified(key)
+		g.notifyLimit.Unlock()
+
+		if stopping {
+			logInfof("Running the delayed notification of %s before stopping", pending.config.Dest)
+		}
+		g.runNotifications(pending.config, pending.delta, pending.containers, pending.changed)
+		return
+	}
+}
+
+// notifyWait returns how long the config key has to wait before notifying;
+// the caller holds the notifyLimit lock
+func (g *generator) notifyWait(key string, interval time.Duration, now time.Time) time.Duration {
+	wait := time.Duration(0)
+	if last, ok := g.notifyLimit.configs[key]; ok && interval > 0 {
+		wait = last.Add(interval).Sub(now)
+	}
+	if !g.notifyLimit.last.IsZero() && g.NotifyInterval > 0 {
+		if global := g.notifyLimit.last.Add(g.NotifyInterval).Sub(now); global > wait {
+			wait = global
+		}
+	}
+	return wait
+}
+
+// notified records a notification of the config key; the caller holds the
+// notifyLimit lock
+func (g *generator) notified(key string) {
+	now := time.Now()
+	if g.notifyLimit.configs == nil {
+		g.notifyLimit.configs = make(map[string]time.Time)
+	}
+	g.notifyLimit.configs[key] = now
+	g.notifyLimit.last = now
+}
@@ -0,0 +1,72 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifyInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "notified")
+
+	g := &generator{}
+	config := Config{
+		Template:       "test.tmpl",
+		NotifyCmd:      `echo "$DOCKER_GEN_ADDED_NAMES" >> ` + out,
+		NotifyInterval: "200ms",
+	}
+	// the deltas of the generations until a notification all start from
+	// the containers of the previous one
+	web, api, db := ContainerRef{ID: "1", Name: "web"}, ContainerRef{ID: "2", Name: "api"}, ContainerRef{ID: "3", Name: "db"}
+	for _, added := range [][]ContainerRef{{web}, {api}, {api, db}} {
+		g.notify(config, ContainerDelta{Added: added}, Context{}, true, false)
+	}
+	g.wg.Wait()
+
+	notified, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Expected notifications, got %v", err)
+	}
+	// the notifications inside the interval are coalesced into one
+	if string(notified) != "web\napi db\n" {
+		t.Errorf("Unexpected notifications %q", notified)
+	}
+}
+
+func TestNotifyIntervalOnStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "notified")
+
+	g := &generator{}
+	config := Config{
+		Template:       "test.tmpl",
+		NotifyCmd:      `echo "$DOCKER_GEN_ADDED_NAMES" >> ` + out,
+		NotifyInterval: "1h",
+	}
+	for _, name := range []string{"web", "api"} {
+		delta := ContainerDelta{Added: []ContainerRef{{ID: name, Name: name}}}
+		g.notify(config, delta, Context{}, true, false)
+	}
+
+	start := time.Now()
+	g.Stop()
+	g.wg.Wait()
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the delayed notification not to hold the stop, took %s", elapsed)
+	}
+	// the delayed notification is flushed rather than lost
+	if notified, _ := ioutil.ReadFile(out); string(notified) != "web\napi\n" {
+		t.Errorf("Unexpected notifications %q", notified)
+	}
+}
@@ -0,0 +1,261 @@
+package dockergen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"sync"
+	"text/template"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// Plugin is implemented by external plugin binaries, which serve it with
+// ServePlugin. A plugin can provide additional template context, be notified
+// of generations, or both; the method it doesn't need returns nil.
+type Plugin interface {
+	// Context returns the data templates access with the plugin function
+	Context(req PluginRequest) (interface{}, error)
+	// Notify is called after a generation, next to the notify command
+	Notify(req PluginRequest) error
+}
+
+// PluginRequest is passed to plugins with the options of the config that
+// references them
+type PluginRequest struct {
+	Config  string
+	Dest    string
+	Options map[string]string
+}
+
+// PluginConfig declares an external plugin binary in a [[plugin]] section
+type PluginConfig struct {
+	Name string
+	Path string
+	Args []string
+}
+
+// PluginHandshake is shared by docker-gen and its plugins so docker-gen only
+// starts binaries built as plugins
+var PluginHandshake = plugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "DOCKER_GEN_PLUGIN",
+	MagicCookieValue: "docker-gen",
+}
+
+const pluginName = "docker-gen"
+
+// ServePlugin serves impl to docker-gen; it is called from the main function
+// of plugin binaries and doesn't return
+func ServePlugin(impl Plugin) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: PluginHandshake,
+		Plugins:         plugin.PluginSet{pluginName: &grpcPlugin{Impl: impl}},
+		GRPCServer:      plugin.DefaultGRPCServer,
+	})
+}
+
+var (
+	pluginsMu sync.RWMutex
+	plugins   = map[string]Plugin{}
+)
+
+// startPlugins starts the plugin binaries, which are killed by stopPlugins
+func startPlugins(configs []PluginConfig) error {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	for _, config := range configs {
+		if config.Name == "" || config.Path == "" {
+			return fmt.Errorf("Plugin %q requires a name and a path", config.Name)
+		}
+		level, asJSON := loggingSettings()
+		client := plugin.NewClient(&plugin.ClientConfig{
+			HandshakeConfig:  PluginHandshake,
+			Plugins:          plugin.PluginSet{pluginName: &grpcPlugin{}},
+			Cmd:              exec.Command(config.Path, config.Args...),
+			AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+			Managed:          true,
+			Logger: hclog.New(&hclog.LoggerOptions{
+				Name:       "plugin." + config.Name,
+				Output:     log.Writer(),
+				Level:      hclog.LevelFromString(level.String()),
+				JSONFormat: asJSON,
+			}),
+		})
+		rpcClient, err := client.Client()
+		if err != nil {
+			return fmt.Errorf("Unable to start plugin %s: %s", config.Name, err)
+		}
+		raw, err := rpcClient.Dispense(pluginName)
+		if err != nil {
+			return fmt.Errorf("Unable to start plugin %s: %s", config.Name, err)
+		}
+		plugins[config.Name] = raw.(Plugin)
+		logInfof("Started plugin %s", config.Name)
+	}
+	return nil
+}
+
+func stopPlugins() {
+	plugin.CleanupClients()
+	pluginsMu.Lock()
+	plugins = map[string]Plugin{}
+	pluginsMu.Unlock()
+}
+
+func lookupPlugin(config Config, name string) (Plugin, PluginRequest, error) {
+	options, ok := config.Plugins[name]
+	if !ok {
+		return nil, PluginRequest{}, fmt.Errorf("plugin %q is not enabled for this config", name)
+	}
+	pluginsMu.RLock()
+	p, ok := plugins[name]
+	pluginsMu.RUnlock()
+	if !ok {
+		return nil, PluginRequest{}, fmt.Errorf("plugin %q is not declared", name)
+	}
+	return p, PluginRequest{Config: config.Name, Dest: config.Dest, Options: options}, nil
+}
+
+// pluginFuncs returns the plugin template function of config
+func pluginFuncs(config Config) template.FuncMap {
+	return template.FuncMap{
+		"plugin": func(name string) (interface{}, error) {
+			p, req, err := lookupPlugin(config, name)
+			if err != nil {
+				return nil, err
+			}
+			return p.Context(req)
+		},
+	}
+}
+
+// pluginData is registered for all templates so they parse outside of a
+// generation; it fails when executed
+func pluginData(name string) (interface{}, error) {
+	return nil, fmt.Errorf("plugin %q is not enabled for this config", name)
+}
+
+// notifyPlugins notifies the plugins referenced by config of a generation
+func notifyPlugins(config Config) {
+	names := make([]string, 0, len(config.Plugins))
+	for name := range config.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, req, err := lookupPlugin(config, name)
+		if err != nil {
+			logErrorf("Error notifying plugin: %s\n", err)
+			continue
+		}
+		if err := p.Notify(req); err != nil {
+			logErrorf("Error notifying plugin %s: %s\n", name, err)
+		}
+	}
+}
+
+// grpcPlugin connects Plugin implementations over gRPC. Messages are
+// encoded as JSON so plugins can return arbitrary template data.
+type grpcPlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	Impl Plugin
+}
+
+func (p *grpcPlugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&pluginServiceDesc, p.Impl)
+	return nil
+}
+
+func (p *grpcPlugin) GRPCClient(ctx context.Context, broker *plugin.GRPCBroker, conn *grpc.ClientConn) (interface{}, error) {
+	return &grpcPluginClient{conn: conn}, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type pluginContextResponse struct {
+	Data json.RawMessage
+}
+
+type pluginNotifyResponse struct{}
+
+var pluginServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dockergen.Plugin",
+	HandlerType: (*Plugin)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Context", Handler: pluginContextHandler},
+		{MethodName: "Notify", Handler: pluginNotifyHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "plugin.go",
+}
+
+func pluginContextHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(PluginRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		data, err := srv.(Plugin).Context(*req.(*PluginRequest))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return &pluginContextResponse{Data: raw}, nil
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+	return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/dockergen.Plugin/Context"}, handler)
+}
+
+func pluginNotifyHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(PluginRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &pluginNotifyResponse{}, srv.(Plugin).Notify(*req.(*PluginRequest))
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+	return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/dockergen.Plugin/Notify"}, handler)
+}
+
+type grpcPluginClient struct {
+	conn *grpc.ClientConn
+}
+
+func (c *grpcPluginClient) Context(req PluginRequest) (interface{}, error) {
+	resp := &pluginContextResponse{}
+	if err := c.conn.Invoke(context.Background(), "/dockergen.Plugin/Context", &req, resp, grpc.CallContentSubtype("json")); err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *grpcPluginClient) Notify(req PluginRequest) error {
+	return c.conn.Invoke(context.Background(), "/dockergen.Plugin/Notify", &req, &pluginNotifyResponse{}, grpc.CallContentSubtype("json"))
+}
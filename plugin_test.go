@@ -0,0 +1,71 @@
+package dockergen
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+type testPlugin struct {
+	notified []PluginRequest
+}
+
+func (p *testPlugin) Context(req PluginRequest) (interface{}, error) {
+	return map[string]interface{}{"region": req.Options["region"], "hosts": []string{"a", "b"}}, nil
+}
+
+func (p *testPlugin) Notify(req PluginRequest) error {
+	p.notified = append(p.notified, req)
+	if req.Options["fail"] != "" {
+		return errors.New(req.Options["fail"])
+	}
+	return nil
+}
+
+func TestGRPCPlugin(t *testing.T) {
+	impl := &testPlugin{}
+	client, server := plugin.TestPluginGRPCConn(t, false, plugin.PluginSet{pluginName: &grpcPlugin{Impl: impl}})
+	defer client.Close()
+	defer server.Stop()
+
+	raw, err := client.Dispense(pluginName)
+	if err != nil {
+		t.Fatalf("Unable to dispense plugin: %s", err)
+	}
+	pluginsMu.Lock()
+	plugins["inventory"] = raw.(Plugin)
+	pluginsMu.Unlock()
+	defer stopPlugins()
+
+	config := Config{
+		Name:    "nginx",
+		Dest:    "/etc/nginx/conf.d/default.conf",
+		Plugins: map[string]map[string]string{"inventory": {"region": "eu"}},
+	}
+	tmpl, err := newTemplate("test").Funcs(pluginFuncs(config)).Parse(`{{with plugin "inventory"}}{{.region}}{{range .hosts}} {{.}}{{end}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, nil); err != nil {
+		t.Fatalf("Unable to execute template: %s", err)
+	}
+	if b.String() != "eu a b" {
+		t.Errorf("expected: %s. got: %s", "eu a b", b.String())
+	}
+	if _, err := pluginFuncs(Config{})["plugin"].(func(string) (interface{}, error))("inventory"); err == nil {
+		t.Error("expected the plugin to be unavailable to configs not referencing it")
+	}
+
+	notifyPlugins(config)
+	expected := []PluginRequest{{Config: "nginx", Dest: "/etc/nginx/conf.d/default.conf", Options: map[string]string{"region": "eu"}}}
+	if !reflect.DeepEqual(impl.notified, expected) {
+		t.Errorf("expected: %+v. got: %+v", expected, impl.notified)
+	}
+	if err := raw.(Plugin).Notify(PluginRequest{Options: map[string]string{"fail": "unreachable"}}); err == nil {
+		t.Error("expected the notification error to be returned")
+	}
+}
@@ -0,0 +1,43 @@
+package dockergen
+
+import (
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// isPodman returns whether the /version response env comes from Podman's
+// Docker-compatible API, which lists a "Podman Engine" component
+func isPodman(env *docker.Env) bool {
+	if env == nil {
+		return false
+	}
+	return strings.Contains(env.Get("Components"), "Podman")
+}
+
+// normalizeEvent fills the fields of a container event missing or named
+// differently in Podman's event stream the way docker reports them: the
+// status and ID of the old API, "die" instead of "died", and the health
+// status appended to health_status events.
+func normalizeEvent(event *docker.APIEvents) *docker.APIEvents {
+	if event.Type != "" && event.Type != "container" {
+		return event
+	}
+	if event.Status == "" {
+		event.Status = event.Action
+	}
+	if event.ID == "" {
+		event.ID = event.Actor.ID
+	}
+	if event.Status == "died" {
+		event.Status = "die"
+		event.Action = "die"
+	}
+	if event.Status == "health_status" {
+		if status := event.Actor.Attributes["health_status"]; status != "" {
+			event.Status = "health_status: " + status
+			event.Action = event.Status
+		}
+	}
+	return event
+}
@@ -0,0 +1,41 @@
+package dockergen
+
+import (
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestIsPodman(t *testing.T) {
+	podman := &docker.Env{}
+	podman.SetJSON("Components", []map[string]string{{"Name": "Podman Engine", "Version": "4.9.3"}})
+	engine := &docker.Env{}
+	engine.SetJSON("Components", []map[string]string{{"Name": "Engine", "Version": "24.0.7"}})
+
+	if !isPodman(podman) {
+		t.Error("expected Podman to be detected")
+	}
+	if isPodman(engine) || isPodman(nil) {
+		t.Error("expected docker not to be detected as Podman")
+	}
+}
+
+func TestNormalizeEvent(t *testing.T) {
+	tests := []struct {
+		event  docker.APIEvents
+		status string
+		id     string
+	}{
+		{docker.APIEvents{Status: "start", ID: "a"}, "start", "a"},
+		{docker.APIEvents{Type: "container", Action: "died", Actor: docker.APIActor{ID: "b"}}, "die", "b"},
+		{docker.APIEvents{Type: "container", Status: "health_status", Actor: docker.APIActor{ID: "c", Attributes: map[string]string{"health_status": "unhealthy"}}}, "health_status: unhealthy", "c"},
+		{docker.APIEvents{Type: "network", Action: "connect", Actor: docker.APIActor{ID: "d"}}, "", ""},
+	}
+
+	for _, test := range tests {
+		event := normalizeEvent(&test.event)
+		if event.Status != test.status || event.ID != test.id {
+			t.Errorf("expected %s of %s, got %s of %s", test.status, test.id, event.Status, event.ID)
+		}
+	}
+}
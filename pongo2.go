@@ -0,0 +1,63 @@
+package dockergen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// executePongo2 renders the Jinja2-like template of config with pongo2. The
+// containers are available as containers, the context methods such as
+// Docker or Env on context, and docker-gen's template functions as
+// functions, e.g. {% for host, group in groupByLabel(containers, "host") %}.
+func executePongo2(config Config, containers Context, timeout time.Duration, funcs ...template.FuncMap) ([]byte, error) {
+	loader, err := pongo2.NewLocalFileSystemLoader(filepath.Dir(config.Template))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template: %s", err)
+	}
+	set := pongo2.NewSet(config.Template, loader)
+	tmpl, err := set.FromFile(filepath.Base(config.Template))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template: %s", err)
+	}
+
+	if len(config.triggerEvents) > 0 {
+		setTriggerEvents(&containers, config.triggerEvents)
+		defer setTriggerEvents(&containers, nil)
+	}
+	if len(config.contextErrors) > 0 {
+		setContextErrors(&containers, config.contextErrors)
+		defer setContextErrors(&containers, nil)
+	}
+	if config.draining {
+		setDraining(&containers, true)
+		defer setDraining(&containers, false)
+	}
+
+	ctx := pongo2.Context{}
+	for _, f := range append([]template.FuncMap{templateFuncs, templateCustomFuncs()}, funcs...) {
+		for name, fn := range f {
+			ctx[name] = fn
+			if !config.allowsFunc(name) {
+				ctx[name] = deniedFunc(name)
+			}
+		}
+	}
+	ctx["containers"] = containers
+	ctx["context"] = &containers
+
+	return executeWithDeadline(timeout, func(w io.Writer) error {
+		return tmpl.ExecuteWriterUnbuffered(ctx, w)
+	})
+}
+
+// deniedFunc replaces a function allow_funcs or deny_funcs don't permit
+func deniedFunc(name string) func(...interface{}) (interface{}, error) {
+	return func(...interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("function %q is not allowed by this config", name)
+	}
+}
@@ -0,0 +1,246 @@
+package dockergen
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const publishTimeout = 10 * time.Second
+
+// publishQueue bounds the generation events waiting to be published
+const publishQueue = 100
+
+// GenerationEvent is the message published after each generation
+type GenerationEvent struct {
+	Config    string    `json:"config"`
+	Changed   bool      `json:"changed"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// publisher sends generation events to a NATS subject (nats://host:4222/subject)
+// or an MQTT topic (mqtt://host:1883/some/topic). Credentials are taken from
+// the URL's user info. Events are published in order by a single goroutine,
+// over a plain TCP connection per event, so that a slow or unreachable server
+// doesn't hold up the generations.
+type publisher struct {
+	url     *url.URL
+	start   sync.Once
+	events  chan GenerationEvent
+	pending sync.WaitGroup
+}
+
+func newPublisher(rawurl string) (*publisher, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" && u.Scheme != "mqtt" {
+		return nil, fmt.Errorf("Unsupported publish URL scheme %q: must be nats or mqtt", u.Scheme)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("Publish URL %s has no subject or topic", rawurl)
+	}
+	return &publisher{url: u, events: make(chan GenerationEvent, publishQueue)}, nil
+}
+
+// enqueue queues event to be published, dropping it when the queue is full
+func (p *publisher) enqueue(event GenerationEvent) {
+	p.start.Do(func() {
+		go p.run()
+	})
+	p.pending.Add(1)
+	select {
+	case p.events <- event:
+	default:
+		p.pending.Done()
+		logWarnf("Publish queue full. Dropping the generation event of %s", event.Config)
+	}
+}
+
+func (p *publisher) run() {
+	for event := range p.events {
+		if err := p.publish(event); err != nil {
+			logErrorf("Error publishing generation of %s: %s\n", event.Config, err)
+		}
+		p.pending.Done()
+	}
+}
+
+// flush waits for the queued events to be published
+func (p *publisher) flush() {
+	p.pending.Wait()
+}
+
+// generationEvent describes the generation of config; the hash is the
+// SHA-256 of dest's contents, empty when writing to stdout
+func (g *generator) generationEvent(config Config, changed bool) GenerationEvent {
+	event := GenerationEvent{
+		Config:    config.Name,
+		Changed:   changed,
+		Timestamp: time.Now().UTC(),
+	}
+	if event.Config == "" {
+		event.Config = config.Dest
+	}
+	if config.Dest != "" {
+		if contents, err := readDest(config.Dest, g.swarmClient()); err == nil {
+			sum := sha256.Sum256(contents)
+			event.Hash = hex.EncodeToString(sum[:])
+		}
+	}
+	return event
+}
+
+func (p *publisher) publish(event GenerationEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	host := p.url.Host
+	if p.url.Port() == "" {
+		if p.url.Scheme == "nats" {
+			host = net.JoinHostPort(host, "4222")
+		} else {
+			host = net.JoinHostPort(host, "1883")
+		}
+	}
+	conn, err := net.DialTimeout("tcp", host, publishTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(publishTimeout))
+
+	topic := strings.Trim(p.url.Path, "/")
+	if p.url.Scheme == "nats" {
+		return publishNATS(conn, p.url.User, topic, payload)
+	}
+	return publishMQTT(conn, p.url.User, topic, payload)
+}
+
+// publishNATS publishes payload to subject and waits for the server to
+// acknowledge a PING sent after it, so errors are reported before returning
+func publishNATS(conn net.Conn, user *url.Userinfo, subject string, payload []byte) error {
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting: %s", strings.TrimSpace(line))
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "docker-gen"}
+	if user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"] = user.Username()
+			options["pass"] = password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CONNECT %s\r\nPUB %s %d\r\n", connect, subject, len(payload))
+	buf.Write(payload)
+	buf.WriteString("\r\nPING\r\n")
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// mqttString encodes s as a length prefixed MQTT string
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// mqttPacket returns a packet of the given type with its variable length
+// remaining length header
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// publishMQTT publishes payload to topic with QoS 0 using MQTT 3.1.1
+func publishMQTT(conn net.Conn, user *url.Userinfo, topic string, payload []byte) error {
+	flags := byte(0x02) // clean session
+	connect := append(mqttString("MQTT"), 4, 0, 0, 60)
+	connect = append(connect, mqttString(fmt.Sprintf("docker-gen-%d", os.Getpid()))...)
+	if user != nil {
+		flags |= 0x80
+		connect = append(connect, mqttString(user.Username())...)
+		if password, ok := user.Password(); ok {
+			flags |= 0x40
+			connect = append(connect, mqttString(password)...)
+		}
+	}
+	connect[7] = flags
+
+	if _, err := conn.Write(mqttPacket(0x10, connect)); err != nil {
+		return err
+	}
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		return err
+	}
+	if connack[0] != 0x20 || connack[3] != 0 {
+		return fmt.Errorf("MQTT connection refused (return code %d)", connack[3])
+	}
+
+	publish := append(mqttString(topic), payload...)
+	if _, err := conn.Write(append(mqttPacket(0x30, publish), 0xe0, 0)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// publishGeneration publishes the generation of config, if a publish URL is configured
+func (g *generator) publishGeneration(config Config, changed bool) {
+	if g.publisher == nil {
+		return
+	}
+	g.publisher.enqueue(g.generationEvent(config, changed))
+}
@@ -0,0 +1,120 @@
+package dockergen
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenPublish(t *testing.T, serve func(conn net.Conn)) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+	return listener
+}
+
+func TestNewPublisher(t *testing.T) {
+	for _, rawurl := range []string{"http://localhost/topic", "nats://localhost", "mqtt://localhost/"} {
+		if _, err := newPublisher(rawurl); err == nil {
+			t.Errorf("%s: expected an error", rawurl)
+		}
+	}
+}
+
+func TestPublishNATS(t *testing.T) {
+	received := make(chan string, 2)
+	listener := listenPublish(t, func(conn net.Conn) {
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "CONNECT "), strings.HasPrefix(line, "PUB "):
+				received <- strings.TrimSpace(line)
+			case line == "PING\r\n":
+				conn.Write([]byte("PONG\r\n"))
+			}
+		}
+	})
+	defer listener.Close()
+
+	p, err := newPublisher("nats://user:pass@" + listener.Addr().String() + "/docker-gen.generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := GenerationEvent{Config: "nginx", Changed: true, Timestamp: time.Unix(0, 0).UTC()}
+	if err := p.publish(event); err != nil {
+		t.Fatal(err)
+	}
+
+	connect := <-received
+	if !strings.Contains(connect, `"user":"user"`) || !strings.Contains(connect, `"pass":"pass"`) {
+		t.Errorf("unexpected connect: %s", connect)
+	}
+	payload, _ := json.Marshal(event)
+	if pub := <-received; pub != "PUB docker-gen.generated "+strconv.Itoa(len(payload)) {
+		t.Errorf("unexpected publish: %s", pub)
+	}
+}
+
+func TestPublishMQTT(t *testing.T) {
+	received := make(chan []byte, 1)
+	listener := listenPublish(t, func(conn net.Conn) {
+		header := make([]byte, 2)
+		io.ReadFull(conn, header)
+		connect := make([]byte, header[1])
+		io.ReadFull(conn, connect)
+		conn.Write([]byte{0x20, 2, 0, 0})
+
+		io.ReadFull(conn, header)
+		if header[0] != 0x30 {
+			return
+		}
+		publish := make([]byte, header[1])
+		io.ReadFull(conn, publish)
+		received <- publish
+	})
+	defer listener.Close()
+
+	p, err := newPublisher("mqtt://" + listener.Addr().String() + "/docker-gen/generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// generations only queue their events
+	p.enqueue(GenerationEvent{Config: "nginx"})
+	p.flush()
+
+	publish := <-received
+	topicLength := int(publish[0])<<8 | int(publish[1])
+	if topic := string(publish[2 : 2+topicLength]); topic != "docker-gen/generated" {
+		t.Errorf("expected: %s. got: %s", "docker-gen/generated", topic)
+	}
+	var event GenerationEvent
+	if err := json.Unmarshal(publish[2+topicLength:], &event); err != nil || event.Config != "nginx" {
+		t.Errorf("unexpected payload: %s", publish[2+topicLength:])
+	}
+}
+
+func TestMQTTPacketLength(t *testing.T) {
+	packet := mqttPacket(0x30, make([]byte, 321))
+	if packet[1] != 0xc1 || packet[2] != 0x02 || len(packet) != 324 {
+		t.Errorf("unexpected remaining length encoding: % x", packet[:3])
+	}
+}
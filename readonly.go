@@ -0,0 +1,42 @@
+package dockergen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// writeActions returns the docker API calls beyond reads that config
+// requires, e.g. to notify its containers
+func writeActions(config Config) []string {
+	actions := []string{}
+	if len(config.NotifyContainers) > 0 || len(config.NotifyContainersFiltered) > 0 {
+		actions = append(actions, "signalling containers")
+	}
+	if len(config.NotifyContainersExec) > 0 {
+		actions = append(actions, "exec in containers")
+	}
+	if len(config.NotifyServices) > 0 {
+		actions = append(actions, "signalling services")
+	}
+	if len(config.NotifyContainersRestart) > 0 {
+		actions = append(actions, "restarting containers")
+	}
+	if len(config.NotifyServicesRestart) > 0 {
+		actions = append(actions, "restarting services")
+	}
+	if strings.HasPrefix(config.Dest, "swarm-config://") {
+		actions = append(actions, "creating swarm configs")
+	}
+	return actions
+}
+
+// checkReadOnly returns an error naming the first config requiring docker
+// API calls other than reads, which are forbidden with -read-only
+func checkReadOnly(configs ConfigFile) error {
+	for _, config := range configs.Config {
+		if actions := writeActions(config); len(actions) > 0 {
+			return fmt.Errorf("Config %s requires docker API write access for %s, which -read-only forbids", config.Template, strings.Join(actions, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package dockergen
+
+import (
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestCheckReadOnly(t *testing.T) {
+	readOnly := ConfigFile{Config: []Config{
+		{Template: "nginx.tmpl", Dest: "/etc/nginx/conf.d/default.conf", NotifyCmd: "nginx -s reload"},
+		{Template: "haproxy.tmpl", Dest: "consul://127.0.0.1:8500/haproxy"},
+	}}
+	if err := checkReadOnly(readOnly); err != nil {
+		t.Errorf("Expected configs only reading the docker API to pass, got %v", err)
+	}
+
+	for _, config := range []Config{
+		{NotifyContainers: map[string]docker.Signal{"nginx": docker.SIGHUP}},
+		{NotifyContainersExec: map[string][]string{"nginx": {"nginx", "-s", "reload"}}},
+		{NotifyContainersFiltered: map[string]docker.Signal{"label=role=proxy": docker.SIGHUP}},
+		{NotifyServices: map[string]docker.Signal{"web": docker.SIGHUP}},
+		{NotifyContainersRestart: []string{"app"}},
+		{NotifyServicesRestart: []string{"web"}},
+		{Dest: "swarm-config://haproxy"},
+	} {
+		config.Template = "writes.tmpl"
+		configs := ConfigFile{Config: append(readOnly.Config, config)}
+		if err := checkReadOnly(configs); err == nil || !strings.Contains(err.Error(), "writes.tmpl") {
+			t.Errorf("Expected %+v to be refused, got %v", config, err)
+		}
+	}
+}
+
+func TestRequestReloadReadOnly(t *testing.T) {
+	g := &generator{ReadOnly: true, reloadConfig: func() (ConfigFile, error) {
+		return ConfigFile{Config: []Config{{Template: "nginx.tmpl", NotifyContainers: map[string]docker.Signal{"nginx": docker.SIGHUP}}}}, nil
+	}}
+	if g.requestReload() || g.reloadedConfigs != nil {
+		t.Error("Expected the reloaded configs requiring write access to be refused")
+	}
+}
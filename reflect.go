@@ -1,7 +1,6 @@
 package dockergen
 
 import (
-	"log"
 	"reflect"
 	"strings"
 )
@@ -35,12 +34,16 @@ func deepGet(item interface{}, path string) interface{} {
 				return deepGet(fieldValue.Interface(), strings.Join(parts[1:], "."))
 			}
 		case reflect.Map:
-			mapValue := itemValue.MapIndex(reflect.ValueOf(parts[0]))
-			if mapValue.IsValid() {
-				return deepGet(mapValue.Interface(), strings.Join(parts[1:], "."))
+			// map keys such as label names may contain dots themselves, so
+			// prefer the longest key matching the start of the path
+			for n := len(parts); n > 0; n-- {
+				mapValue := itemValue.MapIndex(reflect.ValueOf(strings.Join(parts[:n], ".")))
+				if mapValue.IsValid() {
+					return deepGet(mapValue.Interface(), strings.Join(parts[n:], "."))
+				}
 			}
 		default:
-			log.Printf("Can't group by %s (value %v, kind %s)\n", path, itemValue, itemValue.Kind())
+			logWarnf("Can't group by %s (value %v, kind %s)\n", path, itemValue, itemValue.Kind())
 		}
 		return nil
 	}
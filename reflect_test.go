@@ -59,3 +59,21 @@ func TestDeepGetMap(t *testing.T) {
 		t.Errorf("expected: %s. got: %s", "value", value)
 	}
 }
+
+func TestDeepGetMapDottedKey(t *testing.T) {
+	item := RuntimeContainer{
+		Labels: map[string]string{
+			"traefik":        "other",
+			"traefik.enable": "true",
+		},
+	}
+	value := deepGet(item, "Labels.traefik.enable")
+	if value != "true" {
+		t.Errorf("expected: %s. got: %v", "true", value)
+	}
+
+	value = deepGet(item, "Labels.traefik")
+	if value != "other" {
+		t.Errorf("expected: %s. got: %v", "other", value)
+	}
+}
@@ -0,0 +1,233 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dockerHubRegistry     = "registry-1.docker.io"
+	dockerHubAuthKey      = "https://index.docker.io/v1/"
+	registryTagsCacheTime = 5 * time.Minute
+)
+
+type registryTagsEntry struct {
+	tags    []string
+	fetched time.Time
+}
+
+var (
+	registryMu       sync.Mutex
+	registryTagCache = make(map[string]registryTagsEntry)
+	registryClient   = &http.Client{Timeout: 30 * time.Second}
+	// registryScheme is only changed by tests talking to plain HTTP registries
+	registryScheme = "https"
+)
+
+// splitRepository returns the registry host and repository path of an image
+// repository such as "nginx", "jwilder/nginx-proxy" or "quay.io/org/app"
+func splitRepository(repo string) (string, string) {
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	}
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0], stripTag(parts[1])
+	}
+	repo = stripTag(repo)
+	if !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+	return dockerHubRegistry, repo
+}
+
+func stripTag(repo string) string {
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		return repo[:i]
+	}
+	return repo
+}
+
+// registryCredentials returns the base64 encoded basic auth credentials for
+// registry from the docker client configuration, if any
+func registryCredentials(registry string) string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(buf, &config); err != nil {
+		return ""
+	}
+
+	keys := []string{registry, "https://" + registry, "http://" + registry}
+	if registry == dockerHubRegistry {
+		keys = []string{dockerHubAuthKey, "index.docker.io", "docker.io"}
+	}
+	for _, key := range keys {
+		if auth, ok := config.Auths[key]; ok && auth.Auth != "" {
+			return auth.Auth
+		}
+	}
+	return ""
+}
+
+var bearerParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// registryToken obtains a bearer token as requested by a registry's
+// WWW-Authenticate challenge
+func registryToken(challenge, credentials string) (string, error) {
+	params := map[string]string{}
+	for _, match := range bearerParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("Unsupported registry authentication challenge: %s", challenge)
+	}
+
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	req, err := http.NewRequest("GET", realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if credentials != "" {
+		req.Header.Set("Authorization", "Basic "+credentials)
+	}
+
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Registry token request failed: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+var nextLinkRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+func fetchRegistryTags(registry, repository string) ([]string, error) {
+	credentials := registryCredentials(registry)
+	authorization := ""
+	if credentials != "" {
+		authorization = "Basic " + credentials
+	}
+
+	base := registryScheme + "://" + registry
+	next := "/v2/" + repository + "/tags/list"
+	tags := []string{}
+	for next != "" {
+		u := next
+		if !strings.Contains(u, "://") {
+			u = base + u
+		}
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := registryClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		// exchange the credentials for a token once, if the registry asks for one
+		if resp.StatusCode == http.StatusUnauthorized && !strings.HasPrefix(authorization, "Bearer ") {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+				return nil, fmt.Errorf("Registry %s denied access to %s", registry, repository)
+			}
+			token, err := registryToken(challenge, credentials)
+			if err != nil {
+				return nil, err
+			}
+			authorization = "Bearer " + token
+			continue
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("Registry %s: listing tags of %s: %s", registry, repository, resp.Status)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&page)
+		}
+		link := resp.Header.Get("Link")
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, page.Tags...)
+		next = ""
+		if match := nextLinkRegexp.FindStringSubmatch(link); match != nil {
+			next = match[1]
+		}
+	}
+	return tags, nil
+}
+
+// registryTags returns the tags of an image repository. Credentials are read
+// from the docker client configuration and results are cached for a few
+// minutes.
+func registryTags(repo string) ([]string, error) {
+	registry, repository := splitRepository(repo)
+	key := registry + "/" + repository
+
+	registryMu.Lock()
+	entry, ok := registryTagCache[key]
+	registryMu.Unlock()
+	if ok && time.Since(entry.fetched) < registryTagsCacheTime {
+		return entry.tags, nil
+	}
+
+	tags, err := fetchRegistryTags(registry, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.Lock()
+	registryTagCache[key] = registryTagsEntry{tags: tags, fetched: time.Now()}
+	registryMu.Unlock()
+	return tags, nil
+}
@@ -0,0 +1,84 @@
+package dockergen
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitRepository(t *testing.T) {
+	tests := []struct {
+		repo, registry, repository string
+	}{
+		{"nginx", "registry-1.docker.io", "library/nginx"},
+		{"nginx:1.13", "registry-1.docker.io", "library/nginx"},
+		{"jwilder/nginx-proxy", "registry-1.docker.io", "jwilder/nginx-proxy"},
+		{"quay.io/org/app:v2", "quay.io", "org/app"},
+		{"localhost:5000/app", "localhost:5000", "app"},
+		{"localhost/app@sha256:abc", "localhost", "app"},
+	}
+
+	for _, test := range tests {
+		registry, repository := splitRepository(test.repo)
+		if registry != test.registry || repository != test.repository {
+			t.Errorf("%s: expected %s %s, got %s %s", test.repo, test.registry, test.repository, registry, repository)
+		}
+	}
+}
+
+func TestRegistryTags(t *testing.T) {
+	credentials := base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.Header.Get("Authorization") != "Basic "+credentials || r.URL.Query().Get("scope") != "repository:org/app:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"token":"abc"}`))
+		case r.Header.Get("Authorization") != "Bearer abc":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:org/app:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/org/app/tags/list" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/org/app/tags/list?last=1.1>; rel="next"`)
+			w.Write([]byte(`{"name":"org/app","tags":["1.0","1.1"]}`))
+		case r.URL.Path == "/v2/org/app/tags/list":
+			w.Write([]byte(`{"name":"org/app","tags":["2.0"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config := fmt.Sprintf(`{"auths":{"%s":{"auth":"%s"}}}`, host, credentials)
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600)
+
+	os.Setenv("DOCKER_CONFIG", dir)
+	registryScheme = "http"
+	defer func() {
+		os.Unsetenv("DOCKER_CONFIG")
+		registryScheme = "https"
+	}()
+
+	tags, err := registryTags(host + "/org/app:1.0")
+	if err != nil {
+		t.Fatalf("Error listing tags: %v", err)
+	}
+	if !reflect.DeepEqual(tags, []string{"1.0", "1.1", "2.0"}) {
+		t.Fatalf("Incorrect tags: %v", tags)
+	}
+}
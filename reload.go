@@ -0,0 +1,128 @@
+package dockergen
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchConfigFiles reloads the configs when the config files change or on
+// SIGUSR2. Generate then restarts all triggers with the new configs.
+func (g *generator) watchConfigFiles() {
+	if g.reloadConfig == nil || len(g.ConfigFiles) == 0 {
+		return
+	}
+	if !g.keepsRunning() {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logErrorf("Unable to watch config files: %s\n", err)
+		return
+	}
+	files := map[string]bool{}
+	dirs := map[string]bool{}
+	for _, file := range g.ConfigFiles {
+		file = absPath(file)
+		files[file] = true
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			logErrorf("Unable to watch %s: %s\n", dir, err)
+			continue
+		}
+		dirs[dir] = true
+	}
+
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer watcher.Close()
+		defer signal.Stop(usr2)
+
+		timer := time.NewTimer(fileWatchDebounce)
+		timer.Stop()
+		sigChan := g.newSignalChannel()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				name := filepath.Clean(event.Name)
+				// Kubernetes swaps the "..data" symlink of mounted ConfigMaps
+				if files[name] || (filepath.Base(name) == "..data" && dirs[filepath.Dir(name)]) {
+					timer.Reset(fileWatchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logErrorf("Error watching config files: %s\n", err)
+			case <-timer.C:
+				logInfof("Config files changed")
+				if g.requestReload() {
+					return
+				}
+			case <-usr2:
+				logInfof("Received signal: %s", syscall.SIGUSR2)
+				if g.requestReload() {
+					return
+				}
+			case sig := <-sigChan:
+				switch sig {
+				case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+					return
+				}
+			}
+		}
+	}()
+}
+
+// keepsRunning returns whether docker-gen keeps running after the first
+// generation; one-shot runs exit after it
+func (g *generator) keepsRunning() bool {
+	for _, config := range g.configs().Config {
+		if config.Watch || config.Interval > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// requestReload loads the config files again and, if they are valid, stops
+// the current generation so that Generate restarts with them. Invalid config
+// files are logged and the current configs are kept.
+func (g *generator) requestReload() bool {
+	configs, err := g.reloadConfig()
+	if err == nil && g.ReadOnly {
+		err = checkReadOnly(configs)
+	}
+	if err == nil {
+		err = checkStream(configs)
+	}
+	if err != nil {
+		logErrorf("Error reloading configs: %s. Keeping the current configs\n", err)
+		return false
+	}
+	logInfof("Reloading configs from %s", strings.Join(g.ConfigFiles, ", "))
+	g.stopMu.Lock()
+	g.reloadedConfigs = &configs
+	g.stopMu.Unlock()
+	g.stopGeneration()
+	return true
+}
@@ -0,0 +1,112 @@
+package dockergen
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestGenerateReloadsConfigFiles(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDockerEnv(&docker.Env{})
+
+	dir, err := ioutil.TempDir("", "docker-gen-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmpl := filepath.Join(dir, "tmpl")
+	configFile := filepath.Join(dir, "docker-gen.cfg")
+	for _, file := range []string{tmpl, configFile} {
+		if err := ioutil.WriteFile(file, []byte("generated"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+
+	reloads := 0
+	g := &generator{
+		Client:   client,
+		Endpoint: server.URL,
+		Configs: ConfigFile{
+			Config: []Config{
+				Config{Template: tmpl, Dest: first, Interval: 60},
+			},
+		},
+		ConfigFiles: []string{configFile},
+		reloadConfig: func() (ConfigFile, error) {
+			reloads++
+			if reloads == 1 {
+				return ConfigFile{}, errors.New("invalid config")
+			}
+			return ConfigFile{
+				Config: []Config{
+					Config{Template: tmpl, Dest: second, Interval: 60},
+				},
+			}, nil
+		},
+		retry: true,
+	}
+	done := make(chan error)
+	go func() {
+		done <- g.Generate()
+	}()
+
+	waitForFile := func(path string) {
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(path); err == nil {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("Expected %s to be generated", path)
+	}
+	waitForFile(first)
+
+	// the first reload fails and keeps the current configs
+	if g.requestReload() {
+		t.Fatal("Expected an invalid config reload to be rejected")
+	}
+	if err := ioutil.WriteFile(configFile, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(second)
+	if configs := g.configs(); len(configs.Config) != 1 || configs.Config[0].Dest != second {
+		t.Errorf("Expected the reloaded configs, got %v", configs.Config)
+	}
+
+	g.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected Generate to succeed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Generate to return once stopped")
+	}
+}
@@ -0,0 +1,55 @@
+package dockergen
+
+import (
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// restartTimeout is how long restarted containers may take to stop before
+// they are killed, as with docker restart
+const restartTimeout = 10
+
+// restartNotifyContainers restarts the NotifyContainersRestart containers of
+// config, for applications that only read their config when starting
+func (g *generator) restartNotifyContainers(config Config) {
+	if len(config.NotifyContainersRestart) < 1 {
+		return
+	}
+	client := g.notifyHost(config).Client
+	for _, container := range config.NotifyContainersRestart {
+		logInfof("Restarting container '%s'", container)
+		if err := client.RestartContainer(container, restartTimeout); err != nil {
+			logErrorf("Error restarting container %s: %s", container, err)
+		}
+	}
+}
+
+// restartNotifyServices restarts the tasks of the NotifyServicesRestart
+// services of config by forcing an update, as with docker service update
+// --force, so the services' update policies apply
+func (g *generator) restartNotifyServices(config Config) {
+	if len(config.NotifyServicesRestart) < 1 {
+		return
+	}
+	host := g.notifyHost(config)
+	if host.Podman {
+		logWarnf("Podman has no Swarm services. Skipping restart of %d service(s)", len(config.NotifyServicesRestart))
+		return
+	}
+
+	for _, service := range config.NotifyServicesRestart {
+		logInfof("Restarting service '%s'", service)
+		svc, err := host.Client.InspectService(service)
+		if err != nil {
+			logErrorf("Error inspecting service %s: %s", service, err)
+			continue
+		}
+		spec := svc.Spec
+		spec.TaskTemplate.ForceUpdate++
+		if err := host.Client.UpdateService(svc.ID, docker.UpdateServiceOptions{
+			ServiceSpec: spec,
+			Version:     svc.Version.Index,
+		}); err != nil {
+			logErrorf("Error restarting service %s: %s", service, err)
+		}
+	}
+}
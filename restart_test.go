@@ -0,0 +1,73 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestRestartNotifications(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	var mu sync.Mutex
+	requests := []string{}
+	var updated swarm.ServiceSpec
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path[strings.Index(r.URL.Path, "/containers/")+1:]
+		if i := strings.Index(r.URL.Path, "/services/"); i >= 0 {
+			path = r.URL.Path[i+1:]
+		}
+		mu.Lock()
+		requests = append(requests, r.Method+" "+path+" "+r.URL.RawQuery)
+		mu.Unlock()
+		switch {
+		case path == "services/web":
+			json.NewEncoder(w).Encode(swarm.Service{
+				ID:   "s1",
+				Meta: swarm.Meta{Version: swarm.Version{Index: 7}},
+				Spec: swarm.ServiceSpec{
+					Annotations:  swarm.Annotations{Name: "web"},
+					TaskTemplate: swarm.TaskSpec{ForceUpdate: 2},
+				},
+			})
+		case path == "services/s1/update":
+			json.NewDecoder(r.Body).Decode(&updated)
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &generator{Client: client}
+	config := Config{
+		NotifyContainersRestart: []string{"app"},
+		NotifyServicesRestart:   []string{"web"},
+	}
+	g.restartNotifyContainers(config)
+	g.restartNotifyServices(config)
+
+	expected := []string{
+		"POST containers/app/restart t=10",
+		"GET services/web ",
+		"POST services/s1/update version=7",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected: %q. got: %q", expected, requests)
+	}
+	if updated.Name != "web" || updated.TaskTemplate.ForceUpdate != 3 {
+		t.Errorf("Expected the service spec with ForceUpdate incremented, got %+v", updated)
+	}
+}
@@ -0,0 +1,382 @@
+package dockergen
+
+import (
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultMaxJobs = 4
+
+// allConfigs is the job regenerating all configs from a single container
+// listing, as on SIGHUP
+const allConfigs = -1
+
+// maxTriggerEvents bounds the events kept for a single generation
+const maxTriggerEvents = 100
+
+// pendingDebounce holds when a config waiting for more events is generated:
+// at min unless another event arrives, and at max at the latest. With the
+// leading strategy, min ends the window following a generation.
+type pendingDebounce struct {
+	min, max time.Time
+	events   []TriggerEvent
+	// count is the number of events, which aren't all kept in events
+	count   int
+	leading bool
+}
+
+// schedulerJob is a queued generation of a config
+type schedulerJob struct {
+	alwaysNotify bool
+	events       []TriggerEvent
+	// round is the dispatch round of the latest trigger of the job
+	round uint64
+}
+
+// schedulerListing is the container listing shared by the jobs of the
+// dispatch rounds up to round
+type schedulerListing struct {
+	round      uint64
+	done       chan struct{}
+	containers []*RuntimeContainer
+	errs       []string
+	err        error
+}
+
+func appendTriggerEvents(events []TriggerEvent, more ...TriggerEvent) []TriggerEvent {
+	events = append(events, more...)
+	if len(events) > maxTriggerEvents {
+		events = events[len(events)-maxTriggerEvents:]
+	}
+	return events
+}
+
+// scheduler owns the interval, event and signal triggers of all configs in a
+// single goroutine and dispatches their generations to a bounded pool of
+// workers. Generations of a config never overlap, see lockConfig, and
+// triggers of a config that is already queued are coalesced into its queued
+// job. The jobs of the triggers handled at once, a dispatch round, share a
+// single container listing.
+type scheduler struct {
+	g       *generator
+	configs []Config
+	events  chan TriggerEvent
+
+	intervals map[int]time.Time
+	pending   map[int]pendingDebounce
+
+	jobs    chan int
+	mu      sync.Mutex
+	queued  map[int]*schedulerJob
+	round   uint64
+	listing *schedulerListing
+}
+
+func (g *generator) maxJobs() int {
+	if g.MaxJobs <= 0 {
+		return defaultMaxJobs
+	}
+	return g.MaxJobs
+}
+
+// startScheduler starts generating the configs with an interval or watching
+// docker events
+func (g *generator) startScheduler() {
+	s := &scheduler{
+		g:         g,
+		configs:   g.configs().Config,
+		intervals: make(map[int]time.Time),
+		pending:   make(map[int]pendingDebounce),
+		jobs:      make(chan int, len(g.configs().Config)+1),
+		queued:    make(map[int]*schedulerJob),
+	}
+
+	watching := false
+	now := time.Now()
+	for i, config := range s.configs {
+		if config.Interval > 0 {
+			logInfof("Generating every %d seconds", config.Interval)
+			s.intervals[i] = now.Add(nextInterval(config, now))
+		}
+		if config.Watch {
+			watching = true
+		}
+	}
+	if !watching && len(s.intervals) == 0 {
+		return
+	}
+	if watching {
+		s.events = make(chan TriggerEvent, 100)
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			if g.PollInterval > 0 {
+				g.pollEvents(s.events)
+			} else {
+				g.watchHosts(s.events)
+			}
+		}()
+	}
+
+	for i := 0; i < g.maxJobs(); i++ {
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			s.work()
+		}()
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		s.run(watching)
+	}()
+}
+
+// run waits for triggers until docker-gen is stopped, or until the docker
+// events end for good and no config has an interval
+func (s *scheduler) run(watching bool) {
+	defer close(s.jobs)
+
+	sigChan := s.g.newSignalChannel()
+	events := s.events
+	for {
+		var timerC <-chan time.Time
+		timer := s.newTimer()
+		if timer != nil {
+			timerC = timer.C
+		}
+
+		s.nextRound()
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if len(s.intervals) == 0 {
+					return
+				}
+				events = nil
+				break
+			}
+			s.debounce(event, time.Now())
+		case <-timerC:
+			s.dispatchDue(time.Now())
+		case sig := <-sigChan:
+			logInfof("Received signal: %s\n", sig)
+			switch sig {
+			case syscall.SIGHUP:
+				// If none of the configs watch for events, SIGHUP is ignored
+				if watching {
+					s.dispatch(allConfigs, false, nil)
+				}
+			case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+				if timer != nil {
+					timer.Stop()
+				}
+				// the event producers stop on the same signal, once they
+				// aren't blocked on sending an event
+				if events != nil {
+					for range events {
+					}
+				}
+				return
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// newTimer returns a timer firing at the earliest interval or debounce
+// deadline, nil if there is none
+func (s *scheduler) newTimer() *time.Timer {
+	var next time.Time
+	earlier := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	for _, t := range s.intervals {
+		earlier(t)
+	}
+	for _, p := range s.pending {
+		earlier(p.min)
+		earlier(p.max)
+	}
+	if next.IsZero() {
+		return nil
+	}
+	return time.NewTimer(time.Until(next))
+}
+
+// debounce generates the watching configs without a wait right away, and
+// delays the others according to their wait
+func (s *scheduler) debounce(event TriggerEvent, now time.Time) {
+	for i, config := range s.configs {
+		if !config.WantsEvent(event) {
+			continue
+		}
+		if !config.MatchesEvent(event) {
+			logDebugf("Ignoring event %s of container %s for %s", event.Action, shortIdent(event.ID), config.Dest)
+			continue
+		}
+		if config.Wait == nil || config.Wait.Min == 0 {
+			s.dispatch(i, false, []TriggerEvent{event})
+			continue
+		}
+		strategy, err := config.DebounceStrategy()
+		if err != nil {
+			logErrorf("%s. Debouncing %s on the trailing edge\n", err, config.Dest)
+			s.g.recordError(config, err)
+		}
+
+		p, waiting := s.pending[i]
+		switch strategy {
+		case DebounceLeading:
+			if !waiting {
+				s.dispatch(i, false, []TriggerEvent{event})
+				s.pending[i] = leadingWindow(config, now)
+				continue
+			}
+			// the events of the window are generated at its end
+		case DebounceQuiet:
+			p.min = now.Add(config.Wait.Min)
+			p.max = p.min
+		default:
+			p.min = now.Add(config.Wait.Min)
+			if p.max.IsZero() {
+				p.max = now.Add(config.Wait.Max)
+			}
+		}
+		p.events = appendTriggerEvents(p.events, event)
+		p.count++
+		s.pending[i] = p
+
+		if config.DebounceBatch > 0 && p.count >= config.DebounceBatch {
+			logDebugf("Debounce batch of %d events reached", p.count)
+			delete(s.pending, i)
+			s.dispatch(i, false, p.events)
+			if p.leading {
+				s.pending[i] = leadingWindow(config, now)
+			}
+		}
+	}
+}
+
+// leadingWindow is the window following a generation of config with the
+// leading strategy, during which events wait for its end
+func leadingWindow(config Config, now time.Time) pendingDebounce {
+	end := now.Add(config.Wait.Min)
+	return pendingDebounce{min: end, max: end, leading: true}
+}
+
+// dispatchDue dispatches the configs whose interval or debounce expired
+func (s *scheduler) dispatchDue(now time.Time) {
+	for i, p := range s.pending {
+		switch {
+		case !now.Before(p.min):
+			logDebugf("Debounce minTimer fired")
+		case !now.Before(p.max):
+			logDebugf("Debounce maxTimer fired")
+		default:
+			continue
+		}
+		delete(s.pending, i)
+		if p.leading {
+			if p.count == 0 {
+				continue
+			}
+			s.pending[i] = leadingWindow(s.configs[i], now)
+		}
+		s.dispatch(i, false, p.events)
+	}
+	for i, next := range s.intervals {
+		if now.Before(next) {
+			continue
+		}
+		s.intervals[i] = now.Add(nextInterval(s.configs[i], now))
+		// interval generations always run the notify command
+		s.dispatch(i, true, nil)
+	}
+}
+
+// dispatch queues the generation of config i unless it is queued already,
+// in which case the triggers are merged into the queued job. Each config is
+// queued at most once, so the job channel never blocks.
+func (s *scheduler) dispatch(i int, alwaysNotify bool, events []TriggerEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.queued[i]; ok {
+		job.alwaysNotify = job.alwaysNotify || alwaysNotify
+		job.events = appendTriggerEvents(job.events, events...)
+		job.round = s.round
+		return
+	}
+	s.queued[i] = &schedulerJob{alwaysNotify: alwaysNotify, events: events, round: s.round}
+	s.jobs <- i
+}
+
+// nextRound starts the dispatch round of the next triggers
+func (s *scheduler) nextRound() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.round++
+}
+
+// containers returns a container listing started after the triggers of
+// round. The jobs of a round wait for the listing of the first one rather
+// than listing the containers again.
+func (s *scheduler) containers(round uint64) ([]*RuntimeContainer, []string, error) {
+	s.mu.Lock()
+	listing := s.listing
+	if listing == nil || listing.round < round {
+		listing = &schedulerListing{round: round, done: make(chan struct{})}
+		s.listing = listing
+		s.mu.Unlock()
+		listing.containers, listing.errs, listing.err = s.g.getContainers()
+		close(listing.done)
+		return listing.containers, listing.errs, listing.err
+	}
+	s.mu.Unlock()
+	<-listing.done
+	return listing.containers, listing.errs, listing.err
+}
+
+func (s *scheduler) work() {
+	for i := range s.jobs {
+		s.mu.Lock()
+		job := s.queued[i]
+		delete(s.queued, i)
+		s.mu.Unlock()
+
+		if i == allConfigs {
+			containers, errs, err := s.containers(job.round)
+			if err != nil {
+				logErrorf("Error listing containers: %s\n", err)
+				continue
+			}
+			for _, config := range s.configs {
+				config.trigger = "SIGHUP"
+				s.g.generateConfig(config, containers, errs, false)
+			}
+			continue
+		}
+
+		config := s.configs[i]
+		config.trigger = "docker event"
+		if job.alwaysNotify {
+			config.trigger = "interval"
+		}
+		config.triggerEvents = job.events
+		// the listing is taken with the lock held, so that a generation
+		// doesn't overwrite the one of a more recent listing
+		unlock := s.g.lockConfig(config)
+		containers, errs, err := s.containers(job.round)
+		if err != nil {
+			logErrorf("Error listing containers: %s\n", err)
+		} else {
+			s.g.generateConfigLocked(config, containers, errs, job.alwaysNotify)
+		}
+		unlock()
+	}
+}
@@ -0,0 +1,246 @@
+package dockergen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestSchedulerDebounceAndDispatch(t *testing.T) {
+	s := &scheduler{
+		configs: []Config{
+			Config{Watch: true},
+			Config{Watch: true, Wait: &Wait{20 * time.Millisecond, 50 * time.Millisecond}},
+			Config{Interval: 60},
+		},
+		intervals: make(map[int]time.Time),
+		pending:   make(map[int]pendingDebounce),
+		jobs:      make(chan int, 4),
+		queued:    make(map[int]*schedulerJob),
+	}
+	now := time.Now()
+	s.intervals[2] = now.Add(time.Minute)
+
+	start := TriggerEvent{Type: "container", Action: "start", ID: "a"}
+	stop := TriggerEvent{Type: "container", Action: "stop", ID: "b"}
+	s.debounce(start, now)
+	s.debounce(stop, now.Add(10*time.Millisecond))
+	if len(s.jobs) != 1 || len(s.queued) != 1 {
+		t.Fatalf("expected the config without wait to be queued once, got %d jobs", len(s.jobs))
+	}
+	if p := s.pending[1]; !p.min.Equal(now.Add(30*time.Millisecond)) || !p.max.Equal(now.Add(50*time.Millisecond)) {
+		t.Errorf("unexpected debounce deadlines: %+v", p)
+	}
+
+	s.dispatchDue(now.Add(25 * time.Millisecond))
+	if len(s.jobs) != 1 {
+		t.Errorf("expected no generation before the min wait, got %d jobs", len(s.jobs))
+	}
+	s.dispatchDue(now.Add(30 * time.Millisecond))
+	if len(s.jobs) != 2 || len(s.pending) != 0 {
+		t.Errorf("expected the debounced config to be queued, got %d jobs", len(s.jobs))
+	}
+	if events := s.queued[0].events; len(events) != 2 || events[0].ID != "a" || events[1].ID != "b" {
+		t.Errorf("expected the queued config to accumulate both events, got %+v", events)
+	}
+	if events := s.queued[1].events; len(events) != 2 {
+		t.Errorf("expected the debounced config to keep both events, got %+v", events)
+	}
+
+	s.dispatchDue(now.Add(time.Minute))
+	s.dispatch(2, false, nil)
+	if len(s.jobs) != 3 || !s.queued[2].alwaysNotify {
+		t.Errorf("expected the interval config to be queued once with notification, got %d jobs", len(s.jobs))
+	}
+}
+
+func TestSchedulerHealthEvents(t *testing.T) {
+	s := &scheduler{
+		configs: []Config{
+			Config{Watch: true},
+			Config{Watch: true, HealthEvents: true},
+		},
+		pending: make(map[int]pendingDebounce),
+		jobs:    make(chan int, 3),
+		queued:  make(map[int]*schedulerJob),
+	}
+
+	s.debounce(TriggerEvent{Type: "container", Action: "health_status: unhealthy", ID: "a"}, time.Now())
+	if len(s.jobs) != 1 || s.queued[1] == nil {
+		t.Errorf("expected only the config with health_events to be queued, got %d jobs", len(s.jobs))
+	}
+}
+
+func TestSchedulerNetworkAndVolumeEvents(t *testing.T) {
+	s := &scheduler{
+		configs: []Config{
+			Config{Watch: true},
+			Config{Watch: true, NetworkEvents: true, LabelFilters: []string{"com.example.proxy"}},
+			Config{Watch: true, VolumeEvents: true},
+		},
+		pending: make(map[int]pendingDebounce),
+		jobs:    make(chan int, 4),
+		queued:  make(map[int]*schedulerJob),
+	}
+
+	// network events don't carry the labels of the container
+	s.debounce(TriggerEvent{Type: "network", Action: "connect", ID: "n1", Attributes: map[string]string{"container": "a", "name": "frontend"}}, time.Now())
+	if len(s.jobs) != 1 || s.queued[1] == nil {
+		t.Errorf("expected only the config with network_events to be queued, got %d jobs", len(s.jobs))
+	}
+	s.debounce(TriggerEvent{Type: "volume", Action: "create", ID: "data"}, time.Now())
+	if len(s.jobs) != 2 || s.queued[2] == nil {
+		t.Errorf("expected only the config with volume_events to be queued, got %d jobs", len(s.jobs))
+	}
+}
+
+func TestSchedulerEventFilters(t *testing.T) {
+	s := &scheduler{
+		configs: []Config{
+			Config{Watch: true},
+			Config{Watch: true, LabelFilters: []string{"traefik.enable=true"}},
+			Config{Watch: true, NameFilters: []string{"web-*"}},
+		},
+		pending: make(map[int]pendingDebounce),
+		jobs:    make(chan int, 4),
+		queued:  make(map[int]*schedulerJob),
+	}
+
+	queued := func() []int {
+		indexes := []int{}
+		for i := range s.configs {
+			if s.queued[i] != nil {
+				indexes = append(indexes, i)
+			}
+		}
+		s.queued = make(map[int]*schedulerJob)
+		s.jobs = make(chan int, 4)
+		return indexes
+	}
+	tests := []struct {
+		attributes map[string]string
+		expected   []int
+	}{
+		{map[string]string{"name": "db", "image": "postgres"}, []int{0}},
+		{map[string]string{"name": "web-1", "traefik.enable": "true"}, []int{0, 1, 2}},
+		{map[string]string{"name": "api", "traefik.enable": "false"}, []int{0}},
+		// events synthesized when polling have no attributes
+		{nil, []int{0, 1, 2}},
+	}
+	for _, test := range tests {
+		s.debounce(TriggerEvent{Type: "container", Action: "start", ID: "a", Attributes: test.attributes}, time.Now())
+		if got := queued(); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%v: expected configs %v to be queued, got %v", test.attributes, test.expected, got)
+		}
+	}
+}
+
+func TestSchedulerDebounceStrategies(t *testing.T) {
+	wait := &Wait{20 * time.Millisecond, 50 * time.Millisecond}
+	s := &scheduler{
+		configs: []Config{
+			Config{Watch: true, Wait: wait, Debounce: DebounceLeading},
+			Config{Watch: true, Wait: wait, Debounce: DebounceQuiet},
+			Config{Watch: true, Wait: wait, DebounceBatch: 3},
+		},
+		pending: make(map[int]pendingDebounce),
+		jobs:    make(chan int, 4),
+		queued:  make(map[int]*schedulerJob),
+	}
+	queued := func(i int) int {
+		if job, ok := s.queued[i]; ok {
+			delete(s.queued, i)
+			<-s.jobs
+			return len(job.events)
+		}
+		return 0
+	}
+	event := func(id string) TriggerEvent {
+		return TriggerEvent{Type: "container", Action: "start", ID: id}
+	}
+
+	now := time.Now()
+	s.debounce(event("a"), now)
+	if n := queued(0); n != 1 {
+		t.Errorf("expected the leading config to be generated on the first event, got %d events", n)
+	}
+	for i := 1; i <= 3; i++ {
+		s.debounce(event("b"), now.Add(time.Duration(i)*15*time.Millisecond))
+	}
+	if n := queued(0); n != 0 {
+		t.Errorf("expected the leading config to wait for the end of its window, got %d events", n)
+	}
+	if n := queued(2); n != 3 {
+		t.Errorf("expected the trailing config to be generated once its batch is full, got %d events", n)
+	}
+
+	// the trailing config would have been generated at max by now
+	s.dispatchDue(now.Add(60 * time.Millisecond))
+	if n := queued(0); n != 3 {
+		t.Errorf("expected the leading config to be generated with the events of its window, got %d events", n)
+	}
+	if n := queued(1); n != 0 {
+		t.Errorf("expected the quiet config to wait for a quiet period, got %d events", n)
+	}
+	s.dispatchDue(now.Add(65 * time.Millisecond))
+	if n := queued(1); n != 4 {
+		t.Errorf("expected the quiet config to be generated after a quiet period, got %d events", n)
+	}
+
+	// the window of the leading config ends without events
+	s.dispatchDue(now.Add(time.Second))
+	s.debounce(event("c"), now.Add(2*time.Second))
+	if n := queued(0); n != 1 {
+		t.Errorf("expected the leading config to be generated right away after its window, got %d events", n)
+	}
+}
+
+func TestSchedulerListsOncePerRound(t *testing.T) {
+	var mu sync.Mutex
+	listings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/containers/json") {
+			mu.Lock()
+			listings++
+			mu.Unlock()
+			w.Write([]byte("[]"))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &scheduler{g: &generator{Client: client, Endpoint: server.URL}}
+
+	s.nextRound()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := s.containers(1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if listings != 1 {
+		t.Fatalf("Expected the jobs of a round to share a listing, got %d listings", listings)
+	}
+
+	s.nextRound()
+	s.containers(2)
+	s.containers(1)
+	if listings != 2 {
+		t.Errorf("Expected a single listing for the next round, got %d listings", listings)
+	}
+}
@@ -0,0 +1,158 @@
+package dockergen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procRoot is where the processes sharing docker-gen's PID namespace are
+// listed
+var procRoot = "/proc"
+
+// signalNames are the signals notify_signal accepts by name
+var signalNames = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"TERM":  syscall.SIGTERM,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// NotifyProcessSignal returns the signal sent to NotifyPIDFile and
+// NotifyProcess, SIGHUP by default
+func (c *Config) NotifyProcessSignal() (syscall.Signal, error) {
+	if c.NotifySignal == "" {
+		return syscall.SIGHUP, nil
+	}
+	if n, err := strconv.Atoi(c.NotifySignal); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(c.NotifySignal), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("Invalid notify_signal %q: must be a signal such as \"HUP\" or \"1\"", c.NotifySignal)
+}
+
+// signalNotifyProcesses signals the process of NotifyPIDFile and the
+// processes named NotifyProcess, which share docker-gen's container or pod,
+// without the docker API
+func (g *generator) signalNotifyProcesses(config Config) {
+	if config.NotifyPIDFile == "" && config.NotifyProcess == "" {
+		return
+	}
+	sig, err := config.NotifyProcessSignal()
+	if err != nil {
+		logErrorf("%s. Skipping notification of processes\n", err)
+		g.recordError(config, err)
+		return
+	}
+
+	pids := []int{}
+	if config.NotifyPIDFile != "" {
+		pid, err := readPIDFile(config.NotifyPIDFile)
+		if err != nil {
+			logErrorf("Error reading pid file %s: %s", config.NotifyPIDFile, err)
+		} else {
+			pids = append(pids, pid)
+		}
+	}
+	if config.NotifyProcess != "" {
+		found, err := findProcesses(config.NotifyProcess)
+		if err != nil {
+			logErrorf("Error listing processes: %s", err)
+		} else if len(found) == 0 {
+			logWarnf("No process named '%s'. Skipping its signal", config.NotifyProcess)
+		}
+		pids = append(pids, found...)
+	}
+
+	for _, pid := range pids {
+		logInfof("Sending process %d signal '%s'", pid, sig)
+		if err := syscall.Kill(pid, sig); err != nil {
+			logErrorf("Error sending signal to process %d: %s", pid, err)
+		}
+	}
+}
+
+// readPIDFile returns the process ID written to path, e.g. by nginx
+func readPIDFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid %q", strings.TrimSpace(string(data)))
+	}
+	return pid, nil
+}
+
+// findProcesses returns the processes other than docker-gen whose command
+// name or executable is name. Only the parent of processes with the same
+// name, e.g. the nginx master process and not its workers, is returned.
+func findProcesses(name string) ([]int, error) {
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	matched := map[int]int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if processName(pid) == name {
+			matched[pid] = parentPID(pid)
+		}
+	}
+
+	pids := []int{}
+	for pid, parent := range matched {
+		if _, ok := matched[parent]; !ok {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// processName returns the executable name of process pid: the base of its
+// first argument, or its command name for kernel threads and processes
+// that rewrote their arguments
+func processName(pid int) string {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	if cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		// e.g. "nginx: master process nginx -g daemon off;"
+		fields := strings.Fields(string(bytes.SplitN(cmdline, []byte{0}, 2)[0]))
+		if len(fields) > 0 && strings.TrimSuffix(fields[0], ":") != "" {
+			return filepath.Base(strings.TrimSuffix(fields[0], ":"))
+		}
+	}
+	comm, _ := ioutil.ReadFile(filepath.Join(dir, "comm"))
+	return strings.TrimSpace(string(comm))
+}
+
+// parentPID returns the parent of process pid, 0 if unknown
+func parentPID(pid int) int {
+	stat, err := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0
+	}
+	// the command name in parentheses may contain spaces
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	if len(fields) < 2 {
+		return 0
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid
+}
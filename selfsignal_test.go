@@ -0,0 +1,97 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNotifyProcessSignal(t *testing.T) {
+	for signal, expected := range map[string]syscall.Signal{
+		"":        syscall.SIGHUP,
+		"USR1":    syscall.SIGUSR1,
+		"sigterm": syscall.SIGTERM,
+		"10":      syscall.Signal(10),
+	} {
+		config := Config{NotifySignal: signal}
+		if sig, err := config.NotifyProcessSignal(); err != nil || sig != expected {
+			t.Errorf("Expected %q to be %s, got %s, %v", signal, expected, sig, err)
+		}
+	}
+	config := Config{NotifySignal: "RELOAD"}
+	if _, err := config.NotifyProcessSignal(); err == nil {
+		t.Errorf("Expected an unknown signal to be refused")
+	}
+}
+
+func TestFindProcesses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(root string) { procRoot = root }(procRoot)
+	procRoot = dir
+
+	for pid, proc := range map[int]struct{ cmdline, comm, stat string }{
+		1:  {"/bin/docker-gen\x00-watch\x00", "docker-gen", "1 (docker-gen) S 0"},
+		7:  {"nginx: master process nginx -g daemon off;\x00", "nginx", "7 (nginx) S 1"},
+		8:  {"nginx: worker process\x00", "nginx", "8 (nginx) S 7"},
+		9:  {"/usr/sbin/nginx\x00-t\x00", "nginx", "9 (nginx) S 1"},
+		12: {"", "kworker/0:1", "12 (kworker/0:1) I 2"},
+	} {
+		procDir := filepath.Join(dir, strconv.Itoa(pid))
+		os.Mkdir(procDir, 0755)
+		ioutil.WriteFile(filepath.Join(procDir, "cmdline"), []byte(proc.cmdline), 0644)
+		ioutil.WriteFile(filepath.Join(procDir, "comm"), []byte(proc.comm+"\n"), 0644)
+		ioutil.WriteFile(filepath.Join(procDir, "stat"), []byte(proc.stat), 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "self"), 0755)
+
+	pids, err := findProcesses("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pids, []int{7, 9}) {
+		t.Errorf("Expected the nginx processes without workers, got %v", pids)
+	}
+	if pids, _ := findProcesses("kworker/0:1"); !reflect.DeepEqual(pids, []int{12}) {
+		t.Errorf("Expected processes without arguments to be found by their command name, got %v", pids)
+	}
+}
+
+func TestSignalNotifyProcesses(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("Unable to start a process: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	pidFile := filepath.Join(dir, "sleep.pid")
+	ioutil.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644)
+
+	(&generator{}).signalNotifyProcesses(Config{NotifyPIDFile: pidFile, NotifySignal: "TERM"})
+	select {
+	case err := <-done:
+		if status, ok := err.(*exec.ExitError); !ok || status.Sys().(syscall.WaitStatus).Signal() != syscall.SIGTERM {
+			t.Errorf("Expected the process to be terminated by the signal, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Errorf("Expected the process of the pid file to be signalled")
+	}
+}
@@ -0,0 +1,139 @@
+package dockergen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type semver struct {
+	major, minor, patch int64
+	prerelease          string
+}
+
+// parseSemver parses versions such as "1.2.3", "v2.0.1-rc1" or "1.9"; missing
+// minor and patch numbers are zero and build meta-data is ignored
+func parseSemver(s string) (semver, error) {
+	v := semver{}
+	version := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(version, "+"); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.Index(version, "-"); i >= 0 {
+		v.prerelease = version[i+1:]
+		version = version[:i]
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("Invalid semantic version: %s", s)
+	}
+	numbers := []*int64{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("Invalid semantic version: %s", s)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// compare returns -1, 0 or 1. A pre-release sorts before its release.
+func (v semver) compare(o semver) int {
+	for _, d := range []int64{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d < 0 {
+			return -1
+		} else if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.prerelease == o.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case o.prerelease == "":
+		return -1
+	case v.prerelease < o.prerelease:
+		return -1
+	}
+	return 1
+}
+
+// semverMatches checks a version against a single constraint such as ">=1.2"
+func semverMatches(v semver, constraint string) (bool, error) {
+	constraint = strings.TrimSpace(constraint)
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(constraint, candidate) {
+			op = candidate
+			break
+		}
+	}
+	c, err := parseSemver(strings.TrimSpace(constraint[len(op):]))
+	if err != nil {
+		return false, fmt.Errorf("Invalid semver constraint: %s", constraint)
+	}
+
+	cmp := v.compare(c)
+	switch op {
+	case "", "=", "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case "~":
+		// same major and minor version, at least the given patch version
+		return cmp >= 0 && v.major == c.major && v.minor == c.minor, nil
+	case "^":
+		// same major version, at least the given version
+		return cmp >= 0 && v.major == c.major, nil
+	}
+	return false, nil
+}
+
+// semverCompare returns whether version satisfies all comma separated
+// constraints. Versions that are not semantic versions, such as "latest",
+// never match.
+func semverCompare(constraints, version string) (bool, error) {
+	v, verr := parseSemver(version)
+	for _, constraint := range strings.Split(constraints, ",") {
+		ok, err := semverMatches(v, constraint)
+		if err != nil {
+			return false, err
+		}
+		if !ok || verr != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func semverMajor(version string) (int64, error) {
+	v, err := parseSemver(version)
+	return v.major, err
+}
+
+func semverMinor(version string) (int64, error) {
+	v, err := parseSemver(version)
+	return v.minor, err
+}
+
+func semverPatch(version string) (int64, error) {
+	v, err := parseSemver(version)
+	return v.patch, err
+}
+
+// isSemver returns whether version is a semantic version
+func isSemver(version string) bool {
+	_, err := parseSemver(version)
+	return err == nil
+}
@@ -0,0 +1,48 @@
+package dockergen
+
+import "testing"
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		constraints string
+		version     string
+		expected    bool
+	}{
+		{"1.2.3", "v1.2.3", true},
+		{">=2.0", "2.0.0", true},
+		{">=2.0, <3", "2.9.1", true},
+		{">=2.0, <3", "3.0.0", false},
+		{">1.2.3", "1.2.3-rc1", false},
+		{"<1.2.3", "1.2.3-rc1", true},
+		{"~1.2.1", "1.2.5", true},
+		{"~1.2.1", "1.3.0", false},
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"!=1.0", "1.0.1", true},
+		{">=1.0", "latest", false},
+	}
+
+	for _, test := range tests {
+		got, err := semverCompare(test.constraints, test.version)
+		if err != nil {
+			t.Fatalf("semverCompare(%q, %q) failed: %v", test.constraints, test.version, err)
+		}
+		if got != test.expected {
+			t.Errorf("semverCompare(%q, %q): expected %v, got %v", test.constraints, test.version, test.expected, got)
+		}
+	}
+
+	if _, err := semverCompare(">=one", "1.0.0"); err == nil {
+		t.Error("expected an invalid constraint to fail")
+	}
+}
+
+func TestSemverParts(t *testing.T) {
+	tests := templateTestList{
+		{`{{semverMajor "v2.7.13"}}.{{semverMinor "v2.7.13"}}.{{semverPatch "v2.7.13"}}`, nil, `2.7.13`},
+		{`{{if isSemver .}}{{semverMajor .}}{{else}}none{{end}}`, "latest", `none`},
+		{`{{if semverCompare "^2" .}}v2{{else}}v1{{end}}`, "2.1.0", `v2`},
+	}
+
+	tests.run(t, "semver")
+}
@@ -0,0 +1,18 @@
+package dockergen
+
+import (
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// newSprigTemplate returns a template with the sprig function library. The
+// functions named like docker-gen's, e.g. first, dict or split, keep
+// docker-gen's behaviour so that existing templates render the same.
+func newSprigTemplate(name string) *template.Template {
+	funcs := sprig.TxtFuncMap()
+	for fn := range templateFuncs {
+		delete(funcs, fn)
+	}
+	return template.New(name).Funcs(funcs).Funcs(templateFuncs)
+}
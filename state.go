@@ -0,0 +1,160 @@
+package dockergen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// hostState is the event connection of a docker host, as reported on SIGUSR1
+type hostState struct {
+	watching  bool
+	since     time.Time
+	lastEvent time.Time
+}
+
+// setWatching records whether the docker events of host are watched
+func (g *generator) setWatching(host dockerHost, watching bool) {
+	g.hostsMu.Lock()
+	defer g.hostsMu.Unlock()
+	if g.hostStates == nil {
+		g.hostStates = map[string]*hostState{}
+	}
+	state, ok := g.hostStates[host.Endpoint]
+	if !ok {
+		state = &hostState{}
+		g.hostStates[host.Endpoint] = state
+	}
+	if !ok || state.watching != watching {
+		state.watching = watching
+		state.since = time.Now()
+	}
+}
+
+// recordEvent records the time of the last docker event of host
+func (g *generator) recordEvent(host dockerHost) {
+	g.hostsMu.Lock()
+	defer g.hostsMu.Unlock()
+	if state, ok := g.hostStates[host.Endpoint]; ok {
+		state.lastEvent = time.Now()
+	}
+}
+
+// watchStateSignal dumps the state of the generator on SIGUSR1, to the log
+// or to StateFile
+func (g *generator) watchStateSignal() {
+	if !g.keepsRunning() {
+		return
+	}
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer signal.Stop(usr1)
+
+		sigChan := g.newSignalChannel()
+		for {
+			select {
+			case <-usr1:
+				logInfof("Received signal: %s", syscall.SIGUSR1)
+				g.writeState()
+			case sig := <-sigChan:
+				switch sig {
+				case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (g *generator) writeState() {
+	var state bytes.Buffer
+	g.dumpState(&state)
+	if g.StateFile == "" {
+		for _, line := range strings.Split(strings.TrimRight(state.String(), "\n"), "\n") {
+			logInfof("%s", line)
+		}
+		return
+	}
+	if err := ioutil.WriteFile(g.StateFile, state.Bytes(), 0644); err != nil {
+		logErrorf("Unable to write state to %s: %s\n", g.StateFile, err)
+		return
+	}
+	logInfof("Wrote state to %s", g.StateFile)
+}
+
+// dumpState writes the docker connections and the configs with the outcome
+// of their last generation to w
+func (g *generator) dumpState(w io.Writer) {
+	now := time.Now()
+	ago := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), now.Sub(t).Round(time.Second))
+	}
+
+	fmt.Fprintf(w, "docker-gen state at %s\n", now.Format(time.RFC3339))
+	fmt.Fprintln(w, "docker hosts:")
+	if g.PollInterval > 0 {
+		fmt.Fprintf(w, "  polling containers every %s\n", g.PollInterval)
+	}
+	g.hostsMu.Lock()
+	endpoints := make([]string, 0, len(g.hostStates))
+	for endpoint := range g.hostStates {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		state := g.hostStates[endpoint]
+		if state.watching {
+			fmt.Fprintf(w, "  %s: watching events since %s, last event %s\n", endpoint, ago(state.since), ago(state.lastEvent))
+		} else {
+			fmt.Fprintf(w, "  %s: disconnected since %s\n", endpoint, ago(state.since))
+		}
+	}
+	g.hostsMu.Unlock()
+	if len(endpoints) == 0 && g.PollInterval == 0 {
+		fmt.Fprintln(w, "  not watching events")
+	}
+
+	statuses := map[string]GenerationStatus{}
+	for _, status := range g.Status() {
+		statuses[status.Template+":"+status.Dest] = status
+	}
+	g.deltaMu.Lock()
+	defer g.deltaMu.Unlock()
+	fmt.Fprintln(w, "configs:")
+	for _, config := range g.configs().Config {
+		key := config.Template + ":" + config.Dest
+		dest := config.Dest
+		if dest == "" {
+			dest = "stdout"
+		}
+		fmt.Fprintf(w, "  %s -> %s", config.Template, dest)
+		if config.Name != "" {
+			fmt.Fprintf(w, " (%s)", config.Name)
+		}
+		fmt.Fprintf(w, ": watch=%t interval=%d", config.Watch, config.Interval)
+		if containers, ok := g.lastContainers[key]; ok {
+			fmt.Fprintf(w, " containers=%d", len(containers))
+		}
+		fmt.Fprintln(w)
+
+		status := statuses[key]
+		fmt.Fprintf(w, "    last generated %s, %d errors\n", ago(status.LastGenerated), status.Errors)
+		if status.LastError != "" {
+			fmt.Fprintf(w, "    last error %s: %s\n", ago(status.LastErrorTime), status.LastError)
+		}
+	}
+}
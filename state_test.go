@@ -0,0 +1,39 @@
+package dockergen
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDumpState(t *testing.T) {
+	config := Config{Template: "state.tmpl", Dest: "/tmp/state-test.conf", Watch: true}
+	g := &generator{Configs: ConfigFile{Config: []Config{config}}}
+	host := dockerHost{Endpoint: "unix:///var/run/docker.sock"}
+	g.setWatching(host, true)
+	g.recordEvent(host)
+	g.updateDelta(config, Context{&RuntimeContainer{ID: "1", State: State{Running: true}}})
+	g.recordSuccess(config)
+	g.recordError(config, errors.New("template error"))
+
+	var state bytes.Buffer
+	g.dumpState(&state)
+	for _, expected := range []string{
+		"unix:///var/run/docker.sock: watching events since",
+		"state.tmpl -> /tmp/state-test.conf: watch=true interval=0 containers=1",
+		"1 errors",
+		"template error",
+	} {
+		if !strings.Contains(state.String(), expected) {
+			t.Fatalf("Expected state to contain %q, got:\n%s", expected, state.String())
+		}
+	}
+
+	g.setWatching(host, false)
+	state.Reset()
+	g.dumpState(&state)
+	if !strings.Contains(state.String(), "unix:///var/run/docker.sock: disconnected since") {
+		t.Fatalf("Expected host to be disconnected, got:\n%s", state.String())
+	}
+}
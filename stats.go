@@ -0,0 +1,192 @@
+package dockergen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// statsCache holds the latest stats sample of the containers of all hosts,
+// keyed by host endpoint and container ID
+type statsCache struct {
+	sync.Mutex
+	entries map[string]ContainerStats
+}
+
+// withStats returns containers with the stats of the running containers of
+// config, sampled with up to InspectJobs concurrent calls. Samples younger
+// than the config's stats_interval are reused. Containers are copied rather
+// than updated as they are shared by all configs.
+func (g *generator) withStats(config Config, containers Context) Context {
+	if !config.Stats {
+		return containers
+	}
+	interval, timeout, err := config.StatsDeadlines()
+	if err != nil {
+		logErrorf("%s. Not sampling the stats of the containers of %s\n", err, config.Dest)
+		g.recordError(config, err)
+		return containers
+	}
+
+	hosts := map[string]dockerHost{}
+	for _, host := range g.dockerHosts() {
+		hosts[host.Endpoint] = host
+	}
+	sampled := map[*RuntimeContainer]ContainerStats{}
+	var mu sync.Mutex
+	jobs := make(chan *RuntimeContainer)
+	var wg sync.WaitGroup
+	for i := 0; i < g.inspectJobs(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for container := range jobs {
+				host, ok := hosts[container.Host]
+				if !ok {
+					continue
+				}
+				stats, ok := g.containerStats(host, container.ID, interval, timeout)
+				if ok {
+					mu.Lock()
+					sampled[container] = stats
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, container := range filterContainers(config, containers) {
+		if container.State.Running {
+			jobs <- container
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	g.forgetStats(containers)
+
+	withStats := make(Context, len(containers))
+	for i, container := range containers {
+		withStats[i] = container
+		if stats, ok := sampled[container]; ok {
+			c := *container
+			c.Stats = stats
+			withStats[i] = &c
+		}
+	}
+	return withStats
+}
+
+// containerStats returns the stats of the container id of host, sampled
+// unless the previous sample is younger than interval. Containers that could
+// not be sampled keep their previous sample.
+func (g *generator) containerStats(host dockerHost, id string, interval, timeout time.Duration) (ContainerStats, bool) {
+	key := host.Endpoint + "/" + id
+	g.stats.Lock()
+	previous, ok := g.stats.entries[key]
+	g.stats.Unlock()
+	if ok && time.Since(previous.Sampled) < interval {
+		return previous, true
+	}
+
+	sample, err := sampleStats(host.Client, id, timeout)
+	if err != nil {
+		logWarnf("Unable to sample the stats of container %s: %s", id, err)
+		return previous, ok
+	}
+	stats := statsOf(sample)
+	g.stats.Lock()
+	if g.stats.entries == nil {
+		g.stats.entries = map[string]ContainerStats{}
+	}
+	g.stats.entries[key] = stats
+	g.stats.Unlock()
+	return stats, true
+}
+
+// forgetStats drops the samples of the containers that no longer exist
+func (g *generator) forgetStats(containers Context) {
+	listed := map[string]bool{}
+	for _, container := range containers {
+		listed[container.Host+"/"+container.ID] = true
+	}
+	g.stats.Lock()
+	defer g.stats.Unlock()
+	for key := range g.stats.entries {
+		if !listed[key] {
+			delete(g.stats.entries, key)
+		}
+	}
+}
+
+// sampleStats returns a single stats sample of container id, for which
+// dockerd measures the CPU usage over about a second
+func sampleStats(client *docker.Client, id string, timeout time.Duration) (*docker.Stats, error) {
+	samples := make(chan *docker.Stats, 1)
+	done := make(chan bool)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- client.Stats(docker.StatsOptions{
+			ID:                id,
+			Stats:             samples,
+			Stream:            false,
+			Done:              done,
+			Timeout:           timeout,
+			InactivityTimeout: timeout,
+		})
+	}()
+
+	select {
+	case sample, ok := <-samples:
+		close(done)
+		for range samples {
+		}
+		if err := <-errs; !ok || sample == nil {
+			if err == nil {
+				err = fmt.Errorf("no stats returned")
+			}
+			return nil, err
+		}
+		return sample, nil
+	case <-time.After(timeout):
+		close(done)
+		for range samples {
+		}
+		<-errs
+		return nil, fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// statsOf computes the CPU and memory usage of a stats sample like docker
+// stats does
+func statsOf(sample *docker.Stats) ContainerStats {
+	stats := ContainerStats{
+		MemLimit: sample.MemoryStats.Limit,
+		Sampled:  time.Now(),
+	}
+
+	cpuDelta := float64(sample.CPUStats.CPUUsage.TotalUsage) - float64(sample.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(sample.CPUStats.SystemCPUUsage) - float64(sample.PreCPUStats.SystemCPUUsage)
+	cpus := float64(sample.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(sample.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	// the page cache is reclaimable, docker stats doesn't count it either:
+	// inactive_file on cgroup v2, total_inactive_file or cache on v1
+	cache := sample.MemoryStats.Stats.InactiveFile
+	if cache == 0 {
+		cache = sample.MemoryStats.Stats.TotalInactiveFile
+	}
+	if cache == 0 {
+		cache = sample.MemoryStats.Stats.Cache
+	}
+	stats.MemUsage = sample.MemoryStats.Usage
+	if cache < stats.MemUsage {
+		stats.MemUsage -= cache
+	}
+	return stats
+}
@@ -0,0 +1,56 @@
+package dockergen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestWithStats(t *testing.T) {
+	samples := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/containers/web/stats") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		samples++
+		w.Write([]byte(`{
+			"cpu_stats": {"cpu_usage": {"total_usage": 3000000000}, "system_cpu_usage": 20000000000, "online_cpus": 4},
+			"precpu_stats": {"cpu_usage": {"total_usage": 1000000000}, "system_cpu_usage": 12000000000},
+			"memory_stats": {"usage": 104857600, "limit": 536870912, "stats": {"inactive_file": 4194304}}
+		}`))
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &generator{Client: client, Endpoint: server.URL}
+	web := &RuntimeContainer{ID: "web", Host: server.URL, State: State{Running: true}}
+	stopped := &RuntimeContainer{ID: "db", Host: server.URL}
+	config := Config{Stats: true, IncludeStopped: true}
+	for i := 0; i < 2; i++ {
+		containers := g.withStats(config, Context{web, stopped})
+		stats := containers[0].Stats
+		if stats.CPUPercent != 100 || stats.MemUsage != 96*1024*1024 || stats.MemLimit != 512*1024*1024 {
+			t.Fatalf("Unexpected stats %+v", stats)
+		}
+		if containers[1] != stopped {
+			t.Errorf("Expected the stopped container to be unchanged")
+		}
+	}
+	if web.Stats.CPUPercent != 0 {
+		t.Errorf("Expected the shared container to be copied")
+	}
+	if samples != 1 {
+		t.Errorf("Expected the sample to be reused within stats_interval, got %d samples", samples)
+	}
+
+	if containers := g.withStats(Config{}, Context{web}); containers[0] != web {
+		t.Errorf("Expected no stats without stats = true")
+	}
+}
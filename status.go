@@ -0,0 +1,69 @@
+package dockergen
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// GenerationStatus records the outcome of the generations of a single destination
+type GenerationStatus struct {
+	Dest          string
+	Template      string
+	LastGenerated time.Time
+	LastError     string
+	LastErrorTime time.Time
+	Errors        int
+}
+
+// statusStore holds the generation status of the configs of a generator
+type statusStore struct {
+	sync.RWMutex
+	statuses map[string]*GenerationStatus
+}
+
+func (s *statusStore) statusFor(config Config) *GenerationStatus {
+	key := config.Template + ":" + config.Dest
+	if s.statuses == nil {
+		s.statuses = make(map[string]*GenerationStatus)
+	}
+	status, ok := s.statuses[key]
+	if !ok {
+		status = &GenerationStatus{Dest: config.Dest, Template: config.Template}
+		s.statuses[key] = status
+	}
+	return status
+}
+
+func (g *generator) recordSuccess(config Config) {
+	g.statuses.Lock()
+	defer g.statuses.Unlock()
+	g.statuses.statusFor(config).LastGenerated = time.Now()
+}
+
+func (g *generator) recordError(config Config, err error) {
+	g.statuses.Lock()
+	defer g.statuses.Unlock()
+	status := g.statuses.statusFor(config)
+	status.LastError = err.Error()
+	status.LastErrorTime = time.Now()
+	status.Errors++
+}
+
+// Status returns a snapshot of the generation status of every config
+func (g *generator) Status() []GenerationStatus {
+	g.statuses.RLock()
+	defer g.statuses.RUnlock()
+
+	ret := make([]GenerationStatus, 0, len(g.statuses.statuses))
+	for _, status := range g.statuses.statuses {
+		ret = append(ret, *status)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Dest == ret[j].Dest {
+			return ret[i].Template < ret[j].Template
+		}
+		return ret[i].Dest < ret[j].Dest
+	})
+	return ret
+}
@@ -0,0 +1,64 @@
+package dockergen
+
+import (
+	"context"
+	"time"
+)
+
+// Stop stops watching docker events, intervals, files and the other triggers
+// of the generator like SIGINT does, so Generate returns once the running
+// generations are done. Configs are not drained.
+func (g *generator) Stop() {
+	g.stopMu.Lock()
+	g.stopped = true
+	g.stopMu.Unlock()
+	g.stopGeneration()
+}
+
+// stopGeneration stops the goroutines of the current generation cycle, which
+// Generate restarts when configs were reloaded
+func (g *generator) stopGeneration() {
+	stop := g.stopChannel()
+	g.stopMu.Lock()
+	defer g.stopMu.Unlock()
+	select {
+	case <-stop:
+	default:
+		close(stop)
+	}
+}
+
+// GenerateContext runs Generate until ctx is done, then stops the generator
+func (g *generator) GenerateContext(ctx context.Context) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			g.Stop()
+		case <-done:
+		}
+	}()
+	return g.Generate()
+}
+
+func (g *generator) stopChannel() chan struct{} {
+	g.stopMu.Lock()
+	defer g.stopMu.Unlock()
+	if g.stop == nil {
+		g.stop = make(chan struct{})
+	}
+	return g.stop
+}
+
+// sleep waits for d and returns false when the generator is stopped first
+func (g *generator) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-g.stopChannel():
+		return false
+	}
+}
@@ -0,0 +1,110 @@
+package dockergen
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestGenerateContext(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDockerEnv(&docker.Env{})
+
+	tmplFile, err := ioutil.TempFile(os.TempDir(), "docker-gen-tmpl")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v\n", err)
+	}
+	defer os.Remove(tmplFile.Name())
+
+	g := &generator{
+		Client:   client,
+		Endpoint: server.URL,
+		Configs: ConfigFile{
+			Config: []Config{
+				Config{Template: tmplFile.Name(), Watch: true, Interval: 60},
+			},
+		},
+		retry: true,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- g.GenerateContext(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected Generate to succeed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Generate to return once the context is done")
+	}
+	g.Stop()
+}
+
+func TestGeneratorsDontShareState(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tmplPath := dir + "/stream.tmpl"
+	ioutil.WriteFile(tmplPath, []byte(`{{range $batch := containerBatches 1}}{{range $batch}}{{.ID}}{{end}}{{end}}`), 0644)
+
+	// e.g. two generators embedded in the same process
+	config := Config{Template: tmplPath, Dest: dir + "/out.conf", Stream: true}
+	generators := []*generator{{}, {}}
+	for i, g := range generators {
+		id := string(rune('a' + i))
+		g.Configs.Config = []Config{config}
+		g.containerStreamer = func(config Config, size int, done <-chan struct{}) <-chan Context {
+			batches := make(chan Context, 1)
+			batches <- Context{&RuntimeContainer{ID: id}}
+			close(batches)
+			return batches
+		}
+	}
+	for i, g := range generators {
+		if changed, err := g.renderFile(config, Context{}); err != nil || !changed {
+			t.Fatalf("Expected the file to be generated, got %v", err)
+		}
+		expected := string(rune('a' + i))
+		if value, _ := ioutil.ReadFile(config.Dest); string(value) != expected {
+			t.Errorf("Expected generator %d to stream its own containers, got %s", i, value)
+		}
+		if status := g.Status(); len(status) != 1 || status[0].Errors != 0 {
+			t.Errorf("Expected generator %d to record its own generation, got %+v", i, status)
+		}
+	}
+	generators[0].recordError(Config{Template: tmplPath, Dest: dir + "/out.conf"}, os.ErrNotExist)
+	if status := generators[1].Status(); status[0].Errors != 0 {
+		t.Errorf("Expected the errors of a generator not to be recorded by the other, got %+v", status)
+	}
+}
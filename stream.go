@@ -0,0 +1,155 @@
+package dockergen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+var errNotStreaming = errors.New("containerBatches requires stream = true in the config")
+
+// streamConflicts returns the options of a stream = true config that need
+// all its containers at once, e.g. to compare them with the previous ones
+func streamConflicts(config Config) []string {
+	options := []string{}
+	if !config.Stream {
+		return options
+	}
+	if config.FanOut != "" {
+		options = append(options, "fan_out")
+	}
+	if config.DNSProvider != "" {
+		options = append(options, "dns_provider")
+	}
+	if config.NotifyHTTP != nil {
+		options = append(options, "notify_http")
+	}
+	return options
+}
+
+// checkStream returns an error naming the first stream = true config with
+// options requiring all its containers
+func checkStream(configs ConfigFile) error {
+	for _, config := range configs.Config {
+		if options := streamConflicts(config); len(options) > 0 {
+			return fmt.Errorf("Config %s streams its containers, which %s can't be combined with", config.Template, strings.Join(options, ", "))
+		}
+	}
+	return nil
+}
+
+// streamFuncs returns the template functions of a stream = true config. The
+// batches stop being inspected once done is closed. When the generation
+// inspected the containers already, containers are batched instead.
+func (g *generator) streamFuncs(config Config, containers Context, done <-chan struct{}) template.FuncMap {
+	return template.FuncMap{
+		"containerBatches": func(size int) (<-chan Context, error) {
+			if !config.Stream || g.containerStreamer == nil {
+				return nil, errNotStreaming
+			}
+			if size < 1 {
+				size = 1
+			}
+			if !g.streamOnly() {
+				return batchContainers(containers, size, done), nil
+			}
+			return g.containerStreamer(config, size, done), nil
+		},
+	}
+}
+
+// batchContainers sends containers in batches of size until done is closed
+func batchContainers(containers Context, size int, done <-chan struct{}) <-chan Context {
+	batches := make(chan Context)
+	go func() {
+		defer close(batches)
+		for len(containers) > 0 {
+			n := size
+			if n > len(containers) {
+				n = len(containers)
+			}
+			select {
+			case batches <- containers[:n]:
+				containers = containers[n:]
+			case <-done:
+				return
+			}
+		}
+	}()
+	return batches
+}
+
+// containerBatches is registered for all templates so they parse without
+// stream = true; it fails when executed
+func containerBatches(size int) (<-chan Context, error) {
+	return nil, errNotStreaming
+}
+
+// streamContainers lists the containers of all docker hosts and inspects
+// them one by one, so at most one batch of inspected containers is held in
+// memory at a time
+func (g *generator) streamContainers(config Config, size int, done <-chan struct{}) <-chan Context {
+	batches := make(chan Context)
+	go func() {
+		defer close(batches)
+
+		batch := make(Context, 0, size)
+		for _, host := range g.dockerHosts() {
+			ctx, cancel := g.apiContext()
+			apiContainers, err := host.Client.ListContainers(docker.ListContainersOptions{
+				All:     g.All,
+				Size:    false,
+				Filters: mergeListFilters(config.Filters, labelListFilters(config.LabelFilters)),
+				Context: ctx,
+			})
+			cancel()
+			if err != nil {
+				logErrorf("Error listing containers of %s: %s\n", host.Endpoint, err)
+				continue
+			}
+
+			swarm := newSwarmInspector(host.Client, logErrorf)
+			for _, apiContainer := range apiContainers {
+				container, ok := g.inspectContainer(host, apiContainer.ID, swarm, logErrorf)
+				if !ok {
+					continue
+				}
+				container.listedBy = map[string]bool{config.listFiltersKey(): true}
+				if len(filterContainers(config, Context{container})) == 0 {
+					continue
+				}
+				batch = append(batch, container)
+				if len(batch) < size {
+					continue
+				}
+				select {
+				case batches <- batch:
+					batch = make(Context, 0, size)
+				case <-done:
+					return
+				}
+			}
+		}
+		if len(batch) > 0 {
+			select {
+			case batches <- batch:
+			case <-done:
+			}
+		}
+	}()
+	return batches
+}
+
+// streamOnly returns whether all configs stream their containers, in which
+// case generations don't inspect the containers up front
+func (g *generator) streamOnly() bool {
+	for _, config := range g.configs().Config {
+		if !config.Stream {
+			return false
+		}
+	}
+	return len(g.configs().Config) > 0
+}
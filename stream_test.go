@@ -0,0 +1,83 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestContainerBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmplPath := filepath.Join(dir, "stream.tmpl")
+	if err := ioutil.WriteFile(tmplPath, []byte(`{{range $batch := containerBatches 2}}[{{range $batch}}{{.ID}}{{end}}]{{end}}`), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	stopped := make(chan struct{})
+	g := &generator{Configs: ConfigFile{Config: []Config{{Stream: true}}}}
+	g.containerStreamer = func(config Config, size int, done <-chan struct{}) <-chan Context {
+		batches := make(chan Context)
+		go func() {
+			batch := Context{}
+			for i := 1; i <= 5; i++ {
+				batch = append(batch, &RuntimeContainer{ID: strconv.Itoa(i)})
+				if len(batch) == size || i == 5 {
+					batches <- batch
+					batch = Context{}
+				}
+			}
+			close(batches)
+			<-done
+			close(stopped)
+		}()
+		return batches
+	}
+
+	done := make(chan struct{})
+	contents, err := executeTemplate(Config{Template: tmplPath}, Context{}, 0, g.streamFuncs(Config{Stream: true}, Context{}, done))
+	close(done)
+	if err != nil {
+		t.Fatalf("Expected the template to render, got %v", err)
+	}
+	if string(contents) != "[12][34][5]" {
+		t.Errorf("expected: %s. got: %s", "[12][34][5]", contents)
+	}
+	<-stopped
+
+	if _, err := executeTemplate(Config{Template: tmplPath}, Context{}, 0, g.streamFuncs(Config{}, Context{}, done)); err == nil || !strings.Contains(err.Error(), "stream = true") {
+		t.Errorf("Expected containerBatches to fail without stream = true, got %v", err)
+	}
+
+	// the containers inspected for the configs that don't stream are batched
+	// rather than inspected again
+	g.Configs.Config = append(g.Configs.Config, Config{})
+	containers := Context{&RuntimeContainer{ID: "a"}, &RuntimeContainer{ID: "b"}, &RuntimeContainer{ID: "c"}}
+	done = make(chan struct{})
+	defer close(done)
+	contents, err = executeTemplate(Config{Template: tmplPath}, containers, 0, g.streamFuncs(Config{Stream: true}, containers, done))
+	if err != nil {
+		t.Fatalf("Expected the template to render, got %v", err)
+	}
+	if string(contents) != "[ab][c]" {
+		t.Errorf("expected: %s. got: %s", "[ab][c]", contents)
+	}
+}
+
+func TestCheckStream(t *testing.T) {
+	configs := ConfigFile{Config: []Config{{Template: "batches.tmpl", Stream: true, NotifyCmd: "nginx -s reload"}}}
+	if err := checkStream(configs); err != nil {
+		t.Errorf("Expected a streaming config to be valid, got %v", err)
+	}
+	configs.Config = append(configs.Config, Config{Template: "fanout.tmpl", Stream: true, FanOut: FanOutContainer, DNSProvider: DNSProviderRoute53})
+	if err := checkStream(configs); err == nil || !strings.Contains(err.Error(), "fanout.tmpl streams its containers, which fan_out, dns_provider can't") {
+		t.Errorf("Expected the options needing all containers to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package dockergen
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// swarmInspector inspects swarm services and networks once per generation,
+// however many of their containers run on this node
+type swarmInspector struct {
+	// mu serializes the inspections of containers inspected concurrently
+	mu       sync.Mutex
+	client   *docker.Client
+	logError func(format string, v ...interface{})
+	services map[string]*SwarmService
+	networks map[string]*docker.Network
+	tasks    map[string]SwarmTask
+	nodes    map[string]*SwarmNode
+}
+
+func newSwarmInspector(client *docker.Client, logError func(format string, v ...interface{})) *swarmInspector {
+	return &swarmInspector{
+		client:   client,
+		logError: logError,
+		services: make(map[string]*SwarmService),
+		networks: make(map[string]*docker.Network),
+		tasks:    make(map[string]SwarmTask),
+		nodes:    make(map[string]*SwarmNode),
+	}
+}
+
+// node returns the swarm node nodeID, inspected once however many
+// containers run on it
+func (s *swarmInspector) node(nodeID string) (*SwarmNode, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if node, ok := s.nodes[nodeID]; ok {
+		return node, node != nil
+	}
+	s.nodes[nodeID] = nil
+
+	n, err := s.client.InspectNode(nodeID)
+	if err != nil {
+		s.logError("Error inspecting swarm node %s: %s\n", nodeID, err)
+		return nil, false
+	}
+	node := &SwarmNode{
+		ID:   n.ID,
+		Name: n.Spec.Name,
+		Address: Address{
+			IP: n.Status.Addr,
+		},
+		Role:          string(n.Spec.Role),
+		Availability:  string(n.Spec.Availability),
+		State:         string(n.Status.State),
+		EngineVersion: n.Description.Engine.EngineVersion,
+		Labels:        map[string]string{},
+	}
+	for k, v := range n.Spec.Labels {
+		node.Labels[k] = v
+	}
+	s.nodes[nodeID] = node
+	return node, true
+}
+
+func (s *swarmInspector) network(networkID string) (*docker.Network, error) {
+	if network, ok := s.networks[networkID]; ok {
+		return network, nil
+	}
+	network, err := s.client.NetworkInfo(networkID)
+	if err != nil {
+		return nil, err
+	}
+	s.networks[networkID] = network
+	return network, nil
+}
+
+// service returns the service with its VIPs and the IPs of its running tasks
+// per network. DNSRR services have no VIP; their networks only list task IPs.
+func (s *swarmInspector) service(serviceID string) (*SwarmService, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inspectService(serviceID)
+}
+
+func (s *swarmInspector) inspectService(serviceID string) (*SwarmService, bool) {
+	if service, ok := s.services[serviceID]; ok {
+		return service, service != nil
+	}
+	s.services[serviceID] = nil
+
+	svc, err := s.client.InspectService(serviceID)
+	if err != nil {
+		s.logError("Error inspecting swarm service %s: %s\n", serviceID, err)
+		return nil, false
+	}
+	service := &SwarmService{
+		ID:       svc.ID,
+		Name:     svc.Spec.Name,
+		Networks: []SwarmServiceNetwork{},
+	}
+	service.Placement = SwarmPlacement{Constraints: []string{}, Preferences: []string{}}
+	if placement := svc.Spec.TaskTemplate.Placement; placement != nil {
+		service.Placement.Constraints = append(service.Placement.Constraints, placement.Constraints...)
+		for _, preference := range placement.Preferences {
+			if preference.Spread != nil {
+				service.Placement.Preferences = append(service.Placement.Preferences, preference.Spread.SpreadDescriptor)
+			}
+		}
+		service.Placement.MaxReplicas = placement.MaxReplicas
+	}
+	if resources := svc.Spec.TaskTemplate.Resources; resources != nil && resources.Reservations != nil {
+		service.Reservations = SwarmResources{
+			NanoCPUs:    resources.Reservations.NanoCPUs,
+			MemoryBytes: resources.Reservations.MemoryBytes,
+		}
+	}
+	service.Secrets, service.Configs = []SwarmFile{}, []SwarmFile{}
+	if spec := svc.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		for _, secret := range spec.Secrets {
+			file := SwarmFile{ID: secret.SecretID, Name: secret.SecretName}
+			if secret.File != nil {
+				// relative targets are below /run/secrets
+				file.Target = secret.File.Name
+				if !path.IsAbs(file.Target) {
+					file.Target = path.Join("/run/secrets", file.Target)
+				}
+				file.UID, file.GID, file.Mode = secret.File.UID, secret.File.GID, secret.File.Mode
+			}
+			service.Secrets = append(service.Secrets, file)
+		}
+		for _, config := range spec.Configs {
+			file := SwarmFile{ID: config.ConfigID, Name: config.ConfigName}
+			if config.File != nil {
+				file.Target = config.File.Name
+				if !path.IsAbs(file.Target) {
+					file.Target = path.Join("/", file.Target)
+				}
+				file.UID, file.GID, file.Mode = config.File.UID, config.File.GID, config.File.Mode
+			}
+			service.Configs = append(service.Configs, file)
+		}
+	}
+
+	if status := svc.UpdateStatus; status != nil {
+		service.UpdateStatus.State = string(status.State)
+		service.UpdateStatus.Message = status.Message
+		if status.StartedAt != nil {
+			service.UpdateStatus.StartedAt = *status.StartedAt
+		}
+		if status.CompletedAt != nil {
+			service.UpdateStatus.CompletedAt = *status.CompletedAt
+		}
+	}
+
+	mode := svc.Spec.Mode
+	switch {
+	case mode.Global != nil:
+		service.Mode = SwarmModeGlobal
+	case mode.ReplicatedJob != nil:
+		service.Mode = SwarmModeReplicatedJob
+		service.Job.MaxConcurrent = 1
+		if mode.ReplicatedJob.MaxConcurrent != nil {
+			service.Job.MaxConcurrent = *mode.ReplicatedJob.MaxConcurrent
+		}
+		if mode.ReplicatedJob.TotalCompletions != nil {
+			service.Job.TotalCompletions = *mode.ReplicatedJob.TotalCompletions
+		} else {
+			service.Job.TotalCompletions = service.Job.MaxConcurrent
+		}
+	case mode.GlobalJob != nil:
+		service.Mode = SwarmModeGlobalJob
+	default:
+		service.Mode = SwarmModeReplicated
+		service.DesiredReplicas = 1
+		if mode.Replicated != nil && mode.Replicated.Replicas != nil {
+			service.DesiredReplicas = *mode.Replicated.Replicas
+		}
+	}
+
+	taskIPs := map[string][]string{}
+	tasks, err := s.client.ListTasks(docker.ListTasksOptions{
+		Filters: map[string][]string{"service": {serviceID}},
+	})
+	if err != nil {
+		s.logError("Error listing tasks of swarm service %s: %s\n", serviceID, err)
+	}
+	service.Tasks = make([]SwarmTask, 0, len(tasks))
+	for _, task := range tasks {
+		s.tasks[task.ID] = s.newSwarmTask(task)
+		service.Tasks = append(service.Tasks, s.tasks[task.ID])
+		if service.IsJob() && task.Status.State == "complete" {
+			service.Job.CompletedTasks++
+		}
+		if service.Mode != SwarmModeReplicated && task.DesiredState == "running" {
+			service.DesiredReplicas++
+		}
+		if task.Status.State != "running" || task.DesiredState != "running" {
+			continue
+		}
+		service.RunningReplicas++
+		if service.IsJob() {
+			service.Job.RunningTasks++
+		}
+		for _, attachment := range task.NetworksAttachments {
+			for _, addr := range attachment.Addresses {
+				taskIPs[attachment.Network.ID] = append(taskIPs[attachment.Network.ID], strings.Split(addr, "/")[0])
+			}
+		}
+	}
+
+	addNetwork := func(networkID, ip string) {
+		network, err := s.network(networkID)
+		if err != nil {
+			s.logError("Error inspecting swarm service network %s: %s\n", networkID, err)
+			return
+		}
+		ips := taskIPs[networkID]
+		if ips == nil {
+			ips = []string{}
+		}
+		service.Networks = append(service.Networks, SwarmServiceNetwork{
+			IP:      ip,
+			Name:    network.Name,
+			Scope:   network.Scope,
+			Driver:  network.Driver,
+			TaskIPs: ips,
+		})
+		delete(taskIPs, networkID)
+	}
+	for _, vip := range svc.Endpoint.VirtualIPs {
+		addNetwork(vip.NetworkID, strings.Split(vip.Addr, "/")[0])
+	}
+	remaining := make([]string, 0, len(taskIPs))
+	for networkID := range taskIPs {
+		remaining = append(remaining, networkID)
+	}
+	sort.Strings(remaining)
+	for _, networkID := range remaining {
+		addNetwork(networkID, "")
+	}
+
+	// the endpoint lists the published ports swarm assigned, unlike the spec
+	service.Ports = []SwarmServicePort{}
+	for _, port := range svc.Endpoint.Ports {
+		service.Ports = append(service.Ports, SwarmServicePort{
+			Name:          port.Name,
+			PublishedPort: port.PublishedPort,
+			TargetPort:    port.TargetPort,
+			Protocol:      string(port.Protocol),
+			PublishMode:   string(port.PublishMode),
+		})
+	}
+
+	sort.SliceStable(service.Tasks, func(i, j int) bool {
+		a, b := service.Tasks[i], service.Tasks[j]
+		if a.Slot != b.Slot {
+			return a.Slot < b.Slot
+		}
+		if a.NodeID != b.NodeID {
+			return a.NodeID < b.NodeID
+		}
+		return a.ID < b.ID
+	})
+
+	s.services[serviceID] = service
+	return service, true
+}
+
+func (s *swarmInspector) newSwarmTask(task swarm.Task) SwarmTask {
+	t := SwarmTask{
+		ID:           task.ID,
+		Slot:         task.Slot,
+		NodeID:       task.NodeID,
+		DesiredState: string(task.DesiredState),
+		State:        string(task.Status.State),
+		Networks:     []SwarmTaskNetwork{},
+	}
+	if task.Status.ContainerStatus != nil {
+		t.ContainerID = task.Status.ContainerStatus.ContainerID
+	}
+	for _, attachment := range task.NetworksAttachments {
+		network := SwarmTaskNetwork{Name: attachment.Network.Spec.Name, IPs: []string{}}
+		if network.Name == "" {
+			// the network of the attachment isn't always complete
+			network.Name = attachment.Network.ID
+			if n, err := s.network(attachment.Network.ID); err == nil {
+				network.Name = n.Name
+			}
+		}
+		for _, addr := range attachment.Addresses {
+			network.IPs = append(network.IPs, strings.Split(addr, "/")[0])
+		}
+		t.Networks = append(t.Networks, network)
+	}
+	return t
+}
+
+// task returns the swarm task a container belongs to. The tasks of the
+// container's service were listed with the service, so this only inspects
+// tasks started since.
+func (s *swarmInspector) task(serviceID, taskID string) (SwarmTask, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if serviceID != "" {
+		s.inspectService(serviceID)
+	}
+	if task, ok := s.tasks[taskID]; ok {
+		return task, true
+	}
+	task, err := s.client.InspectTask(taskID)
+	if err != nil {
+		s.logError("Error inspecting swarm task %s: %s\n", taskID, err)
+		return SwarmTask{}, false
+	}
+	s.tasks[taskID] = s.newSwarmTask(*task)
+	return s.tasks[taskID], true
+}
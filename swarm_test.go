@@ -0,0 +1,211 @@
+package dockergen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestSwarmInspectorService(t *testing.T) {
+	serviceRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/services/web"):
+			serviceRequests++
+			w.Write([]byte(`{"ID":"web","Spec":{"Name":"web","Mode":{"Replicated":{"Replicas":3}},"TaskTemplate":{"Placement":{"Constraints":["node.role==worker"],"Preferences":[{"Spread":{"SpreadDescriptor":"node.labels.zone"}}],"MaxReplicas":2},"Resources":{"Reservations":{"NanoCPUs":500000000,"MemoryBytes":268435456}},"ContainerSpec":{"Secrets":[{"File":{"Name":"site.key","UID":"0","GID":"0","Mode":256},"SecretID":"s1","SecretName":"site_key"},{"File":{"Name":"/etc/ssl/site.crt","Mode":292},"SecretID":"s2","SecretName":"site_crt"}],"Configs":[{"File":{"Name":"nginx.conf","Mode":292},"ConfigID":"c1","ConfigName":"nginx_conf"},{"Runtime":{},"ConfigID":"c2","ConfigName":"credspec"}]}}},"UpdateStatus":{"State":"updating","StartedAt":"2016-01-02T15:04:05Z","Message":"update in progress"},"Endpoint":{"Ports":[{"Protocol":"tcp","TargetPort":80,"PublishedPort":8080,"PublishMode":"ingress"},{"Name":"metrics","Protocol":"tcp","TargetPort":9100,"PublishedPort":30001,"PublishMode":"host"}],"VirtualIPs":[{"NetworkID":"net1","Addr":"10.0.0.2/24"}]}}`))
+		case strings.HasSuffix(r.URL.Path, "/services/migrate"):
+			w.Write([]byte(`{"ID":"migrate","Spec":{"Name":"migrate","Mode":{"ReplicatedJob":{"MaxConcurrent":2,"TotalCompletions":5}}}}`))
+		case strings.HasSuffix(r.URL.Path, "/tasks") && strings.Contains(r.URL.RawQuery, "migrate"):
+			w.Write([]byte(`[
+				{"DesiredState":"complete","Status":{"State":"complete"}},
+				{"DesiredState":"complete","Status":{"State":"complete"}},
+				{"DesiredState":"running","Status":{"State":"running"}}]`))
+		case strings.HasSuffix(r.URL.Path, "/tasks"):
+			w.Write([]byte(`[
+				{"DesiredState":"running","Status":{"State":"running"},"NetworksAttachments":[
+					{"Network":{"ID":"net1"},"Addresses":["10.0.0.5/24"]},
+					{"Network":{"ID":"net2"},"Addresses":["10.0.1.5/24"]}]},
+				{"DesiredState":"running","Status":{"State":"running"},"NetworksAttachments":[{"Network":{"ID":"net1"},"Addresses":["10.0.0.6/24"]}]},
+				{"ID":"t3","Slot":3,"NodeID":"node1","DesiredState":"shutdown","Status":{"State":"running","ContainerStatus":{"ContainerID":"c3"}},"NetworksAttachments":[{"Network":{"ID":"net1"},"Addresses":["10.0.0.8/24"]}]},
+				{"DesiredState":"running","Status":{"State":"starting"},"NetworksAttachments":[{"Network":{"ID":"net1"},"Addresses":["10.0.0.7/24"]}]}]`))
+		case strings.HasSuffix(r.URL.Path, "/tasks/t9"):
+			w.Write([]byte(`{"ID":"t9","Slot":9,"DesiredState":"running","Status":{"State":"starting"}}`))
+		case strings.HasSuffix(r.URL.Path, "/networks/net1"):
+			w.Write([]byte(`{"Name":"frontend","Scope":"swarm","Driver":"overlay"}`))
+		case strings.HasSuffix(r.URL.Path, "/networks/net2"):
+			w.Write([]byte(`{"Name":"backend","Scope":"swarm","Driver":"overlay"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swarm := newSwarmInspector(client, func(format string, v ...interface{}) {
+		t.Errorf(format, v...)
+	})
+
+	service, ok := swarm.service("web")
+	if !ok {
+		t.Fatal("expected the service to be inspected")
+	}
+	expected := []SwarmServiceNetwork{
+		{IP: "10.0.0.2", Name: "frontend", Scope: "swarm", Driver: "overlay", TaskIPs: []string{"10.0.0.5", "10.0.0.6"}},
+		{IP: "", Name: "backend", Scope: "swarm", Driver: "overlay", TaskIPs: []string{"10.0.1.5"}},
+	}
+	if !reflect.DeepEqual(service.Networks, expected) {
+		t.Errorf("expected: %+v. got: %+v", expected, service.Networks)
+	}
+
+	expectedPorts := []SwarmServicePort{
+		{PublishedPort: 8080, TargetPort: 80, Protocol: "tcp", PublishMode: "ingress"},
+		{Name: "metrics", PublishedPort: 30001, TargetPort: 9100, Protocol: "tcp", PublishMode: "host"},
+	}
+	if !reflect.DeepEqual(service.Ports, expectedPorts) {
+		t.Errorf("expected: %+v. got: %+v", expectedPorts, service.Ports)
+	}
+
+	expectedSecrets := []SwarmFile{
+		{ID: "s1", Name: "site_key", Target: "/run/secrets/site.key", UID: "0", GID: "0", Mode: 0400},
+		{ID: "s2", Name: "site_crt", Target: "/etc/ssl/site.crt", Mode: 0444},
+	}
+	if !reflect.DeepEqual(service.Secrets, expectedSecrets) {
+		t.Errorf("expected: %+v. got: %+v", expectedSecrets, service.Secrets)
+	}
+	expectedConfigs := []SwarmFile{
+		{ID: "c1", Name: "nginx_conf", Target: "/nginx.conf", Mode: 0444},
+		{ID: "c2", Name: "credspec"},
+	}
+	if !reflect.DeepEqual(service.Configs, expectedConfigs) {
+		t.Errorf("expected: %+v. got: %+v", expectedConfigs, service.Configs)
+	}
+
+	expectedPlacement := SwarmPlacement{
+		Constraints: []string{"node.role==worker"},
+		Preferences: []string{"node.labels.zone"},
+		MaxReplicas: 2,
+	}
+	if !reflect.DeepEqual(service.Placement, expectedPlacement) {
+		t.Errorf("expected: %+v. got: %+v", expectedPlacement, service.Placement)
+	}
+	if service.Reservations.CPUs() != 0.5 || service.Reservations.MemoryBytes != 268435456 {
+		t.Errorf("unexpected reservations: %+v", service.Reservations)
+	}
+
+	status := service.UpdateStatus
+	if status.State != "updating" || status.Message != "update in progress" || status.StartedAt.Year() != 2016 || !status.CompletedAt.IsZero() {
+		t.Errorf("unexpected update status: %+v", status)
+	}
+	if !status.Updating() {
+		t.Error("expected the service to be updating")
+	}
+
+	if len(service.Tasks) != 4 {
+		t.Fatalf("expected the 4 tasks of the service, got %d", len(service.Tasks))
+	}
+	expectedTask := SwarmTask{
+		ID:           "t3",
+		Slot:         3,
+		NodeID:       "node1",
+		ContainerID:  "c3",
+		DesiredState: "shutdown",
+		State:        "running",
+		Networks:     []SwarmTaskNetwork{{Name: "frontend", IPs: []string{"10.0.0.8"}}},
+	}
+	if !reflect.DeepEqual(service.Tasks[3], expectedTask) {
+		t.Errorf("expected: %+v. got: %+v", expectedTask, service.Tasks[3])
+	}
+
+	if service.Mode != SwarmModeReplicated || service.IsJob() {
+		t.Errorf("expected a replicated service, got %s", service.Mode)
+	}
+	if service.DesiredReplicas != 3 || service.RunningReplicas != 2 {
+		t.Errorf("expected 2 of 3 replicas running, got %d of %d", service.RunningReplicas, service.DesiredReplicas)
+	}
+
+	swarm.service("web")
+	if serviceRequests != 1 {
+		t.Errorf("expected the service to be inspected once, got %d", serviceRequests)
+	}
+
+	job, ok := swarm.service("migrate")
+	if !ok {
+		t.Fatal("expected the job to be inspected")
+	}
+	expectedJob := SwarmJobStatus{TotalCompletions: 5, MaxConcurrent: 2, RunningTasks: 1, CompletedTasks: 2}
+	if !job.IsJob() || job.Job != expectedJob {
+		t.Errorf("expected: %+v. got: %s %+v", expectedJob, job.Mode, job.Job)
+	}
+	if job.DesiredReplicas != 1 || job.RunningReplicas != 1 {
+		t.Errorf("expected 1 of 1 job tasks running, got %d of %d", job.RunningReplicas, job.DesiredReplicas)
+	}
+
+	task, ok := swarm.task("web", "t3")
+	if !ok || task.Slot != 3 || task.State != "running" || !task.ShuttingDown() {
+		t.Errorf("unexpected task: %+v", task)
+	}
+	task, ok = swarm.task("web", "t9")
+	if !ok || task.Slot != 9 || task.State != "starting" || task.ShuttingDown() {
+		t.Errorf("unexpected task: %+v", task)
+	}
+}
+
+func TestSwarmInspectorNode(t *testing.T) {
+	nodeRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/nodes/node1") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		nodeRequests++
+		w.Write([]byte(`{"ID":"node1","Spec":{"Name":"worker-1","Role":"worker","Availability":"drain","Labels":{"tier":"edge"}},"Description":{"Engine":{"EngineVersion":"27.2.0"}},"Status":{"State":"ready","Addr":"192.168.1.21"}}`))
+	}))
+	defer server.Close()
+
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := 0
+	swarm := newSwarmInspector(client, func(format string, v ...interface{}) {
+		errs++
+	})
+
+	expected := SwarmNode{
+		ID:            "node1",
+		Name:          "worker-1",
+		Address:       Address{IP: "192.168.1.21"},
+		Role:          "worker",
+		Availability:  "drain",
+		State:         "ready",
+		EngineVersion: "27.2.0",
+		Labels:        map[string]string{"tier": "edge"},
+	}
+	for i := 0; i < 2; i++ {
+		node, ok := swarm.node("node1")
+		if !ok {
+			t.Fatal("expected the node to be inspected")
+		}
+		if !reflect.DeepEqual(*node, expected) {
+			t.Errorf("expected: %+v. got: %+v", expected, *node)
+		}
+	}
+	if nodeRequests != 1 {
+		t.Errorf("expected the node to be inspected once, got %d", nodeRequests)
+	}
+
+	if _, ok := swarm.node("node2"); ok || errs != 1 {
+		t.Errorf("expected the missing node to be reported once, got %d errors", errs)
+	}
+	swarm.node("node2")
+	if errs != 1 {
+		t.Errorf("expected the missing node not to be inspected again, got %d errors", errs)
+	}
+}
@@ -0,0 +1,135 @@
+package dockergen
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// swarmConfigLabel marks the Swarm configs written by docker-gen with the
+// name of their dest
+const swarmConfigLabel = "com.github.jwilder.docker-gen.config"
+
+// swarmClient returns the docker client Swarm config dests are written with
+func (g *generator) swarmClient() *docker.Client {
+	return g.dockerHosts()[0].Client
+}
+
+// swarmConfig is a dest written to Swarm configs. Configs are immutable, so
+// each update creates a config named after the dest and a hash of its
+// contents, moves the services using the previous one to it and removes the
+// previous one.
+type swarmConfig struct {
+	client *docker.Client
+	name   string
+}
+
+// versions returns the configs of the dest, the newest first
+func (c *swarmConfig) versions(ctx context.Context) ([]swarm.Config, error) {
+	configs, err := c.client.ListConfigs(docker.ListConfigsOptions{
+		Filters: map[string][]string{"label": {swarmConfigLabel + "=" + c.name}},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].CreatedAt.After(configs[j].CreatedAt)
+	})
+	return configs, nil
+}
+
+func (c *swarmConfig) read(ctx context.Context) ([]byte, string, error) {
+	configs, err := c.versions(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(configs) == 0 {
+		return nil, "", os.ErrNotExist
+	}
+	return configs[0].Spec.Data, configs[0].ID, nil
+}
+
+func (c *swarmConfig) write(ctx context.Context, contents []byte, version string) (bool, error) {
+	previous, err := c.versions(ctx)
+	if err != nil {
+		return false, err
+	}
+	if (len(previous) == 0 && version != "") || (len(previous) > 0 && previous[0].ID != version) {
+		return false, nil
+	}
+
+	sum := sha256.Sum256(contents)
+	name := c.name + "-" + hex.EncodeToString(sum[:])[:12]
+	config, err := c.client.CreateConfig(docker.CreateConfigOptions{
+		ConfigSpec: swarm.ConfigSpec{
+			Annotations: swarm.Annotations{
+				Name:   name,
+				Labels: map[string]string{swarmConfigLabel: c.name},
+			},
+			Data: contents,
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		return false, fmt.Errorf("Unable to create config %s: %s", name, err)
+	}
+
+	old := map[string]bool{}
+	for _, config := range previous {
+		old[config.ID] = true
+	}
+	if err := c.updateServices(ctx, old, config.ID, name); err != nil {
+		return false, err
+	}
+	for _, config := range previous {
+		if err := c.client.RemoveConfig(docker.RemoveConfigOptions{ID: config.ID, Context: ctx}); err != nil {
+			logWarnf("Unable to remove config %s: %s", config.Spec.Name, err)
+		}
+	}
+	return true, nil
+}
+
+// updateServices moves the services using one of the old configs to the new
+// config, which rolls out their tasks
+func (c *swarmConfig) updateServices(ctx context.Context, old map[string]bool, id, name string) error {
+	if len(old) == 0 {
+		return nil
+	}
+	services, err := c.client.ListServices(docker.ListServicesOptions{Context: ctx})
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		spec := service.Spec
+		if spec.TaskTemplate.ContainerSpec == nil {
+			continue
+		}
+		updated := false
+		for _, ref := range spec.TaskTemplate.ContainerSpec.Configs {
+			if old[ref.ConfigID] {
+				ref.ConfigID = id
+				ref.ConfigName = name
+				updated = true
+			}
+		}
+		if !updated {
+			continue
+		}
+		logInfof("Updating service '%s' to config %s", spec.Name, name)
+		if err := c.client.UpdateService(service.ID, docker.UpdateServiceOptions{
+			ServiceSpec: spec,
+			Version:     service.Version.Index,
+			Context:     ctx,
+		}); err != nil {
+			return fmt.Errorf("Unable to update service %s: %s", spec.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package dockergen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestSwarmConfigDest(t *testing.T) {
+	var mu sync.Mutex
+	configs := []swarm.Config{}
+	service := swarm.Service{
+		ID:   "s1",
+		Meta: swarm.Meta{Version: swarm.Version{Index: 3}},
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: "haproxy"},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{
+					Configs: []*swarm.ConfigReference{{ConfigName: "unrelated", ConfigID: "c0"}},
+				},
+			},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := r.URL.Path
+		for _, prefix := range []string{"/configs", "/services"} {
+			if i := strings.Index(r.URL.Path, prefix); i >= 0 {
+				path = r.URL.Path[i:]
+			}
+		}
+		switch {
+		case r.Method == "GET" && path == "/configs":
+			json.NewEncoder(w).Encode(configs)
+		case r.Method == "POST" && path == "/configs/create":
+			var spec swarm.ConfigSpec
+			json.NewDecoder(r.Body).Decode(&spec)
+			id := "c" + string(rune('1'+len(configs)))
+			configs = append(configs, swarm.Config{ID: id, Meta: swarm.Meta{CreatedAt: time.Now()}, Spec: spec})
+			json.NewEncoder(w).Encode(map[string]string{"ID": id})
+		case r.Method == "DELETE":
+			id := strings.TrimPrefix(path, "/configs/")
+			for i, config := range configs {
+				if config.ID == id {
+					configs = append(configs[:i], configs[i+1:]...)
+					break
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "GET" && path == "/services":
+			json.NewEncoder(w).Encode([]swarm.Service{service})
+		case r.Method == "POST" && path == "/services/s1/update":
+			json.NewDecoder(r.Body).Decode(&service.Spec)
+			service.Version.Index++
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, ok, err := newRemoteDest("swarm-config://haproxy", client)
+	if !ok || err != nil {
+		t.Fatalf("Expected a swarm config dest, got %v", err)
+	}
+	config := Config{Dest: "swarm-config://haproxy"}
+	if changed, err := writeRemoteDest(config, remote, []byte("backend web")); !changed || err != nil {
+		t.Fatalf("Expected the config to be created, got %t, %v", changed, err)
+	}
+	if len(configs) != 1 || configs[0].Spec.Labels[swarmConfigLabel] != "haproxy" || !strings.HasPrefix(configs[0].Spec.Name, "haproxy-") {
+		t.Fatalf("Incorrect configs: %+v", configs)
+	}
+	first := configs[0]
+
+	// the service starts using the config
+	service.Spec.TaskTemplate.ContainerSpec.Configs = append(service.Spec.TaskTemplate.ContainerSpec.Configs,
+		&swarm.ConfigReference{ConfigName: first.Spec.Name, ConfigID: first.ID})
+
+	if changed, err := writeRemoteDest(config, remote, []byte("backend web")); changed || err != nil {
+		t.Fatalf("Expected the config to be unchanged, got %t, %v", changed, err)
+	}
+	if changed, err := writeRemoteDest(config, remote, []byte("backend api")); !changed || err != nil {
+		t.Fatalf("Expected the config to be rotated, got %t, %v", changed, err)
+	}
+	if len(configs) != 1 || configs[0].ID == first.ID || string(configs[0].Spec.Data) != "backend api" {
+		t.Fatalf("Expected the previous config to be replaced, got %+v", configs)
+	}
+	refs := service.Spec.TaskTemplate.ContainerSpec.Configs
+	if refs[0].ConfigID != "c0" || refs[1].ConfigID != configs[0].ID || refs[1].ConfigName != configs[0].Spec.Name {
+		t.Fatalf("Expected the service to use the new config, got %+v %+v", refs[0], refs[1])
+	}
+
+	contents, _, err := remote.read(context.Background())
+	if err != nil || string(contents) != "backend api" {
+		t.Fatalf("Expected to read the new config, got %q, %v", contents, err)
+	}
+}
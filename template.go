@@ -3,21 +3,27 @@ package dockergen
 import (
 	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode"
 )
 
 func exists(path string) (bool, error) {
@@ -109,6 +115,7 @@ func groupByKeys(entries interface{}, key string) ([]string, error) {
 	for k := range keys {
 		ret = append(ret, k)
 	}
+	sort.Strings(ret)
 	return ret, nil
 }
 
@@ -163,6 +170,14 @@ func whereNot(entries interface{}, key string, cmp interface{}) (interface{}, er
 	})
 }
 
+// excludeJobs selects the entries, such as containers, whose Service is not a
+// swarm job, so one-shot tasks don't end up in upstream lists
+func excludeJobs(entries interface{}) (interface{}, error) {
+	return generalizedWhere("excludeJobs", entries, "Service.Mode", func(value interface{}) bool {
+		return value != SwarmModeReplicatedJob && value != SwarmModeGlobalJob
+	})
+}
+
 // selects entries where a key exists
 func whereExist(entries interface{}, key string) (interface{}, error) {
 	return generalizedWhere("whereExist", entries, key, func(value interface{}) bool {
@@ -202,6 +217,17 @@ func whereAll(entries interface{}, key, sep string, cmp []string) (interface{},
 	})
 }
 
+// selects entries matching a filter expression
+func whereExpr(entries interface{}, expr string) (interface{}, error) {
+	node, err := parseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return generalizedWhere("whereExpr", entries, "", func(value interface{}) bool {
+		return truthy(node.eval(value))
+	})
+}
+
 // generalized whereLabel function
 func generalizedWhereLabel(funcName string, containers Context, label string, test func(string, bool) bool) (Context, error) {
 	selection := make([]*RuntimeContainer, 0)
@@ -244,6 +270,83 @@ func whereLabelValueMatches(containers Context, label, pattern string) (Context,
 	})
 }
 
+// LabelMatch is a container whose label value matched a regular expression.
+// Groups holds the capture groups of the match by index, "0" being the whole
+// match, and by name for named groups such as (?P<host>...).
+type LabelMatch struct {
+	Container *RuntimeContainer
+	Value     string
+	Groups    map[string]string
+}
+
+// matchGroups returns the capture groups of the first match of rx in value,
+// or false if it doesn't match
+func matchGroups(rx *regexp.Regexp, value string) (map[string]string, bool) {
+	match := rx.FindStringSubmatch(value)
+	if match == nil {
+		return nil, false
+	}
+	groups := make(map[string]string, len(match))
+	for i, name := range rx.SubexpNames() {
+		groups[strconv.Itoa(i)] = match[i]
+		if name != "" {
+			groups[name] = match[i]
+		}
+	}
+	return groups, true
+}
+
+// labelMatch returns the capture groups of the match of a regular expression
+// in the value of a container's label, nil if the label is missing or doesn't
+// match
+func labelMatch(container *RuntimeContainer, label, pattern string) (map[string]string, error) {
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := container.Labels[label]
+	if !ok {
+		return nil, nil
+	}
+	groups, _ := matchGroups(rx, value)
+	return groups, nil
+}
+
+// labelMatches selects the containers with a particular label whose value
+// matches a regular expression, along with the capture groups of the match
+func labelMatches(containers Context, label, pattern string) ([]LabelMatch, error) {
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches := []LabelMatch{}
+	for _, container := range containers {
+		value, ok := container.Labels[label]
+		if !ok {
+			continue
+		}
+		if groups, ok := matchGroups(rx, value); ok {
+			matches = append(matches, LabelMatch{Container: container, Value: value, Groups: groups})
+		}
+	}
+	return matches, nil
+}
+
+// selects containers without a particular label or whose label value is none of values
+func whereLabelValueNotIn(containers Context, label string, values ...string) (Context, error) {
+	return generalizedWhereLabel("whereLabelValueNotIn", containers, label, func(value string, ok bool) bool {
+		if !ok {
+			return true
+		}
+		for _, v := range values {
+			if value == v {
+				return false
+			}
+		}
+		return true
+	})
+}
+
 // hasPrefix returns whether a given string is a prefix of another string
 func hasPrefix(prefix, s string) bool {
 	return strings.HasPrefix(s, prefix)
@@ -264,7 +367,7 @@ func keys(input interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("Cannot call keys on a non-map value: %v", input)
 	}
 
-	vk := val.MapKeys()
+	vk := sortedMapKeys(val)
 	k := make([]interface{}, val.Len())
 	for i := range k {
 		k[i] = vk[i].Interface()
@@ -273,27 +376,112 @@ func keys(input interface{}) (interface{}, error) {
 	return k, nil
 }
 
+// sortedMapKeys returns the keys of a map, sorted when they are strings or numbers
+func sortedMapKeys(val reflect.Value) []reflect.Value {
+	vk := val.MapKeys()
+	sort.Slice(vk, func(i, j int) bool {
+		a, b := vk[i], vk[j]
+		switch a.Kind() {
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		}
+		return false
+	})
+	return vk
+}
+
+// KeyValue is a single entry of a map as returned by sortedPairs
+type KeyValue struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// sortedPairs returns the entries of a map ordered by key
+func sortedPairs(input interface{}) ([]KeyValue, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	val := reflect.ValueOf(input)
+	if val.Kind() != reflect.Map {
+		return nil, fmt.Errorf("Cannot call sortedPairs on a non-map value: %v", input)
+	}
+
+	pairs := make([]KeyValue, 0, val.Len())
+	for _, k := range sortedMapKeys(val) {
+		pairs = append(pairs, KeyValue{Key: k.Interface(), Value: val.MapIndex(k).Interface()})
+	}
+	return pairs, nil
+}
+
+// intersect returns the strings present in both slices, in the order of l1
 func intersect(l1, l2 []string) []string {
-	m := make(map[string]bool)
 	m2 := make(map[string]bool)
 	for _, v := range l2 {
 		m2[v] = true
 	}
+	seen := make(map[string]bool)
+	keys := []string{}
 	for _, v := range l1 {
-		if m2[v] {
-			m[v] = true
+		if m2[v] && !seen[v] {
+			seen[v] = true
+			keys = append(keys, v)
+		}
+	}
+	return keys
+}
+
+// union returns the strings present in either slice, in order of appearance
+func union(l1, l2 []string) []string {
+	seen := make(map[string]bool)
+	keys := []string{}
+	for _, l := range [][]string{l1, l2} {
+		for _, v := range l {
+			if !seen[v] {
+				seen[v] = true
+				keys = append(keys, v)
+			}
 		}
 	}
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+	return keys
+}
+
+// difference returns the strings of l1 that are not present in l2
+func difference(l1, l2 []string) []string {
+	m2 := make(map[string]bool)
+	for _, v := range l2 {
+		m2[v] = true
+	}
+	seen := make(map[string]bool)
+	keys := []string{}
+	for _, v := range l1 {
+		if !m2[v] && !seen[v] {
+			seen[v] = true
+			keys = append(keys, v)
+		}
 	}
 	return keys
 }
 
-func contains(item map[string]string, key string) bool {
-	if _, ok := item[key]; ok {
-		return true
+// contains returns whether a map contains a key or a string contains a substring
+func contains(item interface{}, key string) bool {
+	switch v := item.(type) {
+	case map[string]string:
+		_, ok := v[key]
+		return ok
+	case string:
+		return strings.Contains(v, key)
+	}
+
+	val := reflect.ValueOf(item)
+	if val.Kind() == reflect.Map && val.Type().Key().Kind() == reflect.String {
+		return val.MapIndex(reflect.ValueOf(key).Convert(val.Type().Key())).IsValid()
 	}
 	return false
 }
@@ -319,6 +507,31 @@ func hashSha1(input string) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
+// containerHash returns a short hash of a container's ID and name. It stays
+// the same while the container exists and changes when it is replaced.
+func containerHash(input interface{}, length ...int) (string, error) {
+	var container *RuntimeContainer
+	switch c := input.(type) {
+	case *RuntimeContainer:
+		container = c
+	case RuntimeContainer:
+		container = &c
+	default:
+		return "", fmt.Errorf("Must pass a RuntimeContainer to 'containerHash'; received %v", input)
+	}
+
+	n := 8
+	if len(length) > 0 {
+		n = length[0]
+	}
+	sum := sha256.Sum256([]byte(container.ID + "/" + container.Name))
+	hash := hex.EncodeToString(sum[:])
+	if n > 0 && n < len(hash) {
+		hash = hash[:n]
+	}
+	return hash, nil
+}
+
 func marshalJson(input interface{}) (string, error) {
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
@@ -375,7 +588,7 @@ func dirList(path string) ([]string, error) {
 	names := []string{}
 	files, err := ioutil.ReadDir(path)
 	if err != nil {
-		log.Printf("Template error: %v", err)
+		logErrorf("Template error: %v", err)
 		return names, nil
 	}
 	for _, f := range files {
@@ -409,6 +622,98 @@ func trim(s string) string {
 	return strings.TrimSpace(s)
 }
 
+// replaceAll returns a copy of s with all occurrences of old replaced by new
+func replaceAll(s, old, new string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+// indent prefixes every line of s with the given number of spaces
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// nindent is the same as indent but starts with a newline, which allows
+// nesting a block of text in YAML after a key
+func nindent(spaces int, s string) string {
+	return "\n" + indent(spaces, s)
+}
+
+// sanitize replaces every run of characters other than ASCII letters, digits
+// and underscores with replacement ("_" by default), so that arbitrary host
+// names and labels can be used as identifiers or file names
+func sanitize(s string, replacement ...string) (string, error) {
+	repl := "_"
+	if len(replacement) > 1 {
+		return "", errors.New("sanitize takes at most one replacement")
+	} else if len(replacement) == 1 {
+		repl = replacement[0]
+	}
+
+	var buf bytes.Buffer
+	pending := false
+	for _, r := range s {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			if pending && buf.Len() > 0 {
+				buf.WriteString(repl)
+			}
+			pending = false
+			buf.WriteRune(r)
+		} else {
+			pending = true
+		}
+	}
+	return buf.String(), nil
+}
+
+// slugify returns a lower case version of s with every run of characters
+// other than ASCII letters and digits replaced by a dash
+func slugify(s string) string {
+	slug, _ := sanitize(strings.Replace(strings.ToLower(s), "_", "-", -1), "-")
+	return slug
+}
+
+// URL is the decomposition of a URL returned by urlParse
+type URL struct {
+	Scheme   string
+	User     string
+	Password string
+	Host     string
+	Hostname string
+	Port     string
+	Path     string
+	RawQuery string
+	Query    map[string]string
+	Fragment string
+}
+
+// urlParse splits a URL such as https://backend:8443/path into its parts
+func urlParse(rawurl string) (*URL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Hostname: u.Hostname(),
+		Port:     u.Port(),
+		Path:     u.Path,
+		RawQuery: u.RawQuery,
+		Query:    make(map[string]string),
+		Fragment: u.Fragment,
+	}
+	if u.User != nil {
+		ret.User = u.User.Username()
+		ret.Password, _ = u.User.Password()
+	}
+	for k, v := range u.Query() {
+		ret.Query[k] = v[0]
+	}
+	return ret, nil
+}
+
 // when returns the trueValue when the condition is true and the falseValue otherwise
 func when(condition bool, trueValue, falseValue interface{}) interface{} {
 	if condition {
@@ -418,47 +723,90 @@ func when(condition bool, trueValue, falseValue interface{}) interface{} {
 	}
 }
 
+// templateFuncs are the functions available to all templates
+var templateFuncs = template.FuncMap{
+	"cidrContains":           cidrContains,
+	"closest":                arrayClosest,
+	"coalesce":               coalesce,
+	"containerBatches":       containerBatches,
+	"containerHash":          containerHash,
+	"contains":               contains,
+	"dict":                   dict,
+	"difference":             difference,
+	"dir":                    dirList,
+	"excludeJobs":            excludeJobs,
+	"exists":                 exists,
+	"first":                  arrayFirst,
+	"groupBy":                groupBy,
+	"groupByKeys":            groupByKeys,
+	"groupByMulti":           groupByMulti,
+	"groupByLabel":           groupByLabel,
+	"groupByComposeProject":  groupByComposeProject,
+	"groupByComposeService":  groupByComposeService,
+	"hasPrefix":              hasPrefix,
+	"hasSuffix":              hasSuffix,
+	"humanizeBytes":          humanizeBytes,
+	"humanizeDuration":       humanizeDuration,
+	"indent":                 indent,
+	"json":                   marshalJson,
+	"intersect":              intersect,
+	"ipAdd":                  ipAdd,
+	"isBackup":               isBackup,
+	"isIPv6":                 isIPv6,
+	"isSemver":               isSemver,
+	"keys":                   keys,
+	"labelMatch":             labelMatch,
+	"labelMatches":           labelMatches,
+	"last":                   arrayLast,
+	"lower":                  strings.ToLower,
+	"maskBits":               maskBits,
+	"nindent":                nindent,
+	"plugin":                 pluginData,
+	"registryTags":           registryTags,
+	"replace":                strings.Replace,
+	"replaceAll":             replaceAll,
+	"sanitize":               sanitize,
+	"semverCompare":          semverCompare,
+	"semverMajor":            semverMajor,
+	"semverMinor":            semverMinor,
+	"semverPatch":            semverPatch,
+	"parseBool":              strconv.ParseBool,
+	"parseJson":              unmarshalJson,
+	"queryEscape":            url.QueryEscape,
+	"sha1":                   hashSha1,
+	"slugify":                slugify,
+	"sortByIP":               sortByIP,
+	"sortByWeight":           sortByWeight,
+	"sortedPairs":            sortedPairs,
+	"split":                  strings.Split,
+	"splitN":                 strings.SplitN,
+	"title":                  strings.Title,
+	"trimPrefix":             trimPrefix,
+	"trimSuffix":             trimSuffix,
+	"trim":                   trim,
+	"union":                  union,
+	"upper":                  strings.ToUpper,
+	"vaultSecret":            vaultSecret,
+	"urlDecode":              url.QueryUnescape,
+	"urlEncode":              url.QueryEscape,
+	"urlParse":               urlParse,
+	"weight":                 weight,
+	"when":                   when,
+	"where":                  where,
+	"whereNot":               whereNot,
+	"whereExist":             whereExist,
+	"whereExpr":              whereExpr,
+	"whereNotExist":          whereNotExist,
+	"whereAny":               whereAny,
+	"whereAll":               whereAll,
+	"whereLabelExists":       whereLabelExists,
+	"whereLabelDoesNotExist": whereLabelDoesNotExist,
+	"whereLabelValueMatches": whereLabelValueMatches,
+	"whereLabelValueNotIn":   whereLabelValueNotIn,
+}
+
 func newTemplate(name string) *template.Template {
-	tmpl := template.New(name).Funcs(template.FuncMap{
-		"closest":                arrayClosest,
-		"coalesce":               coalesce,
-		"contains":               contains,
-		"dict":                   dict,
-		"dir":                    dirList,
-		"exists":                 exists,
-		"first":                  arrayFirst,
-		"groupBy":                groupBy,
-		"groupByKeys":            groupByKeys,
-		"groupByMulti":           groupByMulti,
-		"groupByLabel":           groupByLabel,
-		"hasPrefix":              hasPrefix,
-		"hasSuffix":              hasSuffix,
-		"json":                   marshalJson,
-		"intersect":              intersect,
-		"keys":                   keys,
-		"last":                   arrayLast,
-		"replace":                strings.Replace,
-		"parseBool":              strconv.ParseBool,
-		"parseJson":              unmarshalJson,
-		"queryEscape":            url.QueryEscape,
-		"sha1":                   hashSha1,
-		"split":                  strings.Split,
-		"splitN":                 strings.SplitN,
-		"trimPrefix":             trimPrefix,
-		"trimSuffix":             trimSuffix,
-		"trim":                   trim,
-		"when":                   when,
-		"where":                  where,
-		"whereNot":               whereNot,
-		"whereExist":             whereExist,
-		"whereNotExist":          whereNotExist,
-		"whereAny":               whereAny,
-		"whereAll":               whereAll,
-		"whereLabelExists":       whereLabelExists,
-		"whereLabelDoesNotExist": whereLabelDoesNotExist,
-		"whereLabelValueMatches": whereLabelValueMatches,
-	})
-	return tmpl
+	return template.New(name).Funcs(templateFuncs)
 }
 
 func filterRunning(config Config, containers Context) Context {
@@ -475,7 +823,30 @@ func filterRunning(config Config, containers Context) Context {
 	}
 }
 
-func GenerateFile(config Config, containers Context) bool {
+// filterEndpoint returns the containers of the endpoint of config, or those
+// of the -endpoint daemons for configs without endpoint
+func filterEndpoint(config Config, containers Context) Context {
+	filtered := Context{}
+	for _, container := range containers {
+		if config.Endpoint != "" && container.Host == config.Endpoint || config.Endpoint == "" && !container.configOnly {
+			filtered = append(filtered, container)
+		}
+	}
+	return filtered
+}
+
+// filterContainers returns the containers a config's template is rendered with
+func filterContainers(config Config, containers Context) Context {
+	containers = filterEndpoint(config, containers)
+	if len(config.LabelFilters) > 0 || len(config.NameFilters) > 0 || len(config.Filters) > 0 {
+		labeledContainers := Context{}
+		for _, container := range containers {
+			if config.MatchesLabels(container.Labels) && config.MatchesName(container.Name) && config.matchesListFilters(container) {
+				labeledContainers = append(labeledContainers, container)
+			}
+		}
+		containers = labeledContainers
+	}
 	filteredRunningContainers := filterRunning(config, containers)
 	filteredContainers := Context{}
 	if config.OnlyPublished {
@@ -493,8 +864,39 @@ func GenerateFile(config Config, containers Context) bool {
 	} else {
 		filteredContainers = filteredRunningContainers
 	}
+	return filteredContainers
+}
 
-	contents := executeTemplate(config.Template, filteredContainers)
+// GenerateFile renders config from containers and writes dest, returning
+// whether it changed. Swarm config dests and template functions that need a
+// generator, e.g. vaultSecret, fail.
+func GenerateFile(config Config, containers Context) bool {
+	changed, _ := (&generator{}).renderFile(config, containers)
+	return changed
+}
+
+// renderFile renders config from containers and writes dest, returning
+// whether it changed and the error leaving it unchanged
+func (g *generator) renderFile(config Config, containers Context) (bool, error) {
+	filteredContainers := filterContainers(config, containers)
+
+	timeout, err := config.TemplateDeadline()
+	if err != nil {
+		logErrorf("%s. Leaving '%s' unchanged\n", err, config.Dest)
+		g.recordError(config, err)
+		return false, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	contents, err := executeTemplate(config, filteredContainers, timeout, g.streamFuncs(config, filteredContainers, done), g.vaultFuncs(), pluginFuncs(config))
+	if err != nil {
+		// the destination is only replaced once a template rendered completely
+		logErrorf("Template error: %s. Leaving '%s' unchanged\n", err, config.Dest)
+		g.recordError(config, err)
+		runOnErrorCmd(config, err)
+		return false, err
+	}
 
 	if !config.KeepBlankLines {
 		buf := new(bytes.Buffer)
@@ -502,59 +904,456 @@ func GenerateFile(config Config, containers Context) bool {
 		contents = buf.Bytes()
 	}
 
+	if remote, ok, err := newRemoteDest(config.Dest, g.swarmClient()); ok {
+		if err == nil {
+			ok, err = writeRemoteDest(config, remote, contents)
+		}
+		if err != nil {
+			logErrorf("%s. Leaving '%s' unchanged\n", err, config.Dest)
+			g.recordError(config, err)
+			return false, err
+		}
+		if ok {
+			logInfof("Generated '%s' from %d containers", config.Dest, len(filteredContainers))
+		}
+		g.recordSuccess(config)
+		return ok, nil
+	}
+
 	if config.Dest != "" {
+		mode, err := config.DestMode()
+		if err != nil {
+			logErrorf("%s. Leaving '%s' unchanged\n", err, config.Dest)
+			g.recordError(config, err)
+			return false, err
+		}
+		uid, gid := config.DestOwner()
+		if err := ensureDestDir(config); err != nil {
+			logErrorf("Unable to create dest directory: %s\n", err)
+			g.recordError(config, err)
+			return false, err
+		}
+
 		dest, err := ioutil.TempFile(filepath.Dir(config.Dest), "docker-gen")
 		defer func() {
 			dest.Close()
 			os.Remove(dest.Name())
 		}()
 		if err != nil {
-			log.Fatalf("Unable to create temp file: %s\n", err)
+			logFatalf("Unable to create temp file: %s\n", err)
 		}
 
-		if n, err := dest.Write(contents); n != len(contents) || err != nil {
-			log.Fatalf("Failed to write to temp file: wrote %d, exp %d, err=%v", n, len(contents), err)
+		output := append(provenanceHeader(config, contents), contents...)
+		if n, err := dest.Write(output); n != len(output) || err != nil {
+			logFatalf("Failed to write to temp file: wrote %d, exp %d, err=%v", n, len(output), err)
+		}
+		// the contents are on disk before the rename makes them visible
+		if err := dest.Sync(); err != nil {
+			logFatalf("Unable to sync temp file: %s\n", err)
 		}
 
+		// the configured permissions and owner win over those of the
+		// replaced file
+		fileMode, fileUid, fileGid := mode, uid, gid
 		oldContents := []byte{}
-		if fi, err := os.Stat(config.Dest); err == nil {
-			if err := dest.Chmod(fi.Mode()); err != nil {
-				log.Fatalf("Unable to chmod temp file: %s\n", err)
+		fi, err := os.Stat(config.Dest)
+		exists := err == nil
+		if exists {
+			if fileMode == 0 {
+				fileMode = fi.Mode()
+			}
+			if fileUid < 0 {
+				fileUid = int(fi.Sys().(*syscall.Stat_t).Uid)
 			}
-			if err := dest.Chown(int(fi.Sys().(*syscall.Stat_t).Uid), int(fi.Sys().(*syscall.Stat_t).Gid)); err != nil {
-				log.Fatalf("Unable to chown temp file: %s\n", err)
+			if fileGid < 0 {
+				fileGid = int(fi.Sys().(*syscall.Stat_t).Gid)
 			}
 			oldContents, err = ioutil.ReadFile(config.Dest)
 			if err != nil {
-				log.Fatalf("Unable to compare current file contents: %s: %s\n", config.Dest, err)
+				logFatalf("Unable to compare current file contents: %s: %s\n", config.Dest, err)
+			}
+		}
+		if fileMode != 0 {
+			if err := dest.Chmod(fileMode); err != nil {
+				logFatalf("Unable to chmod temp file: %s\n", err)
 			}
 		}
+		if err := dest.Chown(fileUid, fileGid); err != nil {
+			logFatalf("Unable to chown temp file: %s\n", err)
+		}
 
-		if bytes.Compare(oldContents, contents) != 0 {
+		// the header changes with each generation, only the contents count
+		if bytes.Compare(stripProvenanceHeader(config, oldContents), contents) != 0 {
+			if err := validateFile(config, dest.Name()); err != nil {
+				logErrorf("Validation failed: %s. Leaving '%s' unchanged\n", err, config.Dest)
+				g.recordError(config, err)
+				return false, err
+			}
+			if exists && config.KeepBackups > 0 {
+				rotateBackups(config.Dest, config.KeepBackups)
+			}
 			err = os.Rename(dest.Name(), config.Dest)
 			if err != nil {
-				log.Fatalf("Unable to create dest file %s: %s\n", config.Dest, err)
+				logFatalf("Unable to create dest file %s: %s\n", config.Dest, err)
 			}
-			log.Printf("Generated '%s' from %d containers", config.Dest, len(filteredContainers))
-			return true
+			if config.Stream {
+				logInfof("Generated '%s' from streamed containers", config.Dest)
+			} else {
+				logInfof("Generated '%s' from %d containers", config.Dest, len(filteredContainers))
+			}
+			g.recordSuccess(config)
+			return true, nil
 		}
-		return false
+		if exists {
+			updateDestPermissions(config.Dest, fi, mode, uid, gid)
+		}
+		g.recordSuccess(config)
+		return false, nil
 	} else {
+		os.Stdout.Write(provenanceHeader(config, contents))
 		os.Stdout.Write(contents)
 	}
-	return true
+	g.recordSuccess(config)
+	return true, nil
 }
 
-func executeTemplate(templatePath string, containers Context) []byte {
-	tmpl, err := newTemplate(filepath.Base(templatePath)).ParseFiles(templatePath)
+// rotateBackups shifts dest.1 ... dest.n-1 up by one and links the current
+// dest as dest.1. dest itself stays in place until the new file is renamed
+// over it.
+func rotateBackups(dest string, n int) {
+	for i := n - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", dest, i)
+		if _, err := os.Lstat(from); err != nil {
+			continue
+		}
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", dest, i+1)); err != nil {
+			logErrorf("Unable to rotate backup %s: %s\n", from, err)
+		}
+	}
+	backup := dest + ".1"
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		logErrorf("Unable to remove backup %s: %s\n", backup, err)
+		return
+	}
+	if err := os.Link(dest, backup); err == nil {
+		return
+	}
+	// e.g. filesystems without hard links
+	contents, err := ioutil.ReadFile(dest)
+	if err == nil {
+		err = ioutil.WriteFile(backup, contents, 0600)
+	}
 	if err != nil {
-		log.Fatalf("Unable to parse template: %s", err)
+		logErrorf("Unable to back up %s: %s\n", dest, err)
 	}
+}
 
-	buf := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(buf, filepath.Base(templatePath), &containers)
+// updateDestPermissions applies the configured mode and owner to an
+// unchanged dest whose permissions differ, e.g. after the config changed
+func updateDestPermissions(dest string, fi os.FileInfo, mode os.FileMode, uid, gid int) {
+	if mode != 0 && fi.Mode().Perm() != mode {
+		if err := os.Chmod(dest, mode); err != nil {
+			logErrorf("Unable to chmod %s: %s\n", dest, err)
+		}
+	}
+	stat := fi.Sys().(*syscall.Stat_t)
+	if (uid >= 0 && uint32(uid) != stat.Uid) || (gid >= 0 && uint32(gid) != stat.Gid) {
+		if err := os.Chown(dest, uid, gid); err != nil {
+			logErrorf("Unable to chown %s: %s\n", dest, err)
+		}
+	}
+}
+
+// provenanceHeaderMarker starts the first line of provenance headers
+const provenanceHeaderMarker = "Generated by docker-gen"
+
+// Version is the docker-gen version mentioned in provenance headers
+var Version = "unknown"
+
+// provenanceHeader returns the comment lines prepended to contents when
+// the config's header option is set
+func provenanceHeader(config Config, contents []byte) []byte {
+	if !config.Header {
+		return nil
+	}
+	trigger := config.trigger
+	if trigger == "" {
+		trigger = "unknown"
+	}
+	sum := sha256.Sum256(contents)
+	var b bytes.Buffer
+	for _, line := range []string{
+		fmt.Sprintf("%s %s from %s", provenanceHeaderMarker, Version, config.Template),
+		"Content hash: sha256:" + hex.EncodeToString(sum[:]),
+		"Trigger: " + trigger,
+	} {
+		b.WriteString(config.HeaderCommentLine(line))
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+// stripProvenanceHeader returns contents without a provenance header, so
+// generations only differing in the header don't count as changes
+func stripProvenanceHeader(config Config, contents []byte) []byte {
+	marker := config.HeaderCommentLine(provenanceHeaderMarker)
+	marker = marker[:strings.Index(marker, provenanceHeaderMarker)+len(provenanceHeaderMarker)]
+	if !config.Header || !bytes.HasPrefix(contents, []byte(marker)) {
+		return contents
+	}
+	for i := 0; i < 3; i++ {
+		n := bytes.IndexByte(contents, '\n')
+		if n < 0 {
+			return nil
+		}
+		contents = contents[n+1:]
+	}
+	return contents
+}
+
+// ensureDestDir creates the parent directory of config's destination when
+// mkdirs is enabled
+func ensureDestDir(config Config) error {
+	if !config.Mkdirs || config.Dest == "" {
+		return nil
+	}
+	mode, err := config.DestDirMode()
 	if err != nil {
-		log.Fatalf("Template error: %s\n", err)
+		return err
+	}
+	return os.MkdirAll(filepath.Dir(config.Dest), mode)
+}
+
+// runOnErrorCmd runs the config's on_error_cmd after a failed generation with
+// the error in DOCKER_GEN_ERROR
+func runOnErrorCmd(config Config, genErr error) {
+	if config.OnErrorCmd == "" {
+		return
+	}
+
+	logInfof("Running '%s'", config.OnErrorCmd)
+	cmd := exec.Command("/bin/sh", "-c", config.OnErrorCmd)
+	cmd.Env = append(os.Environ(), "DOCKER_GEN_ERROR="+genErr.Error(), "DOCKER_GEN_DEST="+config.Dest)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		logErrorf("Error running on error command: %s, %s\n", config.OnErrorCmd, err)
+	}
+	if config.NotifyOutput {
+		for _, line := range strings.Split(string(out), "\n") {
+			if line != "" {
+				logInfof("[%s]: %s", config.OnErrorCmd, line)
+			}
+		}
+	}
+}
+
+// deadlineWriter fails writes once its deadline passed, which aborts the
+// execution of a template at its next output
+type deadlineWriter struct {
+	buf      bytes.Buffer
+	deadline time.Time
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	if !w.deadline.IsZero() && time.Now().After(w.deadline) {
+		return 0, errTemplateTimeout
+	}
+	return w.buf.Write(p)
+}
+
+var errTemplateTimeout = errors.New("template execution timed out")
+
+// builtinFuncs are the functions predefined by text/template. allow_funcs
+// doesn't need to list them, but deny_funcs can deny them.
+var builtinFuncs = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true,
+	"js": true, "len": true, "not": true, "or": true, "print": true,
+	"printf": true, "println": true, "urlquery": true, "eq": true, "ge": true,
+	"gt": true, "le": true, "lt": true, "ne": true,
+}
+
+// checkTemplateFuncs returns an error if the parsed templates of tmpl call a
+// function config's allow_funcs and deny_funcs don't permit
+func checkTemplateFuncs(config Config, tmpl *template.Template) error {
+	if len(config.AllowFuncs) == 0 && len(config.DenyFuncs) == 0 {
+		return nil
+	}
+	allowed := config.allowsFunc
+
+	var (
+		err  error
+		tree *parse.Tree
+		walk func(node parse.Node)
+	)
+	walk = func(node parse.Node) {
+		if err != nil || reflect.ValueOf(node).IsNil() {
+			return
+		}
+		switch n := node.(type) {
+		case *parse.IdentifierNode:
+			if !allowed(n.Ident) {
+				location, _ := tree.ErrorContext(n)
+				err = fmt.Errorf("%s: function %q is not allowed by this config", location, n.Ident)
+			}
+		case *parse.ListNode:
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if tree = t.Tree; tree != nil {
+			walk(tree.Root)
+		}
+	}
+	return err
+}
+
+// templateFiles returns the files of the template path, a file, a directory
+// or a glob, and the name of the template rendered. In a directory or glob,
+// files whose name starts with "_" are partials included by the single other
+// file.
+func templateFiles(path string) ([]string, string, error) {
+	var files []string
+	fi, err := os.Stat(path)
+	if err == nil && fi.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, entry := range entries {
+			if entry.Mode().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	} else if err != nil && strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, "", err
+		}
+		files = matches
+	} else {
+		return []string{path}, filepath.Base(path), nil
+	}
+
+	entry := ""
+	for _, file := range files {
+		if strings.HasPrefix(filepath.Base(file), "_") {
+			continue
+		}
+		if entry != "" {
+			return nil, "", fmt.Errorf("%s has several templates, %s and %s; prefix partials with _", path, entry, filepath.Base(file))
+		}
+		entry = filepath.Base(file)
+	}
+	if entry == "" {
+		return nil, "", fmt.Errorf("%s has no template besides the partials starting with _", path)
+	}
+	return files, entry, nil
+}
+
+// executeTemplate renders the template of config. With a timeout, it gives
+// up once the timeout expires; a template stuck in a function call without
+// writing output keeps running in the background until it returns.
+func executeTemplate(config Config, containers Context, timeout time.Duration, funcs ...template.FuncMap) ([]byte, error) {
+	switch config.Engine {
+	case "", EngineGo:
+	case EnginePongo2:
+		return executePongo2(config, containers, timeout, funcs...)
+	default:
+		return nil, fmt.Errorf("Unknown template engine %q: must be %q or %q", config.Engine, EngineGo, EnginePongo2)
+	}
+
+	files, name, err := templateFiles(config.Template)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template: %s", err)
+	}
+	tmpl := newTemplate(name)
+	if config.Sprig {
+		tmpl = newSprigTemplate(name)
+	}
+	tmpl = tmpl.Funcs(templateCustomFuncs())
+	for _, f := range funcs {
+		tmpl = tmpl.Funcs(f)
+	}
+	tmpl, err = tmpl.ParseFiles(files...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template: %s", err)
+	}
+	if err := checkTemplateFuncs(config, tmpl); err != nil {
+		return nil, fmt.Errorf("Unable to parse template: %s", err)
+	}
+
+	if len(config.triggerEvents) > 0 {
+		setTriggerEvents(&containers, config.triggerEvents)
+		defer setTriggerEvents(&containers, nil)
+	}
+	if len(config.contextErrors) > 0 {
+		setContextErrors(&containers, config.contextErrors)
+		defer setContextErrors(&containers, nil)
+	}
+	if config.draining {
+		setDraining(&containers, true)
+		defer setDraining(&containers, false)
+	}
+
+	return executeWithDeadline(timeout, func(w io.Writer) error {
+		return tmpl.ExecuteTemplate(w, name, &containers)
+	})
+}
+
+// executeWithDeadline returns the output of execute, which is aborted after
+// timeout unless timeout is 0
+func executeWithDeadline(timeout time.Duration, execute func(w io.Writer) error) ([]byte, error) {
+	w := &deadlineWriter{}
+	if timeout <= 0 {
+		if err := execute(w); err != nil {
+			return nil, err
+		}
+		return w.buf.Bytes(), nil
+	}
+
+	w.deadline = time.Now().Add(timeout)
+	done := make(chan error, 1)
+	go func() {
+		done <- execute(w)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			if time.Now().After(w.deadline) {
+				return nil, fmt.Errorf("%s after %s", errTemplateTimeout, timeout)
+			}
+			return nil, err
+		}
+		return w.buf.Bytes(), nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("%s after %s", errTemplateTimeout, timeout)
 	}
-	return buf.Bytes()
 }
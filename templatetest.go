@@ -0,0 +1,112 @@
+package dockergen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RunTemplateTests renders each <name>.tmpl of dir with the containers of
+// <name>.json and compares the result with <name>.expected, writing a diff of
+// each mismatch to w. It returns whether all templates rendered as expected.
+func RunTemplateTests(dir string, keepBlankLines bool, w io.Writer) (bool, error) {
+	templates, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return false, err
+	}
+	if len(templates) == 0 {
+		return false, fmt.Errorf("no templates (*.tmpl) in %s", dir)
+	}
+	sort.Strings(templates)
+
+	passed := true
+	for _, tmplPath := range templates {
+		name := strings.TrimSuffix(filepath.Base(tmplPath), ".tmpl")
+		if err := runTemplateTest(tmplPath, keepBlankLines, w); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %s\n", name, err)
+			passed = false
+			continue
+		}
+		fmt.Fprintf(w, "ok   %s\n", name)
+	}
+	return passed, nil
+}
+
+func runTemplateTest(tmplPath string, keepBlankLines bool, w io.Writer) error {
+	base := strings.TrimSuffix(tmplPath, ".tmpl")
+	data, err := ioutil.ReadFile(base + ".json")
+	if err != nil {
+		return err
+	}
+	var containers Context
+	if err := json.Unmarshal(data, &containers); err != nil {
+		return fmt.Errorf("Unable to parse %s.json: %s", filepath.Base(base), err)
+	}
+	expected, err := ioutil.ReadFile(base + ".expected")
+	if err != nil {
+		return err
+	}
+
+	contents, err := executeTemplate(Config{Template: tmplPath}, containers, 0)
+	if err != nil {
+		return err
+	}
+	if !keepBlankLines {
+		buf := new(bytes.Buffer)
+		removeBlankLines(bytes.NewReader(contents), buf)
+		contents = buf.Bytes()
+	}
+	if bytes.Equal(contents, expected) {
+		return nil
+	}
+	fmt.Fprintf(w, "--- %s.expected\n+++ %s (rendered)\n", filepath.Base(base), filepath.Base(tmplPath))
+	for _, line := range diffLines(string(expected), string(contents)) {
+		fmt.Fprintln(w, line)
+	}
+	return fmt.Errorf("output differs from %s.expected", filepath.Base(base))
+}
+
+// diffLines returns the lines of a and b prefixed with " " when common to
+// both, "-" when only in a and "+" when only in b
+func diffLines(a, b string) []string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []string{}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, " "+x[i])
+			i++
+			j++
+		case j == len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "-"+x[i])
+			i++
+		default:
+			lines = append(lines, "+"+y[j])
+			j++
+		}
+	}
+	return lines
+}
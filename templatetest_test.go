@@ -0,0 +1,52 @@
+package dockergen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunTemplateTests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"hosts.tmpl":     "{{range .}}\n{{.Name}} {{.Env.VIRTUAL_HOST}}\n{{end}}",
+		"hosts.json":     `[{"Name":"web","Env":{"VIRTUAL_HOST":"example.com"}},{"Name":"api","Env":{"VIRTUAL_HOST":"api.example.com"}}]`,
+		"hosts.expected": "web example.com\napi api.example.com\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	var out bytes.Buffer
+	passed, err := RunTemplateTests(dir, false, &out)
+	if err != nil || !passed {
+		t.Fatalf("Expected the templates to pass, got %v: %s", err, out.String())
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "hosts.expected"), []byte("web example.com\napi example.com\n"), 0644)
+	out.Reset()
+	if passed, _ := RunTemplateTests(dir, false, &out); passed {
+		t.Fatal("Expected a mismatch to fail")
+	}
+	if !strings.Contains(out.String(), "-api example.com\n+api api.example.com\n") || !strings.Contains(out.String(), "FAIL hosts") {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	expected := []string{" a", "-b", "+x", " c", "+d"}
+	if got := diffLines("a\nb\nc", "a\nx\nc\nd"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %q. got: %q", expected, got)
+	}
+}
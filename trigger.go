@@ -0,0 +1,125 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// TriggerEvent is a docker event that triggered a generation
+type TriggerEvent struct {
+	Type       string
+	Action     string
+	ID         string
+	Attributes map[string]string
+	Time       time.Time
+	// Host is the endpoint of the docker daemon the event comes from
+	Host string `json:",omitempty"`
+
+	// configOnly is set for the events of the endpoints of configs
+	configOnly bool
+}
+
+// triggerEvents holds the events of the contexts being rendered, keyed by the
+// context passed to the template
+var triggerEvents = map[*Context][]TriggerEvent{}
+
+func newTriggerEvent(event *docker.APIEvents) TriggerEvent {
+	e := TriggerEvent{
+		Type:       event.Type,
+		Action:     event.Action,
+		ID:         event.Actor.ID,
+		Attributes: event.Actor.Attributes,
+	}
+	if e.Type == "" {
+		e.Type = "container"
+	}
+	if e.Action == "" {
+		e.Action = event.Status
+	}
+	if e.ID == "" {
+		e.ID = event.ID
+	}
+	switch {
+	case event.TimeNano != 0:
+		e.Time = time.Unix(0, event.TimeNano)
+	case event.Time != 0:
+		e.Time = time.Unix(event.Time, 0)
+	default:
+		e.Time = time.Now()
+	}
+	return e
+}
+
+// hostTriggerEvent returns the trigger event of an event of host
+func hostTriggerEvent(host dockerHost, event *docker.APIEvents) TriggerEvent {
+	e := newTriggerEvent(event)
+	e.Host, e.configOnly = host.Endpoint, host.configOnly
+	return e
+}
+
+// TriggerEvents returns the docker events that triggered the current
+// generation, oldest first. It is empty when the generation was not
+// triggered by docker events, and only available from the root context.
+func (c *Context) TriggerEvents() []TriggerEvent {
+	mu.RLock()
+	defer mu.RUnlock()
+	return triggerEvents[c]
+}
+
+// TriggeringEvents is TriggerEvents
+func (c *Context) TriggeringEvents() []TriggerEvent {
+	return c.TriggerEvents()
+}
+
+func setTriggerEvents(c *Context, events []TriggerEvent) {
+	mu.Lock()
+	defer mu.Unlock()
+	if events == nil {
+		delete(triggerEvents, c)
+		return
+	}
+	triggerEvents[c] = events
+}
+
+// triggerEnv returns the environment variables describing why config is
+// generated to the notify command
+func triggerEnv(config Config) []string {
+	data, err := json.Marshal(configTriggerEvents(config))
+	if err != nil {
+		data = []byte("[]")
+	}
+	return []string{
+		"DOCKER_GEN_TRIGGER=" + config.trigger,
+		"DOCKER_GEN_TRIGGER_EVENTS=" + string(data),
+	}
+}
+
+// configTriggerEvents returns the events that triggered the generation of
+// config, empty rather than nil so they are encoded as an array
+func configTriggerEvents(config Config) []TriggerEvent {
+	if config.triggerEvents == nil {
+		return []TriggerEvent{}
+	}
+	return config.triggerEvents
+}
+
+// writeTriggerEventsFile writes the events that triggered the generation of
+// config as JSON to a temporary file and returns its path, for scripts
+// handling more events than fit in their environment
+func writeTriggerEventsFile(config Config) (string, error) {
+	f, err := ioutil.TempFile("", "docker-gen-events")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(configTriggerEvents(config)); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,92 @@
+package dockergen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestNewTriggerEvent(t *testing.T) {
+	e := newTriggerEvent(&docker.APIEvents{ID: "abc", Status: "start", Time: 1500000000})
+	if e.Type != "container" || e.Action != "start" || e.ID != "abc" || e.Time.Unix() != 1500000000 {
+		t.Errorf("unexpected event from the old API: %+v", e)
+	}
+
+	e = newTriggerEvent(&docker.APIEvents{
+		Type:   "container",
+		Action: "die",
+		Actor:  docker.APIActor{ID: "def", Attributes: map[string]string{"name": "web"}},
+	})
+	if e.Action != "die" || e.ID != "def" || e.Attributes["name"] != "web" {
+		t.Errorf("unexpected event from the new API: %+v", e)
+	}
+}
+
+func TestTriggerEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-gen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmplPath := filepath.Join(dir, "trigger.tmpl")
+	if err := ioutil.WriteFile(tmplPath, []byte(`{{range .}}{{range $.TriggerEvents}}{{.Action}} {{.ID}};{{end}}{{end}}{{len .TriggeringEvents}}`), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	config := Config{Template: tmplPath}
+	config.triggerEvents = []TriggerEvent{{Type: "container", Action: "start", ID: "a"}, {Type: "container", Action: "stop", ID: "b"}}
+	contents, err := executeTemplate(config, Context{&RuntimeContainer{}}, 0)
+	if err != nil {
+		t.Fatalf("Expected the template to render, got %v", err)
+	}
+	if string(contents) != "start a;stop b;2" {
+		t.Errorf("unexpected contents: %q", contents)
+	}
+	if len(triggerEvents) != 0 {
+		t.Errorf("expected the events to be released after rendering, got %d", len(triggerEvents))
+	}
+
+	config.trigger = "docker event"
+	env := triggerEnv(config)
+	expected := `DOCKER_GEN_TRIGGER_EVENTS=[{"Type":"container","Action":"start","ID":"a","Attributes":null,"Time":"0001-01-01T00:00:00Z"},{"Type":"container","Action":"stop","ID":"b","Attributes":null,"Time":"0001-01-01T00:00:00Z"}]`
+	if env[0] != "DOCKER_GEN_TRIGGER=docker event" || env[1] != expected {
+		t.Errorf("unexpected notify environment: %q", env)
+	}
+}
+
+func TestTriggerEventsFile(t *testing.T) {
+	config := Config{}
+	config.triggerEvents = []TriggerEvent{{Type: "container", Action: "start", ID: "a", Attributes: map[string]string{"name": "web"}}}
+	path, err := writeTriggerEventsFile(config)
+	if err != nil {
+		t.Fatalf("Expected the events file to be written, got %v", err)
+	}
+	defer os.Remove(path)
+
+	var events []TriggerEvent
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &events); err != nil {
+		t.Fatalf("Expected the events file to be JSON, got %v", err)
+	}
+	if !reflect.DeepEqual(events, config.triggerEvents) {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	path, err = writeTriggerEventsFile(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	if data, _ := ioutil.ReadFile(path); string(data) != "[]\n" {
+		t.Errorf("expected an empty array without events, got %q", data)
+	}
+}
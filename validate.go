@@ -0,0 +1,61 @@
+package dockergen
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// shellQuote quotes s as a single word of a /bin/sh command
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// validateCmd renders the validate command of config for the temp file
+// holding the new contents of dest. Both paths are shell-quoted, as dest may
+// come from container meta-data with fan_out.
+func validateCmd(config Config, tempFile string) (string, error) {
+	tmpl, err := template.New("validate_cmd").Parse(config.ValidateCmd)
+	if err != nil {
+		return "", fmt.Errorf("Invalid validate_cmd %q: %s", config.ValidateCmd, err)
+	}
+	var cmd bytes.Buffer
+	err = tmpl.Execute(&cmd, struct {
+		TempFile string
+		Dest     string
+	}{shellQuote(tempFile), shellQuote(config.Dest)})
+	if err != nil {
+		return "", fmt.Errorf("Invalid validate_cmd %q: %s", config.ValidateCmd, err)
+	}
+	return cmd.String(), nil
+}
+
+// validateFile runs the validate command of config against tempFile, the
+// rendered but not yet activated dest. It returns an error when the command
+// doesn't exit 0, along with its output.
+func validateFile(config Config, tempFile string) error {
+	if config.ValidateCmd == "" {
+		return nil
+	}
+	command, err := validateCmd(config, tempFile)
+	if err != nil {
+		return err
+	}
+	timeout, err := config.ValidateDeadline()
+	if err != nil {
+		return err
+	}
+
+	logDebugf("Validating '%s' with '%s'", config.Dest, command)
+	cmd := exec.Command("/bin/sh", "-c", command)
+	out, err := runCommand(cmd, timeout)
+	if err != nil {
+		if out := strings.TrimSpace(string(out)); out != "" {
+			return fmt.Errorf("'%s' failed: %s: %s", command, err, out)
+		}
+		return fmt.Errorf("'%s' failed: %s", command, err)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package dockergen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// defaultVaultRefresh is how long secrets without a lease are cached
+const defaultVaultRefresh = 5 * time.Minute
+
+type vaultSecretEntry struct {
+	data    map[string]interface{}
+	expires time.Time
+}
+
+type vaultClient struct {
+	addr     string
+	roleID   string
+	secretID string
+	client   *http.Client
+
+	mu    sync.Mutex
+	token string
+	cache map[string]*vaultSecretEntry
+}
+
+var errNoVault = errors.New("vaultSecret requires docker-gen to be started with -vault-addr")
+
+// newVaultClient authenticates with VAULT_TOKEN or, when it's not set, with
+// the AppRole credentials in VAULT_ROLE_ID and VAULT_SECRET_ID
+func newVaultClient(addr string) *vaultClient {
+	if !strings.Contains(addr, "://") {
+		addr = "https://" + addr
+	}
+	return &vaultClient{
+		addr:     strings.TrimRight(addr, "/"),
+		token:    os.Getenv("VAULT_TOKEN"),
+		roleID:   os.Getenv("VAULT_ROLE_ID"),
+		secretID: os.Getenv("VAULT_SECRET_ID"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		cache:    make(map[string]*vaultSecretEntry),
+	}
+}
+
+func (v *vaultClient) do(method, path string, body interface{}, out interface{}) (int, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(buf)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, v.addr+"/v1/"+strings.TrimLeft(path, "/"), reader)
+	if err != nil {
+		return 0, err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (v *vaultClient) login() error {
+	if v.roleID == "" {
+		return errors.New("no Vault credentials: set VAULT_TOKEN or VAULT_ROLE_ID and VAULT_SECRET_ID")
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	v.token = ""
+	_, err := v.do("POST", "auth/approle/login", map[string]string{
+		"role_id":   v.roleID,
+		"secret_id": v.secretID,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	v.token = resp.Auth.ClientToken
+	return nil
+}
+
+// fetch reads a secret, logging in again once if the token was rejected.
+// Must be called with v.mu held.
+func (v *vaultClient) fetch(path string) (*vaultSecretEntry, error) {
+	if v.token == "" {
+		if err := v.login(); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp struct {
+		LeaseDuration int                    `json:"lease_duration"`
+		Data          map[string]interface{} `json:"data"`
+	}
+	status, err := v.do("GET", path, nil, &resp)
+	if status == http.StatusForbidden && v.roleID != "" {
+		if err = v.login(); err == nil {
+			_, err = v.do("GET", path, nil, &resp)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := resp.Data
+	// KV version 2 nests the secret in data.data next to data.metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	refresh := defaultVaultRefresh
+	if resp.LeaseDuration > 0 {
+		// renew halfway through the lease
+		refresh = time.Duration(resp.LeaseDuration) * time.Second / 2
+	}
+	return &vaultSecretEntry{data: data, expires: time.Now().Add(refresh)}, nil
+}
+
+func (v *vaultClient) secret(path string) (map[string]interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if entry, ok := v.cache[path]; ok {
+		return entry.data, nil
+	}
+	entry, err := v.fetch(path)
+	if err != nil {
+		return nil, err
+	}
+	v.cache[path] = entry
+	return entry.data, nil
+}
+
+// renew refetches the secrets whose lease is about to expire and returns
+// whether any of them changed
+func (v *vaultClient) renew() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	changed := false
+	for path, entry := range v.cache {
+		if time.Now().Before(entry.expires) {
+			continue
+		}
+		renewed, err := v.fetch(path)
+		if err != nil {
+			logErrorf("Error renewing Vault secret %s: %s\n", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(renewed.data, entry.data) {
+			logInfof("Vault secret %s changed", path)
+			changed = true
+		}
+		v.cache[path] = renewed
+	}
+	return changed
+}
+
+// vaultFuncs returns the template functions reading the secrets of the
+// generator's Vault server
+func (g *generator) vaultFuncs() template.FuncMap {
+	if g.vault == nil {
+		return nil
+	}
+	return template.FuncMap{"vaultSecret": g.vault.secretKey}
+}
+
+// vaultSecret is registered for all templates so they parse without
+// -vault-addr; it fails when executed
+func vaultSecret(path, key string) (interface{}, error) {
+	return nil, errNoVault
+}
+
+// secretKey returns the value of key in the Vault secret at path
+func (v *vaultClient) secretKey(path, key string) (interface{}, error) {
+	data, err := v.secret(path)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := data[key]
+	if !ok {
+		return nil, fmt.Errorf("Vault secret %s has no key %s", path, key)
+	}
+	return value, nil
+}
+
+// generateFromVault regenerates all configs when a Vault secret used by the
+// templates changes on renewal
+func (g *generator) generateFromVault() {
+	if g.vault == nil || len(g.configs().FilterWatches().Config) == 0 {
+		return
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		sigChan := g.newSignalChannel()
+		for {
+			select {
+			case <-ticker.C:
+				if g.vault.renew() {
+					g.generateFromContainers("vault secret change")
+				}
+			case sig := <-sigChan:
+				switch sig {
+				case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+					return
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,66 @@
+package dockergen
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestVaultSecret(t *testing.T) {
+	version := "1"
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			logins++
+			w.Write([]byte(`{"auth":{"client_token":"token"}}`))
+		case "/v1/secret/data/nginx":
+			if r.Header.Get("X-Vault-Token") != "token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"lease_duration":0,"data":{"data":{"key":"secret` + version + `"},"metadata":{}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	vault := newVaultClient(server.URL)
+	vault.token = ""
+	vault.roleID = "role"
+	g := &generator{vault: vault}
+
+	for i := 0; i < 2; i++ {
+		tmpl := template.Must(newTemplate("vaultSecret").Funcs(g.vaultFuncs()).Parse(`{{vaultSecret "secret/data/nginx" "key"}}`))
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, nil); err != nil || b.String() != "secret1" {
+			t.Fatalf("expected: %s. got: %s, %v", "secret1", b.String(), err)
+		}
+	}
+	if logins != 1 {
+		t.Errorf("expected: %d login. got: %d", 1, logins)
+	}
+
+	if _, err := vault.secretKey("secret/data/nginx", "missing"); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+	if _, err := vaultSecret("secret/data/nginx", "key"); err != errNoVault {
+		t.Errorf("expected vaultSecret to fail without a Vault address, got %v", err)
+	}
+
+	version = "2"
+	if vault.renew() {
+		t.Error("expected an unexpired secret not to be renewed")
+	}
+	vault.cache["secret/data/nginx"].expires = time.Now().Add(-time.Second)
+	if !vault.renew() {
+		t.Error("expected a changed secret to be reported on renewal")
+	}
+	if value, _ := vault.secretKey("secret/data/nginx", "key"); value != "secret2" {
+		t.Errorf("expected: %s. got: %v", "secret2", value)
+	}
+}
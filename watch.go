@@ -0,0 +1,163 @@
+package dockergen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileWatchDebounce coalesces the bursts of events written by editors and
+// config management tools into a single regeneration
+const fileWatchDebounce = 500 * time.Millisecond
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// watchedFiles returns the files and directories whose changes regenerate
+// config: its template and its watch_paths. A template glob is watched as
+// its directory.
+func watchedFiles(config Config) []string {
+	template := config.Template
+	if strings.ContainsAny(template, "*?[") {
+		template = filepath.Dir(template)
+	}
+	files := []string{absPath(template)}
+	for _, path := range config.WatchPaths {
+		files = append(files, absPath(path))
+	}
+	return files
+}
+
+// watchedDirs returns the directories to watch for changes of file: its
+// parent and, if it is a directory, the directory and all its subdirectories
+func watchedDirs(file string) []string {
+	dirs := []string{filepath.Dir(file)}
+	filepath.Walk(file, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	return dirs
+}
+
+// affectedBy returns whether the file system event name concerns one of the
+// files watched for config, or a file below one of its watched directories.
+// Kubernetes updates mounted ConfigMaps by swapping the "..data" symlink of
+// their directory, which is treated as a change of all files in it.
+func affectedBy(config Config, name string) bool {
+	name = filepath.Clean(name)
+	for _, file := range watchedFiles(config) {
+		if name == file || strings.HasPrefix(name, file+string(filepath.Separator)) {
+			return true
+		}
+		if filepath.Base(name) == "..data" && filepath.Dir(name) == filepath.Dir(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateFromFiles regenerates the configs whose template files or
+// watch_paths change
+func (g *generator) generateFromFiles() {
+	configs := g.configs().FilterWatches().Config
+	if len(configs) == 0 {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logErrorf("Unable to watch files: %s\n", err)
+		return
+	}
+	// files are replaced rather than written by many tools, so their
+	// directories are watched
+	dirs := map[string]bool{}
+	watchDir := func(dir string) {
+		if dirs[dir] {
+			return
+		}
+		if err := watcher.Add(dir); err != nil {
+			logErrorf("Unable to watch %s: %s\n", dir, err)
+			return
+		}
+		dirs[dir] = true
+	}
+	for _, config := range configs {
+		for _, file := range watchedFiles(config) {
+			for _, dir := range watchedDirs(file) {
+				watchDir(dir)
+			}
+		}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer watcher.Close()
+
+		pending := map[int]bool{}
+		timer := time.NewTimer(fileWatchDebounce)
+		timer.Stop()
+		sigChan := g.newSignalChannel()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				affected := false
+				for i, config := range configs {
+					if affectedBy(config, event.Name) {
+						affected = true
+						pending[i] = true
+						timer.Reset(fileWatchDebounce)
+					}
+				}
+				// directories created below watched paths are watched too
+				if affected && event.Op&fsnotify.Create != 0 {
+					for _, dir := range watchedDirs(event.Name)[1:] {
+						watchDir(dir)
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logErrorf("Error watching files: %s\n", err)
+			case <-timer.C:
+				containers, errs, err := g.getContainers()
+				if err != nil {
+					logErrorf("Error listing containers: %s\n", err)
+					continue
+				}
+				for i, config := range configs {
+					if pending[i] {
+						logInfof("Files watched for %s changed", config.Dest)
+						config.trigger = "file change"
+						g.generateConfig(config, containers, errs, false)
+					}
+				}
+				pending = map[int]bool{}
+			case sig := <-sigChan:
+				switch sig {
+				case syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT:
+					return
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package dockergen
+
+import "testing"
+
+func TestAffectedBy(t *testing.T) {
+	config := Config{Template: "/etc/docker-gen/templates/nginx.tmpl"}
+
+	tests := []struct {
+		name     string
+		affected bool
+	}{
+		{"/etc/docker-gen/templates/nginx.tmpl", true},
+		{"/etc/docker-gen/templates/./nginx.tmpl", true},
+		{"/etc/docker-gen/templates/..data", true},
+		{"/etc/docker-gen/templates/other.tmpl", false},
+		{"/etc/docker-gen/..data", false},
+	}
+	for _, test := range tests {
+		if affected := affectedBy(config, test.name); affected != test.affected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.affected, affected)
+		}
+	}
+}
+
+func TestAffectedByWatchPaths(t *testing.T) {
+	config := Config{
+		Template:   "/etc/docker-gen/templates/nginx.tmpl",
+		WatchPaths: []string{"/etc/nginx/certs", "/etc/nginx/dhparam.pem"},
+	}
+
+	tests := []struct {
+		name     string
+		affected bool
+	}{
+		{"/etc/nginx/certs", true},
+		{"/etc/nginx/certs/example.com.crt", true},
+		{"/etc/nginx/certs/example.com/fullchain.pem", true},
+		{"/etc/nginx/certs.old/example.com.crt", false},
+		{"/etc/nginx/dhparam.pem", true},
+		{"/etc/nginx/nginx.conf", false},
+	}
+	for _, test := range tests {
+		if affected := affectedBy(config, test.name); affected != test.affected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.affected, affected)
+		}
+	}
+}
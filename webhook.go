@@ -0,0 +1,142 @@
+package dockergen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NotifyHTTP is a request sent after a config is regenerated, e.g. to the
+// reload endpoint of a proxy
+type NotifyHTTP struct {
+	URL     string `toml:"url"`
+	Method  string `toml:"method"`
+	Headers map[string]string
+	// Body is a template executed with a NotifyHTTPData
+	Body          string
+	Timeout       string
+	Retries       int
+	RetryInterval string `toml:"retry_interval"`
+}
+
+// NotifyHTTPData is the data of the NotifyHTTP body template
+type NotifyHTTPData struct {
+	Name    string
+	Dest    string
+	Trigger string
+	// TriggerEvents are the docker events that triggered the generation
+	TriggerEvents []TriggerEvent
+	Delta         ContainerDelta
+	Containers    Context
+}
+
+const (
+	defaultNotifyHTTPTimeout       = 10 * time.Second
+	defaultNotifyHTTPRetryInterval = time.Second
+)
+
+func (n *NotifyHTTP) durations() (timeout, retryInterval time.Duration, err error) {
+	timeout, retryInterval = defaultNotifyHTTPTimeout, defaultNotifyHTTPRetryInterval
+	if n.Timeout != "" {
+		if timeout, err = time.ParseDuration(n.Timeout); err != nil || timeout <= 0 {
+			return 0, 0, fmt.Errorf("Invalid notify_http timeout %q: must be a duration such as \"5s\"", n.Timeout)
+		}
+	}
+	if n.RetryInterval != "" {
+		if retryInterval, err = time.ParseDuration(n.RetryInterval); err != nil || retryInterval < 0 {
+			return 0, 0, fmt.Errorf("Invalid notify_http retry_interval %q: must be a duration such as \"1s\"", n.RetryInterval)
+		}
+	}
+	return timeout, retryInterval, nil
+}
+
+// body renders the body template of n
+func (n *NotifyHTTP) body(data NotifyHTTPData) ([]byte, error) {
+	if n.Body == "" {
+		return nil, nil
+	}
+	tmpl, err := newTemplate("notify_http").Parse(n.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse notify_http body: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("Unable to render notify_http body: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// notifyHTTP sends the config's NotifyHTTP request. Failed requests and
+// responses other than 2xx are retried up to Retries times, waiting
+// RetryInterval doubled after each attempt. The error of the last attempt is
+// returned.
+func (g *generator) notifyHTTP(config Config, delta ContainerDelta, containers Context) error {
+	n := config.NotifyHTTP
+	if n == nil || n.URL == "" {
+		return nil
+	}
+	timeout, retryInterval, err := n.durations()
+	if err != nil {
+		logErrorf("%s\n", err)
+		return err
+	}
+	body, err := n.body(NotifyHTTPData{
+		Name:          config.Name,
+		Dest:          config.Dest,
+		Trigger:       config.trigger,
+		TriggerEvents: configTriggerEvents(config),
+		Delta:         delta,
+		Containers:    filterContainers(config, containers),
+	})
+	if err != nil {
+		logErrorf("%s\n", err)
+		return err
+	}
+
+	method := strings.ToUpper(n.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	client := &http.Client{Timeout: timeout}
+	for attempt := 0; ; attempt++ {
+		logInfof("Sending %s %s", method, n.URL)
+		err = sendNotifyHTTP(client, method, n, body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= n.Retries {
+			break
+		}
+		logWarnf("Error notifying %s: %s. Retrying in %s", n.URL, err, retryInterval)
+		if !g.sleep(retryInterval) {
+			return err
+		}
+		retryInterval *= 2
+	}
+	logErrorf("Error notifying %s: %s\n", n.URL, err)
+	return err
+}
+
+func sendNotifyHTTP(client *http.Client, method string, n *NotifyHTTP, body []byte) error {
+	req, err := http.NewRequest(method, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range n.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package dockergen
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotifyHTTP(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	attempts := 0
+	var body, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		body, auth = string(data), r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	config := Config{
+		Dest: "/etc/nginx/conf.d/default.conf",
+		NotifyHTTP: &NotifyHTTP{
+			URL:           server.URL,
+			Headers:       map[string]string{"Authorization": "Bearer secret"},
+			Body:          `{{ .Dest }} {{ len .Delta.Added }} {{ .Trigger }}{{ range .TriggerEvents }} {{ .ID }}{{ end }}`,
+			Retries:       2,
+			RetryInterval: "1ms",
+		},
+	}
+	config.trigger = "docker event"
+	config.triggerEvents = []TriggerEvent{{Type: "container", Action: "start", ID: "1"}}
+	delta := ContainerDelta{Added: []ContainerRef{{ID: "1", Name: "web"}}}
+	g := &generator{}
+	g.notifyHTTP(config, delta, Context{})
+
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if body != "/etc/nginx/conf.d/default.conf 1 docker event 1" || auth != "Bearer secret" {
+		t.Errorf("unexpected request: %q, %q", body, auth)
+	}
+
+	attempts = 0
+	config.NotifyHTTP.Retries = 0
+	g.notifyHTTP(config, delta, Context{})
+	if attempts != 1 {
+		t.Errorf("expected a single attempt without retries, got %d", attempts)
+	}
+}
@@ -0,0 +1,86 @@
+package dockergen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default labels of the load balancer weight helpers
+const (
+	defaultWeightLabel = "lb.weight"
+	defaultBackupLabel = "lb.backup"
+	defaultWeight      = 1
+	maxWeight          = 256
+)
+
+func labelName(funcName, defaultLabel string, label []string) (string, error) {
+	switch len(label) {
+	case 0:
+		return defaultLabel, nil
+	case 1:
+		return label[0], nil
+	}
+	return "", fmt.Errorf("Too many arguments passed to '%s'", funcName)
+}
+
+func containerWeight(container *RuntimeContainer, label string) int {
+	value, ok := container.Labels[label]
+	if !ok {
+		return defaultWeight
+	}
+	weight, err := strconv.Atoi(strings.TrimSpace(value))
+	switch {
+	case err != nil:
+		return defaultWeight
+	case weight < 0:
+		return 0
+	case weight > maxWeight:
+		return maxWeight
+	}
+	return weight
+}
+
+// weight returns the container's weight from its label (default
+// "lb.weight"): 1 when missing or invalid, otherwise clamped to 0-256
+func weight(container *RuntimeContainer, label ...string) (int, error) {
+	name, err := labelName("weight", defaultWeightLabel, label)
+	if err != nil {
+		return 0, err
+	}
+	return containerWeight(container, name), nil
+}
+
+// isBackup returns whether the container's label (default "lb.backup")
+// marks it as a backup server: "true", "1", "yes" or "on"
+func isBackup(container *RuntimeContainer, label ...string) (bool, error) {
+	name, err := labelName("isBackup", defaultBackupLabel, label)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(container.Labels[name])) {
+	case "true", "1", "yes", "on":
+		return true, nil
+	}
+	return false, nil
+}
+
+// sortByWeight returns the containers ordered by descending weight (see
+// weight), then by name
+func sortByWeight(containers Context, label ...string) (Context, error) {
+	name, err := labelName("sortByWeight", defaultWeightLabel, label)
+	if err != nil {
+		return nil, err
+	}
+	sorted := make(Context, len(containers))
+	copy(sorted, containers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		wi, wj := containerWeight(sorted[i], name), containerWeight(sorted[j], name)
+		if wi != wj {
+			return wi > wj
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted, nil
+}
@@ -0,0 +1,24 @@
+package dockergen
+
+import (
+	"testing"
+)
+
+func TestWeightHelpers(t *testing.T) {
+	containers := []*RuntimeContainer{
+		&RuntimeContainer{Name: "c", Labels: map[string]string{"lb.weight": "5"}},
+		&RuntimeContainer{Name: "b", Labels: map[string]string{"lb.weight": "invalid", "lb.backup": "true"}},
+		&RuntimeContainer{Name: "a", Labels: map[string]string{"lb.weight": "1000", "haproxy.weight": "-3"}},
+		&RuntimeContainer{Name: "d", Labels: map[string]string{"lb.backup": "no"}},
+	}
+
+	tests := templateTestList{
+		{`{{range .}}{{weight .}} {{end}}`, containers, `5 1 256 1 `},
+		{`{{range .}}{{weight . "haproxy.weight"}} {{end}}`, containers, `1 1 0 1 `},
+		{`{{range .}}{{isBackup .}} {{end}}`, containers, `false true false false `},
+		{`{{range sortByWeight .}}{{.Name}}{{end}}`, containers, `acbd`},
+		{`{{range sortByWeight . "haproxy.weight"}}{{.Name}}{{end}}`, containers, `bcda`},
+	}
+
+	tests.run(t, "weight")
+}